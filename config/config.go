@@ -20,21 +20,106 @@ import (
 	"github.com/BurntSushi/toml"
 	"github.com/bmatsuo/mtrack/http"
 	"github.com/bmatsuo/mtrack/model"
+	"github.com/bmatsuo/mtrack/player"
 	"github.com/bmatsuo/mtrack/scan"
 )
 
 var Config = struct {
 	HTTP struct {
-		Bind       string
-		StaticRoot string
+		Bind         string
+		StaticRoot   string
+		StreamSecret string // key for signing stream urls, optional
 	}
 	DB struct {
 		Path string
 	}
+	Auth struct {
+		OpenRegistration bool   // allow anyone to create an account
+		SessionDays      uint64 // lifetime of login sessions
+		SecureCookies    bool   // force Secure cookies behind a TLS proxy
+		OIDC             http.OIDCConfig
+	}
+	UpNext struct {
+		IdleDays uint64 // days before a started series is considered abandoned
+	}
+	Progress struct {
+		FinishThreshold float64 // fraction of a media's duration
+	}
+	Player struct {
+		Kind    string                   // open (the default), mpv, vlc or none to only track
+		Command string                   // the executable, by default xdg-open or the kind
+		Args    []string                 // argument templates, e.g. "--title={{.MediaId}}"
+		Timeout uint64                   // seconds, see player.Config
+		Root    map[string]*PlayerConfig // by root name
+		Ext     map[string]*PlayerConfig // by file extension, e.g. ".mp3"
+	}
+	Scrobble struct {
+		Users map[string]string // player accounts to usernames or emails
+	}
+	Role map[string]*struct {
+		Permissions []string
+	}
+	Roles map[string][]model.Permission `toml:"-" json:"-"`
 	Root  map[string]*scan.Root
 	Roots []*scan.Root `toml:"-" json:"-"`
 }{}
 
+// Overrides the player for media in a root or of a file type.
+type PlayerConfig struct {
+	Kind    string
+	Command string
+	Args    []string
+	Timeout uint64
+}
+
+func newPlayer(c *PlayerConfig) (player.Player, error) {
+	return player.New(&player.Config{
+		Kind:    c.Kind,
+		Command: c.Command,
+		Args:    c.Args,
+		Timeout: time.Duration(c.Timeout) * time.Second,
+	})
+}
+
+// the players configured for the roots in Config.Roots.
+func configurePlayers() (*player.Players, error) {
+	var err error
+	players := &player.Players{
+		Roots: make(map[string]player.Player),
+		Exts:  make(map[string]player.Player),
+	}
+	players.Default, err = newPlayer(&PlayerConfig{
+		Kind:    Config.Player.Kind,
+		Command: Config.Player.Command,
+		Args:    Config.Player.Args,
+		Timeout: Config.Player.Timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name, c := range Config.Player.Root {
+		root := Config.Root[name]
+		if root == nil {
+			return nil, fmt.Errorf("player for unknown root %q", name)
+		}
+		players.Roots[root.Path], err = newPlayer(c)
+		if err != nil {
+			return nil, fmt.Errorf("player for root %q: %v", name, err)
+		}
+	}
+	for ext, c := range Config.Player.Ext {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		players.Exts[ext], err = newPlayer(c)
+		if err != nil {
+			return nil, fmt.Errorf("player for %q: %v", ext, err)
+		}
+	}
+	return players, nil
+}
+
 func loadConfig(path string) (toml.MetaData, error) {
 	var zero toml.MetaData
 	var err error
@@ -88,9 +173,33 @@ func Configure() error {
 	Config.Roots = make([]*scan.Root, 0, len(Config.Root))
 	for k, root := range Config.Root {
 		root.Name = k
+		switch root.Scan.Mode {
+		case "":
+			root.Scan.Mode = scan.ModeCron
+		case scan.ModeCron, scan.ModeWatch:
+		default:
+			return fmt.Errorf("root %q: unknown scan mode %q", k, root.Scan.Mode)
+		}
+		err := root.ACL.Validate()
+		if err != nil {
+			return fmt.Errorf("root %q: %v", k, err)
+		}
 		Config.Roots = append(Config.Roots, root)
 	}
 
+	Config.Roles = make(map[string][]model.Permission, len(Config.Role))
+	for name, role := range Config.Role {
+		perms := make([]model.Permission, 0, len(role.Permissions))
+		for _, p := range role.Permissions {
+			perm, err := model.ParsePermission(p)
+			if err != nil {
+				return fmt.Errorf("role %q: unknown permission %q", name, p)
+			}
+			perms = append(perms, perm)
+		}
+		Config.Roles[name] = perms
+	}
+
 	if Config.HTTP.Bind == "" {
 		return fmt.Errorf("unknown http server bind address")
 	}
@@ -103,15 +212,42 @@ func Configure() error {
 
 	// setup global config
 	model.DBPath = Config.DB.Path
+	if Config.Progress.FinishThreshold < 0 || Config.Progress.FinishThreshold > 1 {
+		return fmt.Errorf("finish threshold is not between 0 and 1")
+	}
+	if Config.Progress.FinishThreshold > 0 {
+		model.FinishThreshold = Config.Progress.FinishThreshold
+	}
+	http.ScrobbleUsers = Config.Scrobble.Users
+	http.MediaPlayers, err = configurePlayers()
+	if err != nil {
+		return err
+	}
+	if Config.UpNext.IdleDays > 0 {
+		model.UpNextIdle = time.Duration(Config.UpNext.IdleDays) * 24 * time.Hour
+	}
 	http.HTTPConfig.Addr = Config.HTTP.Bind
 	http.HTTPConfig.StaticPath = Config.HTTP.StaticRoot
+	http.OpenRegistration = Config.Auth.OpenRegistration
+	http.SecureCookies = Config.Auth.SecureCookies
+	if Config.Auth.SessionDays > 0 {
+		model.SessionTTL = time.Duration(Config.Auth.SessionDays) * 24 * time.Hour
+	}
+	if Config.Auth.OIDC.Issuer != "" {
+		if Config.Auth.OIDC.ClientId == "" || Config.Auth.OIDC.RedirectURL == "" {
+			return fmt.Errorf("oidc requires a client id and redirect url")
+		}
+		http.OIDCSettings = Config.Auth.OIDC
+	}
+	if Config.HTTP.StreamSecret != "" {
+		http.StreamSecret = []byte(Config.HTTP.StreamSecret)
+	}
 
 	p, err := json.Marshal(Config.Root)
 
 	log.Print(string(p), err)
-	scan.Init(5*time.Minute, Config.Roots) // TODO handle per-root delays
-
-	return nil
+	// roots without a schedule are scanned every 5 minutes
+	return scan.Init(5*time.Minute, Config.Roots)
 }
 
 func mediaroots(env string) []*scan.Root {
@@ -127,7 +263,7 @@ func mediaroots(env string) []*scan.Root {
 
 		if path == "" {
 			if name != "" {
-				log.Print("%s: path missing", name)
+				log.Printf("%s: path missing", name)
 			}
 			continue
 		}
@@ -0,0 +1,185 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// event.go [created: Sun, 18 Oct 2026]
+
+// Package event is an in-process bus carrying changes to the media library
+// and to user progress. Recent events are kept so subscribers that lose their
+// connection can catch up.
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	MediaCreated     = "media.created"
+	MediaUpdated     = "media.updated"
+	MediaMissing     = "media.missing"
+	ProgressStarted  = "progress.started"
+	ProgressFinished = "progress.finished"
+	ProgressCleared  = "progress.cleared"
+	ScanStarted      = "scan.started"
+	ScanFinished     = "scan.finished"
+)
+
+// All event types.
+var Types = []string{
+	MediaCreated, MediaUpdated, MediaMissing,
+	ProgressStarted, ProgressFinished, ProgressCleared,
+	ScanStarted, ScanFinished,
+}
+
+func ValidType(typ string) bool {
+	for _, t := range Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Something that happened. Root is the path of the root of the media the
+// event concerns, or empty for events concerning no particular root. Ids
+// increase with each event published on a Bus.
+type Event struct {
+	Id      int64       `json:"id"`
+	Type    string      `json:"type"`
+	Time    time.Time   `json:"time"`
+	Root    string      `json:"root,omitempty"`
+	MediaId string      `json:"mediaId,omitempty"`
+	UserId  string      `json:"userId,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// The number of events a subscriber may fall behind before it is dropped.
+var SubscriberBuffer = 64
+
+// Receives events published on a Bus after it subscribed. C is closed when
+// the subscription is closed or when the subscriber falls too far behind, in
+// which case it may subscribe again with SubscribeSince to catch up.
+type Subscription struct {
+	C   <-chan *Event
+	c   chan *Event
+	bus *Bus
+}
+
+// Stop receiving events.
+func (sub *Subscription) Close() {
+	sub.bus.mut.Lock()
+	defer sub.bus.mut.Unlock()
+	sub.bus.drop(sub)
+}
+
+type Bus struct {
+	mut      sync.Mutex
+	lastId   int64
+	history  []*Event // oldest first
+	size     int
+	subs     map[*Subscription]bool
+	handlers []func(*Event)
+}
+
+// Create a bus that keeps the last history events for SubscribeSince.
+func NewBus(history int) *Bus {
+	return &Bus{
+		size: history,
+		subs: make(map[*Subscription]bool),
+	}
+}
+
+// Assign e an id and deliver it to all subscribers. Publish never blocks on
+// slow subscribers but returns only after every handler has been called.
+func (b *Bus) Publish(e *Event) {
+	for _, fn := range b.publish(e) {
+		fn(e)
+	}
+}
+
+// record and deliver e, returning the handlers to call.
+func (b *Bus) publish(e *Event) []func(*Event) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.lastId++
+	e.Id = b.lastId
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if b.size > 0 {
+		if len(b.history) >= b.size {
+			copy(b.history, b.history[1:])
+			b.history = b.history[:len(b.history)-1]
+		}
+		b.history = append(b.history, e)
+	}
+	for sub := range b.subs {
+		select {
+		case sub.c <- e:
+		default:
+			b.drop(sub)
+		}
+	}
+	return b.handlers
+}
+
+// Call fn with every event published after Handle returns, before Publish
+// returns. Unlike subscribers, handlers see every event. fn must not block
+// for long or publish events itself.
+func (b *Bus) Handle(fn func(*Event)) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.handlers = append(b.handlers[:len(b.handlers):len(b.handlers)], fn)
+}
+
+// b.mut must be held.
+func (b *Bus) drop(sub *Subscription) {
+	if b.subs[sub] {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
+
+// Receive events published from now on.
+func (b *Bus) Subscribe() *Subscription {
+	sub, _ := b.subscribe(-1)
+	return sub
+}
+
+// Receive events published after the event with the given id. The retained
+// events since then are returned to be handled before those received on the
+// subscription. An id newer than any event (e.g. from before the process
+// restarted) replays nothing.
+func (b *Bus) SubscribeSince(id int64) (*Subscription, []*Event) {
+	return b.subscribe(id)
+}
+
+func (b *Bus) subscribe(id int64) (*Subscription, []*Event) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	var missed []*Event
+	if id >= 0 && id <= b.lastId {
+		for _, e := range b.history {
+			if e.Id > id {
+				missed = append(missed, e)
+			}
+		}
+	}
+	c := make(chan *Event, SubscriberBuffer)
+	sub := &Subscription{C: c, c: c, bus: b}
+	b.subs[sub] = true
+	return sub, missed
+}
+
+// The bus used by the server.
+var DefaultBus = NewBus(1000)
+
+func Publish(e *Event) {
+	DefaultBus.Publish(e)
+}
+
+func Handle(fn func(*Event)) {
+	DefaultBus.Handle(fn)
+}
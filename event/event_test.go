@@ -0,0 +1,69 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// event_test.go [created: Sun, 18 Oct 2026]
+
+package event
+
+import (
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus(3)
+	sub := bus.Subscribe()
+	for i := 0; i < 5; i++ {
+		bus.Publish(&Event{Type: MediaCreated})
+	}
+	for i := int64(1); i <= 5; i++ {
+		e := <-sub.C
+		if e.Id != i || e.Time.IsZero() {
+			t.Errorf("event %d: %+v", i, e)
+		}
+	}
+
+	// only retained events are replayed.
+	resumed, missed := bus.SubscribeSince(1)
+	if len(missed) != 3 || missed[0].Id != 3 || missed[2].Id != 5 {
+		t.Errorf("missed: %v", missed)
+	}
+	_, missed = bus.SubscribeSince(5)
+	if len(missed) != 0 {
+		t.Errorf("missed nothing: %v", missed)
+	}
+	_, missed = bus.SubscribeSince(99)
+	if len(missed) != 0 {
+		t.Errorf("restarted: %v", missed)
+	}
+
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Errorf("closed subscription received an event")
+	}
+	sub.Close()
+
+	// slow subscribers are dropped rather than blocking publishers.
+	for i := 0; i <= SubscriberBuffer; i++ {
+		bus.Publish(&Event{Type: MediaUpdated})
+	}
+	n := 0
+	for range resumed.C {
+		n++
+	}
+	if n != SubscriberBuffer {
+		t.Errorf("received %d events", n)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	bus := NewBus(0)
+	bus.Publish(&Event{Type: MediaCreated})
+	var handled []int64
+	bus.Handle(func(e *Event) { handled = append(handled, e.Id) })
+	bus.Publish(&Event{Type: MediaUpdated})
+	bus.Publish(&Event{Type: MediaMissing})
+	if len(handled) != 2 || handled[0] != 2 || handled[1] != 3 {
+		t.Errorf("handled: %v", handled)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// access.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/bmatsuo/mtrack/model"
+	"github.com/bmatsuo/mtrack/scan"
+)
+
+// find the configured roots of media. replaced in tests.
+var lookupRoot = scan.LookupRoot
+var configuredRoots = scan.Roots
+
+// The roots a caller may see and record progress in, according to each
+// root's scan.ACL. Admins can access every root.
+type rootAccess struct {
+	admin    bool
+	grantees map[string]bool
+}
+
+// The access of user, who is nil for an anonymous caller.
+func newRootAccess(user *model.User) (*rootAccess, error) {
+	a := &rootAccess{grantees: make(map[string]bool)}
+	if user == nil {
+		return a, nil
+	}
+	var err error
+	a.admin, err = model.UserHasPermission(user.Id, model.PermAdmin)
+	if err != nil {
+		return nil, err
+	}
+	a.grantees["user:"+user.Id] = true
+	if user.Username != "" {
+		a.grantees["user:"+user.Username] = true
+	}
+	// users set their own emails, which are only trusted once verified.
+	if user.Email != "" && user.EmailVerified {
+		a.grantees["user:"+user.Email] = true
+	}
+	roles, err := model.UserRoles(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		a.grantees["role:"+role] = true
+	}
+	return a, nil
+}
+
+// media of roots that are no longer configured is only visible to admins.
+func (a *rootAccess) canRead(rootpath string) bool {
+	if a.admin {
+		return true
+	}
+	root := lookupRoot(rootpath)
+	return root != nil && root.ACL.AllowsRead(a.grantees)
+}
+
+// Like canRead for the root with the given name (scan.Root.Name).
+func (a *rootAccess) canReadNamed(name string) bool {
+	for _, root := range configuredRoots() {
+		if root.Name == name {
+			return a.canRead(root.Path)
+		}
+	}
+	return a.admin
+}
+
+// The paths of the roots the caller can read, for model.ListOptions. Admins
+// are not restricted and nil is returned.
+func (a *rootAccess) readableRoots() []string {
+	if a.admin {
+		return nil
+	}
+	roots := make([]string, 0, 4)
+	for _, root := range configuredRoots() {
+		if root.ACL.AllowsRead(a.grantees) {
+			roots = append(roots, root.Path)
+		}
+	}
+	return roots
+}
+
+func (a *rootAccess) canProgress(rootpath string) bool {
+	if a.admin {
+		return true
+	}
+	root := lookupRoot(rootpath)
+	return root != nil && root.ACL.AllowsProgress(a.grantees)
+}
+
+// Authorize a request that anonymous callers may also make. Requests without
+// an Authorization header and without a valid session are anonymous and a nil
+// user is returned.
+func optionalUser(req *http.Request) (*model.User, error) {
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized && req.Header.Get("Authorization") == "" {
+		return nil, nil
+	}
+	return user, err
+}
+
+// Find media that user may record progress on for the user with userid,
+// writing an error response and returning nil if there is none. Media the
+// user cannot see is not found. Progress recorded for another user must also
+// be allowed in the media's root for them.
+func progressMedia(resp http.ResponseWriter, req *http.Request, user *model.User, userid, mediaid string) *model.Media {
+	media, err := model.FindMedia(mediaid)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return nil
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return nil
+	}
+	access, err := newRootAccess(user)
+	if err != nil {
+		InternalError(resp, req, err)
+		return nil
+	}
+	if !access.canRead(media.Root) {
+		NotFound(resp, req)
+		return nil
+	}
+	if !access.canProgress(media.Root) {
+		Forbidden(resp, req)
+		return nil
+	}
+	if userid == user.Id {
+		return media
+	}
+	target, err := model.FindUser(userid)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req, "user not found")
+		return nil
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return nil
+	}
+	access, err = newRootAccess(target)
+	if err != nil {
+		InternalError(resp, req, err)
+		return nil
+	}
+	if !access.canProgress(media.Root) {
+		Forbidden(resp, req)
+		return nil
+	}
+	return media
+}
@@ -0,0 +1,141 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// access_test.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bmatsuo/mtrack/model"
+	"github.com/bmatsuo/mtrack/scan"
+)
+
+func TestRootAccess(t *testing.T) {
+	roots := map[string]*scan.Root{
+		"/media/public": {Name: "public", Path: "/media/public"},
+		"/media/kids":   {Name: "kids", Path: "/media/kids", ACL: scan.ACL{Read: []string{"role:kids"}}},
+	}
+	lookupRoot = func(path string) *scan.Root { return roots[path] }
+	configuredRoots = func() []*scan.Root { return []*scan.Root{roots["/media/public"], roots["/media/kids"]} }
+	defer func() {
+		lookupRoot = scan.LookupRoot
+		configuredRoots = scan.Roots
+	}()
+
+	anon := &rootAccess{grantees: map[string]bool{}}
+	kid := &rootAccess{grantees: map[string]bool{"role:kids": true}}
+	admin := &rootAccess{admin: true, grantees: map[string]bool{}}
+
+	for _, test := range []struct {
+		access *rootAccess
+		root   string
+		read   bool
+	}{
+		{anon, "/media/public", true},
+		{anon, "/media/kids", false},
+		{kid, "/media/kids", true},
+		{anon, "/media/removed", false},
+		{kid, "/media/removed", false},
+		{admin, "/media/kids", true},
+		{admin, "/media/removed", true},
+	} {
+		if test.access.canRead(test.root) != test.read {
+			t.Errorf("%v %s: read %v", test.access.grantees, test.root, !test.read)
+		}
+	}
+
+	if !anon.canReadNamed("public") || anon.canReadNamed("kids") || !kid.canReadNamed("kids") {
+		t.Errorf("roots by name")
+	}
+	if anon.canReadNamed("removed") || !admin.canReadNamed("removed") {
+		t.Errorf("removed root by name")
+	}
+
+	if r := anon.readableRoots(); !reflect.DeepEqual(r, []string{"/media/public"}) {
+		t.Errorf("anonymous roots: %v", r)
+	}
+	if r := kid.readableRoots(); len(r) != 2 {
+		t.Errorf("kid roots: %v", r)
+	}
+	if r := admin.readableRoots(); r != nil {
+		t.Errorf("admin roots: %v", r)
+	}
+}
+
+func TestProgressMedia(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtrack-http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	model.DBPath = filepath.Join(dir, "mtrack.sqlite")
+	err = model.DBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer model.DB.Close()
+
+	root := filepath.Join(dir, "media")
+	path := filepath.Join(root, "Firefly.S01E02.mkv")
+	err = os.MkdirAll(root, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(path, []byte("video"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaid, _, err := model.SyncMedia(root, path, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acl := scan.ACL{Read: []string{"user:alice", "user:bob"}, Progress: []string{"user:alice"}}
+	lookupRoot = func(path string) *scan.Root {
+		if path == root {
+			return &scan.Root{Name: "media", Path: root, ACL: acl}
+		}
+		return nil
+	}
+	defer func() { lookupRoot = scan.LookupRoot }()
+
+	alice, err := model.CreateLocalUser("alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := model.CreateLocalUser("bob", "battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	caller, err := model.FindUser(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		userid string
+		code   int
+	}{
+		{alice, 200},
+		{bob, 403},
+		{"nobody", 404},
+	} {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/progress", nil)
+		media := progressMedia(resp, req, caller, test.userid, mediaid)
+		if (media != nil) != (test.code == 200) || resp.Code != test.code {
+			t.Errorf("%s: %d %v", test.userid, resp.Code, media)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// events.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bmatsuo/mtrack/event"
+)
+
+// A comment is sent on idle event streams this often so proxies do not close
+// them.
+var EventKeepAlive = 30 * time.Second
+
+// the bus streamed by Events. replaced in tests.
+var eventBus = event.DefaultBus
+
+// Stream library and progress events to the caller as server-sent events.
+// Only events concerning roots the caller can see are sent. A client
+// reconnecting with a Last-Event-ID header first receives the retained events
+// it missed.
+func Events(resp http.ResponseWriter, req *http.Request) {
+	var lastid int64 = -1
+	if s := req.Header.Get("Last-Event-ID"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || id < 0 {
+			InvalidParameter(resp, req, "Last-Event-ID")
+			return
+		}
+		lastid = id
+	}
+
+	user, err := optionalUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	access, err := newRootAccess(user)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		InternalError(resp, req, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	var sub *event.Subscription
+	var missed []*event.Event
+	if lastid >= 0 {
+		sub, missed = eventBus.SubscribeSince(lastid)
+	} else {
+		sub = eventBus.Subscribe()
+	}
+	defer sub.Close()
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(e *event.Event) error {
+		if e.Root != "" && !access.canRead(e.Root) {
+			return nil
+		}
+		js, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(resp, "id: %d\nevent: %s\ndata: %s\n\n", e.Id, e.Type, js)
+		return err
+	}
+	for _, e := range missed {
+		err := send(e)
+		if err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(EventKeepAlive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				// the client fell behind and must reconnect to catch up.
+				return
+			}
+			err := send(e)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepalive.C:
+			_, err := fmt.Fprint(resp, ": keepalive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
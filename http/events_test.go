@@ -0,0 +1,70 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// events_test.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bmatsuo/mtrack/event"
+	"github.com/bmatsuo/mtrack/scan"
+)
+
+func TestEvents(t *testing.T) {
+	roots := map[string]*scan.Root{
+		"/media/public": {Path: "/media/public"},
+		"/media/kids":   {Path: "/media/kids", ACL: scan.ACL{Read: []string{"role:kids"}}},
+	}
+	lookupRoot = func(path string) *scan.Root { return roots[path] }
+	eventBus = event.NewBus(10)
+	defer func() {
+		lookupRoot = scan.LookupRoot
+		eventBus = event.DefaultBus
+	}()
+
+	eventBus.Publish(&event.Event{Type: event.MediaCreated, Root: "/media/public", MediaId: "a"})
+	eventBus.Publish(&event.Event{Type: event.MediaCreated, Root: "/media/kids", MediaId: "b"})
+	eventBus.Publish(&event.Event{Type: event.ScanFinished})
+
+	server := httptest.NewServer(http.HandlerFunc(Events))
+	defer server.Close()
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+
+	eventBus.Publish(&event.Event{Type: event.ProgressStarted, Root: "/media/kids", MediaId: "b"})
+	eventBus.Publish(&event.Event{Type: event.ProgressStarted, Root: "/media/public", MediaId: "a"})
+
+	// anonymous callers do not see events in the restricted root.
+	var ids []string
+	r := bufio.NewReader(resp.Body)
+	for len(ids) < 3 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%v after %v", err, ids)
+		}
+		if strings.HasPrefix(line, "id: ") {
+			ids = append(ids, strings.TrimSpace(line[4:]))
+		}
+	}
+	if strings.Join(ids, ",") != "1,3,5" {
+		t.Errorf("ids: %v", ids)
+	}
+}
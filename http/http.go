@@ -11,22 +11,62 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bitly/go-simplejson"
 	"github.com/bmatsuo/mtrack/http/jsonapi"
 	"github.com/bmatsuo/mtrack/model"
+	"github.com/bmatsuo/mtrack/player"
 	"github.com/gorilla/mux"
-	"github.com/sauerbraten/persona"
 )
 
 var ErrUnauthorized = fmt.Errorf("unauthorized")
+var ErrInsufficientScope = fmt.Errorf("access token does not grant the required scope")
 
+// The number of results returned by MediaSearch when no limit is given, and
+// the largest limit allowed.
+const (
+	SearchLimit    = 50
+	MaxSearchLimit = 500
+)
+
+// The scopes an access token needs for requests that change state, by route.
+// Other state-changing requests need model.ScopeAll and safe requests need
+// model.ScopeRead.
+var routeScopes = map[string]model.Scope{
+	"/api/start":                 model.ScopeProgressWrite,
+	"/api/finish":                model.ScopeProgressWrite,
+	"/api/clear":                 model.ScopeProgressWrite,
+	"/api/progress/position":     model.ScopeProgressWrite,
+	"/api/scrobble":              model.ScopeProgressWrite,
+	"/api/media/{id}/stream_url": model.ScopeRead,
+}
+
+func requiredScope(req *http.Request) model.Scope {
+	if safeMethod(req.Method) {
+		return model.ScopeRead
+	}
+	path := req.URL.Path
+	if route := mux.CurrentRoute(req); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			path = tmpl
+		}
+	}
+	if scope, ok := routeScopes[path]; ok {
+		return scope
+	}
+	return model.ScopeAll
+}
+
+// Authorize a request using an access token in its Authorization header or,
+// without one, its session cookie. ErrInsufficientScope is returned if the
+// token's scopes do not allow the request.
 func AuthorizeUser(req *http.Request) (*model.User, error) {
 	auth := req.Header.Get("Authorization")
 	if len(auth) == 0 {
-		return nil, ErrUnauthorized
+		return authorizeSession(req)
 	}
 	auth = strings.Trim(auth, " ")
 	pieces := strings.Fields(auth)
@@ -37,7 +77,17 @@ func AuthorizeUser(req *http.Request) (*model.User, error) {
 	if strings.ToLower(authType) != "token" {
 		return nil, fmt.Errorf("invalid authorization type")
 	}
-	return model.FindUserByAccessToken(token)
+	at, err := model.FindAccessToken(token)
+	if err == sql.ErrNoRows || err == model.ErrTokenExpired {
+		return nil, ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !at.HasScope(requiredScope(req)) {
+		return nil, ErrInsufficientScope
+	}
+	return model.FindUser(at.UserId)
 }
 
 type MissingParameterError string
@@ -60,25 +110,45 @@ func (err InvalidParameterError) Error() string {
 }
 
 func StringParameter(js *simplejson.Json, path ...string) (string, error) {
+	js, err := lookupParameter(js, path...)
+	if err != nil {
+		return "", err
+	}
+	str, err := js.String()
+	if err != nil {
+		return "", InvalidParameterError(strings.Join(path, "."))
+	}
+	return str, nil
+}
+
+func FloatParameter(js *simplejson.Json, path ...string) (float64, error) {
+	js, err := lookupParameter(js, path...)
+	if err != nil {
+		return 0, err
+	}
+	x, err := js.Float64()
+	if err != nil {
+		return 0, InvalidParameterError(strings.Join(path, "."))
+	}
+	return x, nil
+}
+
+func lookupParameter(js *simplejson.Json, path ...string) (*simplejson.Json, error) {
 	// simplejson's api makes this kind of misleading in some situations
 	present := false
 	if len(path) > 1 {
 		js = js.GetPath(path[:len(path)-1]...)
 		js, present = js.CheckGet(path[len(path)-1])
 		if !present {
-			return "", MissingParameterError(strings.Join(path, "."))
+			return nil, MissingParameterError(strings.Join(path, "."))
 		}
 	} else {
 		js, present = js.CheckGet(path[0])
 		if !present {
-			return "", MissingParameterError(strings.Join(path, "."))
+			return nil, MissingParameterError(strings.Join(path, "."))
 		}
 	}
-	str, err := js.String()
-	if err != nil {
-		return "", InvalidParameterError(strings.Join(path, "."))
-	}
-	return str, nil
+	return js, nil
 }
 
 func HTTPLog(req *http.Request, v ...interface{}) {
@@ -90,98 +160,146 @@ var HTTPConfig struct {
 	StaticPath string
 }
 
+// The players Start and Open launch on the server. Nothing is launched
+// until they are configured.
+var MediaPlayers = &player.Players{Default: player.None{}}
+
 func HTTPStart() error {
+	err := initStreamSecret()
+	if err != nil {
+		return err
+	}
+	err = initOIDC()
+	if err != nil {
+		return err
+	}
+
 	router := mux.NewRouter()
 	router.NotFoundHandler = FileServer()
-	router.Methods("POST").Path("/api/persona/verify").HandlerFunc(VerifyPersona)
+	router.Methods("POST").Path("/api/login").HandlerFunc(Login)
+	router.Methods("POST").Path("/api/logout").HandlerFunc(Logout)
+	router.Methods("POST").Path("/api/register").HandlerFunc(Register)
+	router.Methods("GET").Path("/api/session").HandlerFunc(SessionShow)
+	router.Methods("GET").Path("/api/auth/providers").HandlerFunc(AuthProviders)
+	router.Methods("GET").Path("/api/oidc/login").HandlerFunc(OIDCLogin)
+	router.Methods("GET").Path("/api/oidc/callback").HandlerFunc(OIDCCallback)
+	router.Methods("GET").Path("/api/tokens").HandlerFunc(TokenIndex)
+	router.Methods("POST").Path("/api/tokens").HandlerFunc(TokenCreate)
+	router.Methods("DELETE").Path("/api/tokens/{id}").HandlerFunc(TokenRevoke)
 	router.Methods("POST").Path("/api/open").HandlerFunc(Open)
 	router.Methods("GET").Path("/api/media").HandlerFunc(MediaIndex)
 	router.Methods("GET").Path("/api/media/progress").HandlerFunc(ProgressIndex)
+	router.Methods("GET").Path("/api/media/search").HandlerFunc(MediaSearch)
+	router.Methods("GET", "HEAD").Path("/api/media/{id}/stream").HandlerFunc(MediaStream)
+	router.Methods("POST").Path("/api/media/{id}/stream_url").HandlerFunc(MediaStreamURL)
+	router.Methods("GET").Path("/api/me/media").HandlerFunc(MeMediaIndex)
+	router.Methods("GET").Path("/api/me/in_progress").HandlerFunc(MeInProgressIndex)
+	router.Methods("GET").Path("/api/me/finished").HandlerFunc(MeFinishedIndex)
 	router.Methods("POST").Path("/api/start").HandlerFunc(Start)
 	router.Methods("POST").Path("/api/clear").HandlerFunc(Clear)
 	router.Methods("GET").Path("/api/in_progress").HandlerFunc(InProgressIndex)
 	router.Methods("POST").Path("/api/finish").HandlerFunc(Finish)
+	router.Methods("POST").Path("/api/progress/position").HandlerFunc(Position)
 	router.Methods("GET").Path("/api/finished").HandlerFunc(FinishedIndex)
+	router.Methods("POST").Path("/api/scrobble").HandlerFunc(Scrobble)
+	router.Methods("GET").Path("/api/users").HandlerFunc(UserIndex)
+	router.Methods("POST").Path("/api/users").HandlerFunc(UserCreate)
+	router.Methods("GET").Path("/api/users/{id}").HandlerFunc(UserShow)
+	router.Methods("PATCH").Path("/api/users/{id}").HandlerFunc(UserUpdate)
+	router.Methods("DELETE").Path("/api/users/{id}").HandlerFunc(UserDelete)
+	router.Methods("PUT", "DELETE").Path("/api/users/{id}/permissions/{perm}").HandlerFunc(UserPermission)
+	router.Methods("PUT", "DELETE").Path("/api/users/{id}/roles/{role}").HandlerFunc(UserRole)
+	router.Methods("GET").Path("/api/roles").HandlerFunc(RoleIndex)
+	router.Methods("PUT").Path("/api/roles/{name}").HandlerFunc(RoleSave)
+	router.Methods("DELETE").Path("/api/roles/{name}").HandlerFunc(RoleDelete)
+	router.Methods("GET").Path("/api/webhooks").HandlerFunc(WebhookIndex)
+	router.Methods("POST").Path("/api/webhooks").HandlerFunc(WebhookCreate)
+	router.Methods("GET").Path("/api/webhooks/{id}").HandlerFunc(WebhookShow)
+	router.Methods("DELETE").Path("/api/webhooks/{id}").HandlerFunc(WebhookDelete)
+	router.Methods("GET").Path("/api/webhooks/{id}/deliveries").HandlerFunc(WebhookDeliveryIndex)
+	router.Methods("POST").Path("/api/webhooks/{id}/deliveries/{delivery:[0-9]+}/retry").HandlerFunc(WebhookDeliveryRetry)
+	router.Methods("GET").Path("/api/users/{id}/up_next").HandlerFunc(UpNextIndex)
+	router.Methods("GET").Path("/api/users/{id}/history").HandlerFunc(HistoryIndex)
+	router.Methods("GET").Path("/api/users/{id}/history/stats").HandlerFunc(HistoryStats)
+	router.Methods("GET").Path("/api/series").HandlerFunc(SeriesIndex)
+	router.Methods("GET").Path("/api/series/{id}").HandlerFunc(SeriesShow)
+	router.Methods("GET").Path("/api/series/{id}/seasons/{season:[0-9]+}").HandlerFunc(SeasonShow)
+	router.Methods("GET").Path("/api/scan/status").HandlerFunc(ScanStatus)
+	router.Methods("GET").Path("/api/events").HandlerFunc(Events)
+	router.Methods("POST").Path("/api/scan").HandlerFunc(ScanTrigger)
+	router.Methods("GET").Path("/api/scan/jobs/{id}").HandlerFunc(ScanJobShow)
 
 	log.Printf("Serving HTTP on at %v", HTTPConfig.Addr)
 	return http.ListenAndServe(HTTPConfig.Addr, router)
 }
 
-var PersonaAudience = "http://localhost:7890"
-
-func VerifyPersona(resp http.ResponseWriter, req *http.Request) {
-	// TODO some kind of csrf protection
-
+// Open media with MediaPlayers without recording progress. The caller must
+// be able to see the media.
+func Open(resp http.ResponseWriter, req *http.Request) {
 	params, err := jsonapi.Read(req)
 	if err == jsonapi.ErrNotJson {
 		NotJson(resp, req)
 		return
 	}
-	assertion, err := params.Get("assertion").String()
 	if err != nil {
-		jsonapi.Error(resp, 400, "invalid assertion")
+		InvalidJson(resp, req, err)
 		return
 	}
 
-	presp, err := persona.VerifyAssertion(PersonaAudience, assertion)
-	if err != nil {
-		InternalError(resp, req, err)
+	mediaid, err := StringParameter(params, "mediaId")
+	switch err.(type) {
+	case MissingParameterError:
+		MissingParameter(resp, req, "mediaId")
 		return
-	}
-	if !presp.OK() {
-		// maybe this should be a different error. but i may need the logs.
-		InternalError(resp, req, presp.Reason)
+	case InvalidParameterError:
+		InvalidParameter(resp, req, "mediaId")
 		return
 	}
 
-	// return an access token
-	userid, err := model.LocateOrCreateUserByEmail(presp.Email)
-	if err != nil {
-		InternalError(resp, req, presp.Reason)
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
 		return
 	}
-
-	// XXX i'm not doing anything to limit the creation of access tokens!
-	accessToken, err := model.CreateAccessTokenForUser(userid)
 	if err != nil {
-		InternalError(resp, req, presp.Reason)
+		BadAuthorization(resp, req)
 		return
 	}
 
-	jsonapi.Success(resp, jsonapi.Map{
-		"accessToken": accessToken,
-		"email":       presp.Email,
-		"userId":      userid,
-	})
-}
-
-func Open(resp http.ResponseWriter, req *http.Request) {
-	params, err := jsonapi.Read(req)
-	if err == jsonapi.ErrNotJson {
-		NotJson(resp, req)
+	media, err := model.FindMedia(mediaid)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
 		return
 	}
-	mediaid, err := params.Get("mediaId").String()
 	if err != nil {
-		jsonapi.Error(resp, 400, "invalid mediaId")
-		return
-	}
-	var path string
-	row := model.DB.QueryRow(`SELECT Path FROM Media WHERE MediaId = ?`, mediaid)
-	err = row.Scan(&path)
-	if err != sql.ErrNoRows {
-		jsonapi.Error(resp, 404, "not found")
+		InternalError(resp, req, err)
 		return
 	}
+	access, err := newRootAccess(user)
 	if err != nil {
 		InternalError(resp, req, err)
 		return
 	}
-	err = exec.Command("open", "http://google.com").Run()
+	if !access.canRead(media.Root) {
+		NotFound(resp, req)
+		return
+	}
+
+	playback, err := MediaPlayers.For(media).Launch(&player.Request{
+		Path:    media.Path,
+		MediaId: media.Id,
+		UserId:  user.Id,
+		Root:    media.Root,
+	})
 	if err != nil {
 		InternalError(resp, req, err)
 		return
 	}
+	player.Release(playback)
 	jsonapi.Success(resp, nil)
 }
 
@@ -221,6 +339,10 @@ func Clear(resp http.ResponseWriter, req *http.Request) {
 		Unauthorized(resp, req)
 		return
 	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
 	if err != nil {
 		BadAuthorization(resp, req)
 		return
@@ -237,6 +359,10 @@ func Clear(resp http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	if progressMedia(resp, req, user, userid, mediaid) == nil {
+		return
+	}
+
 	err = model.ClearProgress(userid, mediaid)
 	if err == model.ErrAlreadyStarted {
 		jsonapi.Error(resp, 400, err)
@@ -250,6 +376,10 @@ func Clear(resp http.ResponseWriter, req *http.Request) {
 	jsonapi.Success(resp, nil)
 }
 
+// Play media with MediaPlayers and start it for a user. Media the user has
+// started resumes from its last recorded position, which is returned. The
+// position is recorded while the player runs and the media is finished once
+// the player passes model.FinishThreshold.
 func Start(resp http.ResponseWriter, req *http.Request) {
 	params, err := jsonapi.Read(req)
 	if err == jsonapi.ErrNotJson {
@@ -286,6 +416,10 @@ func Start(resp http.ResponseWriter, req *http.Request) {
 		Unauthorized(resp, req)
 		return
 	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
 	if err != nil {
 		BadAuthorization(resp, req)
 		return
@@ -302,33 +436,39 @@ func Start(resp http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	media, err := model.FindMedia(mediaid)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			NotFound(resp, req)
-		} else {
-			InternalError(resp, req, err)
-		}
+	media := progressMedia(resp, req, user, userid, mediaid)
+	if media == nil {
 		return
 	}
 
-	err = exec.Command("open", media.Path).Run()
+	position, err := model.FindPosition(userid, mediaid)
 	if err != nil {
 		InternalError(resp, req, err)
 		return
 	}
-
-	err = model.StartMedia(userid, mediaid)
-	if err == model.ErrAlreadyStarted {
-		jsonapi.Error(resp, 400, err)
+	playback, err := MediaPlayers.For(media).Launch(&player.Request{
+		Path:    media.Path,
+		MediaId: media.Id,
+		UserId:  userid,
+		Root:    media.Root,
+		Start:   position,
+	})
+	if err != nil {
+		InternalError(resp, req, err)
 		return
 	}
-	if err != nil {
+
+	err = model.StartMedia(userid, mediaid)
+	if err != nil && err != model.ErrAlreadyStarted {
+		playback.Close()
 		InternalError(resp, req, err)
 		return
 	}
+	go player.Track(playback, userid, media)
 
-	jsonapi.Success(resp, nil)
+	jsonapi.Success(resp, jsonapi.Map{
+		"position": position,
+	})
 }
 
 func Finish(resp http.ResponseWriter, req *http.Request) {
@@ -368,6 +508,10 @@ func Finish(resp http.ResponseWriter, req *http.Request) {
 		Unauthorized(resp, req)
 		return
 	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
 	if err != nil {
 		BadAuthorization(resp, req)
 		return
@@ -384,6 +528,10 @@ func Finish(resp http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	if progressMedia(resp, req, user, userid, mediaid) == nil {
+		return
+	}
+
 	err = model.FinishMedia(userid, mediaid)
 	if err == model.ErrAlreadyFinished {
 		jsonapi.Error(resp, 400, err)
@@ -397,8 +545,182 @@ func Finish(resp http.ResponseWriter, req *http.Request) {
 	jsonapi.Success(resp, nil)
 }
 
+// Record a user's playback position in seconds. Clients should send the
+// position periodically while media plays. The response indicates whether the
+// media has been finished as a result.
+func Position(resp http.ResponseWriter, req *http.Request) {
+	params, err := jsonapi.Read(req)
+	if err == jsonapi.ErrNotJson {
+		NotJson(resp, req)
+		return
+	}
+	if err != nil {
+		InvalidJson(resp, req, err)
+		return
+	}
+
+	mediaid, err := StringParameter(params, "mediaId")
+	switch err.(type) {
+	case MissingParameterError:
+		MissingParameter(resp, req, "mediaId")
+		return
+	case InvalidParameterError:
+		InvalidParameter(resp, req, "mediaId")
+		return
+	}
+
+	userid, err := StringParameter(params, "userId")
+	switch err.(type) {
+	case MissingParameterError:
+		MissingParameter(resp, req, "userId")
+		return
+	case InvalidParameterError:
+		InvalidParameter(resp, req, "userId")
+		return
+	}
+
+	position, err := FloatParameter(params, "position")
+	switch err.(type) {
+	case MissingParameterError:
+		MissingParameter(resp, req, "position")
+		return
+	case InvalidParameterError:
+		InvalidParameter(resp, req, "position")
+		return
+	}
+	if position < 0 {
+		InvalidParameter(resp, req, "position")
+		return
+	}
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	if user.Id != userid {
+		ok, err := model.UserHasPermission(user.Id, model.PermUserProgressUpdate)
+		if err != nil {
+			InternalError(resp, req, err)
+			return
+		}
+		if !ok {
+			Forbidden(resp, req)
+			return
+		}
+	}
+
+	if progressMedia(resp, req, user, userid, mediaid) == nil {
+		return
+	}
+
+	finished, err := model.UpdatePosition(userid, mediaid, position)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+
+	jsonapi.Success(resp, jsonapi.Map{
+		"position": position,
+		"finished": finished,
+	})
+}
+
+// Media in the roots the caller may see. Anonymous callers only see roots
+// without an ACL. Results are paged, filtered and sorted according to the
+// query parameters read by listOptions.
 func MediaIndex(resp http.ResponseWriter, req *http.Request) {
-	results, err := model.AllMedia()
+	user, err := optionalUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	access, err := newRootAccess(user)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+
+	opt := listOptions(resp, req, user, access)
+	if opt == nil {
+		return
+	}
+	media, next, err := model.ListMedia(opt)
+	if err != nil {
+		listError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, page(media, next))
+}
+
+// Search the media in the roots the caller may see. The query parameter "q"
+// holds the words to search for and "limit" limits the number of results.
+// Builds without FTS5 cannot search and respond 501.
+func MediaSearch(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	q := query.Get("q")
+	if strings.TrimSpace(q) == "" {
+		MissingParameter(resp, req, "q")
+		return
+	}
+	limit := SearchLimit
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > MaxSearchLimit {
+			InvalidParameter(resp, req, "limit")
+			return
+		}
+		limit = n
+	}
+
+	user, err := optionalUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	access, err := newRootAccess(user)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+
+	results, err := model.SearchMedia(q, limit, access.readableRoots())
+	if err == model.ErrEmptySearch {
+		InvalidParameter(resp, req, "q")
+		return
+	}
+	if err == model.ErrNoFTS5 {
+		jsonapi.Error(resp, 501, err)
+		return
+	}
 	if err != nil {
 		InternalError(resp, req, err)
 		return
@@ -408,24 +730,167 @@ func MediaIndex(resp http.ResponseWriter, req *http.Request) {
 	})
 }
 
+// Progress on media in the roots the caller may see, paged like MediaIndex.
 func ProgressIndex(resp http.ResponseWriter, req *http.Request) {
-	inprogress, err := model.AllInProgress()
+	user, err := optionalUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	access, err := newRootAccess(user)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+
+	opt := listOptions(resp, req, user, access)
+	if opt == nil {
+		return
+	}
+	progress, next, err := model.ListProgress(opt)
+	if err != nil {
+		listError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, page(progress, next))
+}
+
+// Started media in the roots the caller may see, paged like MediaIndex.
+func InProgressIndex(resp http.ResponseWriter, req *http.Request) {
+	user, err := optionalUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	access, err := newRootAccess(user)
 	if err != nil {
 		InternalError(resp, req, err)
 		return
 	}
-	finished, err := model.AllFinished()
+
+	opt := listOptions(resp, req, user, access)
+	if opt == nil {
+		return
+	}
+	inprogress, next, err := model.ListInProgress(opt)
+	if err != nil {
+		listError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, page(inprogress, next))
+}
+
+// Finished media in the roots the caller may see, paged like MediaIndex.
+func FinishedIndex(resp http.ResponseWriter, req *http.Request) {
+	user, err := optionalUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	access, err := newRootAccess(user)
 	if err != nil {
 		InternalError(resp, req, err)
 		return
 	}
 
-	results := make([]interface{}, 0, len(inprogress)+len(finished))
-	for i := range inprogress {
-		results = append(results, inprogress[i])
+	opt := listOptions(resp, req, user, access)
+	if opt == nil {
+		return
+	}
+	finished, next, err := model.ListFinished(opt)
+	if err != nil {
+		listError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, page(finished, next))
+}
+
+// The next item to watch in each series or directory the user has started,
+// in the roots the user can read. Users may only see their own list without
+// the USER_READ permission.
+func UpNextIndex(resp http.ResponseWriter, req *http.Request) {
+	userid := mux.Vars(req)["id"]
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	if user.Id != userid {
+		ok, err := model.UserHasAnyPermission(user.Id, model.PermUserRead, model.PermAdmin)
+		if err != nil {
+			InternalError(resp, req, err)
+			return
+		}
+		if !ok {
+			Forbidden(resp, req)
+			return
+		}
+	}
+
+	// the list leaves out roots its user can no longer read, and the caller
+	// cannot see items in roots hidden from them.
+	target, err := model.FindUser(userid)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	targetAccess, err := newRootAccess(target)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	access, err := newRootAccess(user)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	items, err := model.UpNext(userid, targetAccess.readableRoots())
+	if err != nil {
+		InternalError(resp, req, err)
+		return
 	}
-	for i := range finished {
-		results = append(results, finished[i])
+	results := make([]*model.UpNextItem, 0, len(items))
+	for _, item := range items {
+		if access.canRead(item.Media.Root) {
+			results = append(results, item)
+		}
 	}
 
 	jsonapi.Success(resp, jsonapi.Map{
@@ -433,8 +898,63 @@ func ProgressIndex(resp http.ResponseWriter, req *http.Request) {
 	})
 }
 
-func InProgressIndex(resp http.ResponseWriter, req *http.Request) {
-	results, err := model.AllInProgress()
+// A user's watch history, most recent first. The optional query parameters
+// "since" and "until" (RFC 3339 timestamps) limit the time range and "limit"
+// limits the number of events returned.
+func HistoryIndex(resp http.ResponseWriter, req *http.Request) {
+	userid := mux.Vars(req)["id"]
+	query := req.URL.Query()
+	var since, until time.Time
+	var limit int
+	var err error
+	if s := query.Get("since"); s != "" {
+		since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			InvalidParameter(resp, req, "since")
+			return
+		}
+	}
+	if s := query.Get("until"); s != "" {
+		until, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			InvalidParameter(resp, req, "until")
+			return
+		}
+	}
+	if s := query.Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 0 {
+			InvalidParameter(resp, req, "limit")
+			return
+		}
+	}
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	if user.Id != userid {
+		ok, err := model.UserHasAnyPermission(user.Id, model.PermUserRead, model.PermAdmin)
+		if err != nil {
+			InternalError(resp, req, err)
+			return
+		}
+		if !ok {
+			Forbidden(resp, req)
+			return
+		}
+	}
+
+	results, err := model.UserHistory(userid, since, until, limit)
 	if err != nil {
 		InternalError(resp, req, err)
 		return
@@ -445,8 +965,37 @@ func InProgressIndex(resp http.ResponseWriter, req *http.Request) {
 	})
 }
 
-func FinishedIndex(resp http.ResponseWriter, req *http.Request) {
-	results, err := model.AllFinished()
+// Watch counts and first and last watched times for each media file a user
+// has finished.
+func HistoryStats(resp http.ResponseWriter, req *http.Request) {
+	userid := mux.Vars(req)["id"]
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	if user.Id != userid {
+		ok, err := model.UserHasAnyPermission(user.Id, model.PermUserRead, model.PermAdmin)
+		if err != nil {
+			InternalError(resp, req, err)
+			return
+		}
+		if !ok {
+			Forbidden(resp, req)
+			return
+		}
+	}
+
+	results, err := model.UserWatchStats(userid)
 	if err != nil {
 		InternalError(resp, req, err)
 		return
@@ -0,0 +1,94 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// list.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bmatsuo/mtrack/http/jsonapi"
+	"github.com/bmatsuo/mtrack/model"
+)
+
+// Read the filters, sort order and page of a listing from the query
+// parameters of req, restricted to the roots the caller can read. A watch
+// status without a user refers to the caller. If a parameter is invalid an
+// error response is written and nil is returned.
+func listOptions(resp http.ResponseWriter, req *http.Request, user *model.User, access *rootAccess) *model.ListOptions {
+	query := req.URL.Query()
+	opt := &model.ListOptions{
+		Roots:  access.readableRoots(),
+		Root:   query.Get("root"),
+		UserId: query.Get("user"),
+		Sort:   query.Get("sort"),
+		Cursor: query.Get("cursor"),
+	}
+	var err error
+	if s := query.Get("status"); s != "" {
+		opt.Status, err = model.ParseWatchStatus(s)
+		if err != nil {
+			InvalidParameter(resp, req, "status")
+			return nil
+		}
+		if opt.UserId == "" && user != nil {
+			opt.UserId = user.Id
+		}
+		if opt.UserId == "" {
+			MissingParameter(resp, req, "user")
+			return nil
+		}
+	}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{
+		{"modifiedSince", &opt.ModifiedSince},
+		{"modifiedUntil", &opt.ModifiedUntil},
+		{"createdSince", &opt.CreatedSince},
+		{"createdUntil", &opt.CreatedUntil},
+	} {
+		if s := query.Get(p.name); s != "" {
+			*p.t, err = time.Parse(time.RFC3339, s)
+			if err != nil {
+				InvalidParameter(resp, req, p.name)
+				return nil
+			}
+		}
+	}
+	if s := query.Get("limit"); s != "" {
+		opt.Limit, err = strconv.Atoi(s)
+		if err != nil || opt.Limit <= 0 || opt.Limit > model.MaxPageSize {
+			InvalidParameter(resp, req, "limit")
+			return nil
+		}
+	}
+	return opt
+}
+
+// Write the response for an error returned listing with invalid options.
+func listError(resp http.ResponseWriter, req *http.Request, err error) {
+	switch err {
+	case model.ErrInvalidSort:
+		InvalidParameter(resp, req, "sort")
+	case model.ErrInvalidCursor:
+		InvalidParameter(resp, req, "cursor")
+	case model.ErrInvalidStatus:
+		InvalidParameter(resp, req, "status")
+	default:
+		InternalError(resp, req, err)
+	}
+}
+
+// A page of results. The next cursor is omitted from the last page.
+func page(results interface{}, next string) jsonapi.Map {
+	m := jsonapi.Map{"results": results}
+	if next != "" {
+		m["next"] = next
+	}
+	return m
+}
@@ -0,0 +1,73 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// me.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"net/http"
+
+	"github.com/bmatsuo/mtrack/http/jsonapi"
+	"github.com/bmatsuo/mtrack/model"
+)
+
+// Media in the roots the caller may see, each annotated with the caller's
+// watch status, position and the time they last watched it. Results are
+// paged like MediaIndex.
+func MeMediaIndex(resp http.ResponseWriter, req *http.Request) {
+	meMedia(resp, req, "")
+}
+
+// The media the caller has started, most recently watched first unless
+// another sort is given.
+func MeInProgressIndex(resp http.ResponseWriter, req *http.Request) {
+	meMedia(resp, req, model.StatusInProgress)
+}
+
+// The media the caller has finished, most recently watched first unless
+// another sort is given.
+func MeFinishedIndex(resp http.ResponseWriter, req *http.Request) {
+	meMedia(resp, req, model.StatusFinished)
+}
+
+// list the caller's media, restricted to the given status if it is not
+// empty.
+func meMedia(resp http.ResponseWriter, req *http.Request, status model.WatchStatus) {
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	access, err := newRootAccess(user)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+
+	opt := listOptions(resp, req, user, access)
+	if opt == nil {
+		return
+	}
+	if status != "" {
+		opt.Status = status
+		if opt.Sort == "" {
+			opt.Sort = "-watched"
+		}
+	}
+	media, next, err := model.ListUserMedia(user.Id, opt)
+	if err != nil {
+		listError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, page(media, next))
+}
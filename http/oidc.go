@@ -0,0 +1,505 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// oidc.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmatsuo/mtrack/http/jsonapi"
+	"github.com/bmatsuo/mtrack/model"
+)
+
+var ErrOIDCState = errors.New("unknown or expired login state")
+var ErrIDToken = errors.New("invalid id token")
+var ErrOIDCEmailUnverified = errors.New("provider did not verify the email address")
+
+// The cookie binding an OIDC login to the browser that started it.
+const OIDCStateCookie = "mtrack_oidc_state"
+
+// The time a user has to complete a login with the provider.
+var OIDCLoginTTL = 10 * time.Minute
+
+// Tolerated clock difference with the provider when checking token times.
+var OIDCClockSkew = time.Minute
+
+// Settings for an OpenID Connect provider.
+type OIDCConfig struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string   // optional for public clients
+	RedirectURL  string   // the absolute url of /api/oidc/callback
+	Scopes       []string // requested with "openid", defaults to "email"
+
+	// Accept an email address from a provider that omits the email_verified
+	// claim. Only enable this for providers that verify every address.
+	TrustUnverifiedEmail bool
+}
+
+// OIDC login is enabled when OIDCSettings.Issuer is set when the server
+// starts.
+var OIDCSettings OIDCConfig
+
+// The provider discovered from OIDCSettings, nil when OIDC is disabled.
+var OIDC *OIDCProvider
+
+func initOIDC() error {
+	if OIDCSettings.Issuer == "" {
+		return nil
+	}
+	var err error
+	OIDC, err = NewOIDCProvider(OIDCSettings)
+	return err
+}
+
+// An OpenID Connect provider, used for the authorization code flow with PKCE.
+type OIDCProvider struct {
+	Config                OIDCConfig
+	AuthorizationEndpoint string
+	TokenEndpoint         string
+	JWKSURI               string
+	Client                *http.Client
+
+	basicAuth bool // authenticate to the token endpoint with client_secret_basic
+
+	mut    sync.Mutex
+	keys   map[string]*rsa.PublicKey
+	logins map[string]*oidcLogin
+}
+
+// a login started with AuthURL and not yet exchanged.
+type oidcLogin struct {
+	verifier string
+	nonce    string
+	expires  time.Time
+}
+
+// The verified claims of an ID token.
+type IDClaims struct {
+	Issuer          string       `json:"iss"`
+	Subject         string       `json:"sub"`
+	Audience        oidcAudience `json:"aud"`
+	AuthorizedParty string       `json:"azp"`
+	Expires         int64        `json:"exp"`
+	IssuedAt        int64        `json:"iat"`
+	Nonce           string       `json:"nonce"`
+	Email           string       `json:"email"`
+	EmailVerified   *bool        `json:"email_verified"`
+}
+
+// whether the email claim names a verified address. trustMissing accepts
+// addresses without an email_verified claim.
+func (claims *IDClaims) emailVerified(trustMissing bool) bool {
+	if claims.Email == "" {
+		return false
+	}
+	if claims.EmailVerified == nil {
+		return trustMissing
+	}
+	return *claims.EmailVerified
+}
+
+// the aud claim is either a string or an array of strings.
+type oidcAudience []string
+
+func (aud *oidcAudience) UnmarshalJSON(p []byte) error {
+	var s string
+	if json.Unmarshal(p, &s) == nil {
+		*aud = oidcAudience{s}
+		return nil
+	}
+	var ss []string
+	err := json.Unmarshal(p, &ss)
+	if err != nil {
+		return err
+	}
+	*aud = ss
+	return nil
+}
+
+func (aud oidcAudience) contains(s string) bool {
+	for i := range aud {
+		if aud[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Create a provider using the issuer's discovery document.
+func NewOIDCProvider(config OIDCConfig) (*OIDCProvider, error) {
+	p := &OIDCProvider{
+		Config: config,
+		Client: &http.Client{Timeout: 30 * time.Second},
+		keys:   make(map[string]*rsa.PublicKey),
+		logins: make(map[string]*oidcLogin),
+	}
+	var doc struct {
+		Issuer                string   `json:"issuer"`
+		AuthorizationEndpoint string   `json:"authorization_endpoint"`
+		TokenEndpoint         string   `json:"token_endpoint"`
+		JWKSURI               string   `json:"jwks_uri"`
+		AuthMethods           []string `json:"token_endpoint_auth_methods_supported"`
+	}
+	discovery := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	err := p.getJSON(discovery, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %v", err)
+	}
+	if doc.Issuer != config.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", doc.Issuer, config.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery: incomplete provider metadata")
+	}
+	p.AuthorizationEndpoint = doc.AuthorizationEndpoint
+	p.TokenEndpoint = doc.TokenEndpoint
+	p.JWKSURI = doc.JWKSURI
+
+	// client_secret_basic is the default when the provider does not say.
+	p.basicAuth = len(doc.AuthMethods) == 0
+	for _, method := range doc.AuthMethods {
+		if method == "client_secret_basic" {
+			p.basicAuth = true
+		}
+	}
+	return p, nil
+}
+
+func (p *OIDCProvider) getJSON(url string, v interface{}) error {
+	resp, err := p.Client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s: http status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func randomURLString(n int) (string, error) {
+	p := make([]byte, n)
+	_, err := rand.Read(p)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(p), nil
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Start a login, returning the provider url the user must visit and the state
+// identifying the login when they are redirected back.
+func (p *OIDCProvider) AuthURL() (authurl, state string, err error) {
+	login := &oidcLogin{expires: time.Now().Add(OIDCLoginTTL)}
+	state, err = randomURLString(32)
+	if err != nil {
+		return "", "", err
+	}
+	login.verifier, err = randomURLString(32)
+	if err != nil {
+		return "", "", err
+	}
+	login.nonce, err = randomURLString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	p.mut.Lock()
+	now := time.Now()
+	for s, l := range p.logins {
+		if now.After(l.expires) {
+			delete(p.logins, s)
+		}
+	}
+	p.logins[state] = login
+	p.mut.Unlock()
+
+	scopes := p.Config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email"}
+	}
+	q := make(url.Values)
+	q.Set("response_type", "code")
+	q.Set("client_id", p.Config.ClientId)
+	q.Set("redirect_uri", p.Config.RedirectURL)
+	q.Set("scope", "openid "+strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", login.nonce)
+	q.Set("code_challenge", pkceChallenge(login.verifier))
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + q.Encode(), state, nil
+}
+
+// Complete the login identified by state, exchanging the authorization code
+// for an ID token and verifying it. Each state can only be exchanged once.
+func (p *OIDCProvider) Exchange(state, code string) (*IDClaims, error) {
+	p.mut.Lock()
+	login := p.logins[state]
+	delete(p.logins, state)
+	p.mut.Unlock()
+	if login == nil || time.Now().After(login.expires) {
+		return nil, ErrOIDCState
+	}
+
+	form := make(url.Values)
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.Config.RedirectURL)
+	form.Set("code_verifier", login.verifier)
+	form.Set("client_id", p.Config.ClientId)
+	if p.Config.ClientSecret != "" && !p.basicAuth {
+		form.Set("client_secret", p.Config.ClientSecret)
+	}
+	req, err := http.NewRequest("POST", p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.Config.ClientSecret != "" && p.basicAuth {
+		req.SetBasicAuth(url.QueryEscape(p.Config.ClientId), url.QueryEscape(p.Config.ClientSecret))
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token)
+	if err != nil {
+		return nil, fmt.Errorf("token response: %v", err)
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("token response: %s %s", token.Error, token.ErrorDescription)
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("token response: http status %d", resp.StatusCode)
+	}
+	return p.verifyIDToken(token.IDToken, login.nonce)
+}
+
+// verify the signature and claims of a compact serialized RS256 ID token.
+func (p *OIDCProvider) verifyIDToken(raw, nonce string) (*IDClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrIDToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeJWTPart(parts[0], &header)
+	if err != nil {
+		return nil, ErrIDToken
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("id token: unsupported algorithm %q", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrIDToken
+	}
+	key, err := p.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig)
+	if err != nil {
+		return nil, ErrIDToken
+	}
+
+	claims := new(IDClaims)
+	err = decodeJWTPart(parts[1], claims)
+	if err != nil {
+		return nil, ErrIDToken
+	}
+	now := time.Now()
+	switch {
+	case claims.Issuer != p.Config.Issuer:
+		return nil, fmt.Errorf("id token: unexpected issuer %q", claims.Issuer)
+	case !claims.Audience.contains(p.Config.ClientId):
+		return nil, fmt.Errorf("id token: not issued for this client")
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.Config.ClientId:
+		return nil, fmt.Errorf("id token: not issued for this client")
+	case now.Add(-OIDCClockSkew).After(time.Unix(claims.Expires, 0)):
+		return nil, fmt.Errorf("id token: expired")
+	case now.Add(OIDCClockSkew).Before(time.Unix(claims.IssuedAt, 0)):
+		return nil, fmt.Errorf("id token: issued in the future")
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("id token: nonce mismatch")
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	p, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(p, v)
+}
+
+// the provider's signing key with the given id. the key set is fetched again
+// when the id is unknown, in case the provider rotated its keys.
+func (p *OIDCProvider) key(kid string) (*rsa.PublicKey, error) {
+	p.mut.Lock()
+	key := p.keys[kid]
+	p.mut.Unlock()
+	if key != nil {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	err := p.getJSON(p.JWKSURI, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("oidc keys: %v", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.mut.Lock()
+	p.keys = keys
+	p.mut.Unlock()
+
+	key = keys[kid]
+	if key == nil {
+		return nil, fmt.Errorf("id token: unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// The login methods a client can offer.
+func AuthProviders(resp http.ResponseWriter, req *http.Request) {
+	jsonapi.Success(resp, jsonapi.Map{
+		"local":        true,
+		"registration": OpenRegistration,
+		"oidc":         OIDC != nil,
+	})
+}
+
+// Redirect the browser to the OIDC provider to log in.
+func OIDCLogin(resp http.ResponseWriter, req *http.Request) {
+	if OIDC == nil {
+		NotFound(resp, req)
+		return
+	}
+	authurl, state, err := OIDC.AuthURL()
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	http.SetCookie(resp, &http.Cookie{
+		Name:     OIDCStateCookie,
+		Value:    state,
+		Path:     "/api/oidc",
+		MaxAge:   int(OIDCLoginTTL / time.Second),
+		HttpOnly: true,
+		Secure:   secureCookie(req),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(resp, req, authurl, http.StatusFound)
+}
+
+// Complete an OIDC login, starting a session for the user with the verified
+// email address and redirecting the browser to the web interface.
+func OIDCCallback(resp http.ResponseWriter, req *http.Request) {
+	if OIDC == nil {
+		NotFound(resp, req)
+		return
+	}
+	q := req.URL.Query()
+	if e := q.Get("error"); e != "" {
+		HTTPLog(req, "oidc error: ", e, " ", q.Get("error_description"))
+		jsonapi.Error(resp, 401, "login failed: "+e)
+		return
+	}
+	state := q.Get("state")
+	c, err := req.Cookie(OIDCStateCookie)
+	if err != nil || state == "" || c.Value != state {
+		jsonapi.Error(resp, 400, ErrOIDCState)
+		return
+	}
+	http.SetCookie(resp, &http.Cookie{Name: OIDCStateCookie, Path: "/api/oidc", MaxAge: -1})
+
+	claims, err := OIDC.Exchange(state, q.Get("code"))
+	if err == ErrOIDCState {
+		jsonapi.Error(resp, 400, err)
+		return
+	}
+	if err != nil {
+		HTTPLog(req, err)
+		jsonapi.Error(resp, 401, "login failed")
+		return
+	}
+	if !claims.emailVerified(OIDC.Config.TrustUnverifiedEmail) {
+		jsonapi.Error(resp, 403, ErrOIDCEmailUnverified)
+		return
+	}
+
+	userid, err := model.LocateOrCreateUserByEmail(claims.Email)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	s, err := model.CreateSession(userid)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	setSessionCookie(resp, req, s)
+	http.Redirect(resp, req, "/", http.StatusFound)
+}
@@ -0,0 +1,255 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// oidc_test.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// a minimal OpenID Connect issuer. the token endpoint issues idToken for the
+// code "good" when the PKCE verifier matches the challenge of the last
+// authorization url.
+type stubIssuer struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	idToken   func(iss, nonce string) map[string]interface{}
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(resp http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(resp).Encode(map[string]interface{}{
+			"issuer":                 s.URL,
+			"authorization_endpoint": s.URL + "/authorize",
+			"token_endpoint":         s.URL + "/token",
+			"jwks_uri":               s.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(resp http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(resp).Encode(map[string]interface{}{
+			"keys": []interface{}{map[string]interface{}{
+				"kty": "RSA",
+				"use": "sig",
+				"kid": "k1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(resp http.ResponseWriter, req *http.Request) {
+		user, pass, _ := req.BasicAuth()
+		if user != "mtrack" || pass != "secret" {
+			resp.WriteHeader(401)
+			json.NewEncoder(resp).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		code := req.FormValue("code")
+		if code != "good" || pkceChallenge(req.FormValue("code_verifier")) != s.challenge {
+			resp.WriteHeader(400)
+			json.NewEncoder(resp).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(resp).Encode(map[string]string{
+			"token_type": "Bearer",
+			"id_token":   s.sign(t, s.idToken(s.URL, s.nonce)),
+		})
+	})
+	s.Server = httptest.NewServer(mux)
+	s.idToken = func(iss, nonce string) map[string]interface{} {
+		return map[string]interface{}{
+			"iss":            iss,
+			"sub":            "1234",
+			"aud":            "mtrack",
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          nonce,
+			"email":          "test@example.com",
+			"email_verified": true,
+		}
+	}
+	return s
+}
+
+func (s *stubIssuer) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// start a login with p, recording the challenge and nonce the stub expects.
+func (s *stubIssuer) start(t *testing.T, p *OIDCProvider) string {
+	authurl, state, err := p.AuthURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("state") != state || q.Get("client_id") != "mtrack" {
+		t.Fatalf("authorization url: %q", authurl)
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("scope") != "openid email" {
+		t.Fatalf("authorization url: %q", authurl)
+	}
+	s.challenge = q.Get("code_challenge")
+	s.nonce = q.Get("nonce")
+	return state
+}
+
+func TestOIDCProvider(t *testing.T) {
+	issuer := newStubIssuer(t)
+	defer issuer.Close()
+
+	p, err := NewOIDCProvider(OIDCConfig{
+		Issuer:       issuer.URL,
+		ClientId:     "mtrack",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:7890/api/oidc/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := issuer.start(t, p)
+	claims, err := p.Exchange(state, "good")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Email != "test@example.com" || claims.Subject != "1234" {
+		t.Errorf("claims: %#v", claims)
+	}
+	_, err = p.Exchange(state, "good")
+	if err != ErrOIDCState {
+		t.Errorf("reused state: %v", err)
+	}
+
+	state = issuer.start(t, p)
+	_, err = p.Exchange(state, "bad")
+	if err == nil {
+		t.Errorf("bad code accepted")
+	}
+
+	// the pkce verifier of one login does not redeem another's code.
+	state = issuer.start(t, p)
+	issuer.start(t, p)
+	_, err = p.Exchange(state, "good")
+	if err == nil {
+		t.Errorf("mismatched verifier accepted")
+	}
+
+	valid := issuer.idToken
+	defer func() { issuer.idToken = valid }()
+	invalid := map[string]func(map[string]interface{}){
+		"expired":      func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"audience":     func(c map[string]interface{}) { c["aud"] = "other" },
+		"multiple aud": func(c map[string]interface{}) { c["aud"] = []string{"mtrack", "other"} },
+		"issuer":       func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+		"nonce":        func(c map[string]interface{}) { c["nonce"] = "replayed" },
+	}
+	for name, modify := range invalid {
+		modify := modify
+		issuer.idToken = func(iss, nonce string) map[string]interface{} {
+			claims := valid(iss, nonce)
+			modify(claims)
+			return claims
+		}
+		state := issuer.start(t, p)
+		_, err := p.Exchange(state, "good")
+		if err == nil {
+			t.Errorf("%s: invalid token accepted", name)
+		}
+	}
+}
+
+func TestOIDCSignature(t *testing.T) {
+	issuer := newStubIssuer(t)
+	defer issuer.Close()
+	p, err := NewOIDCProvider(OIDCConfig{Issuer: issuer.URL, ClientId: "mtrack"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := issuer.sign(t, issuer.idToken(issuer.URL, "n"))
+	_, err = p.verifyIDToken(token, "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forger := &stubIssuer{key: other}
+	_, err = p.verifyIDToken(forger.sign(t, issuer.idToken(issuer.URL, "n")), "n")
+	if err != ErrIDToken {
+		t.Errorf("forged token: %v", err)
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload, _ := json.Marshal(issuer.idToken(issuer.URL, "n"))
+	_, err = p.verifyIDToken(header+"."+base64.RawURLEncoding.EncodeToString(payload)+".", "n")
+	if err == nil {
+		t.Errorf("unsigned token accepted")
+	}
+}
+
+func TestOIDCDiscoveryIssuer(t *testing.T) {
+	issuer := newStubIssuer(t)
+	defer issuer.Close()
+	_, err := NewOIDCProvider(OIDCConfig{Issuer: issuer.URL + "/", ClientId: "mtrack"})
+	if err == nil {
+		t.Errorf("mismatched issuer accepted")
+	}
+}
+
+func TestIDClaimsEmailVerified(t *testing.T) {
+	yes, no := true, false
+	for i, test := range []struct {
+		claims       IDClaims
+		trustMissing bool
+		verified     bool
+	}{
+		{IDClaims{Email: "a@example.com", EmailVerified: &yes}, false, true},
+		{IDClaims{Email: "a@example.com", EmailVerified: &no}, true, false},
+		{IDClaims{Email: "a@example.com"}, false, false},
+		{IDClaims{Email: "a@example.com"}, true, true},
+		{IDClaims{EmailVerified: &yes}, true, false},
+	} {
+		if test.claims.emailVerified(test.trustMissing) != test.verified {
+			t.Errorf("test %d: verified %v", i, !test.verified)
+		}
+	}
+}
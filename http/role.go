@@ -0,0 +1,217 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// role.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/bmatsuo/mtrack/http/jsonapi"
+	"github.com/bmatsuo/mtrack/model"
+	"github.com/gorilla/mux"
+)
+
+// All roles and their permissions.
+func RoleIndex(resp http.ResponseWriter, req *http.Request) {
+	_, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+
+	roles, err := model.AllRoles()
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{
+		"results": roles,
+	})
+}
+
+// Create a role or replace its permissions. Requires PermAdmin. Roles in the
+// config file are restored when the server restarts.
+func RoleSave(resp http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+	params, err := jsonapi.Read(req)
+	if err == jsonapi.ErrNotJson {
+		NotJson(resp, req)
+		return
+	}
+	if err != nil {
+		InvalidJson(resp, req, err)
+		return
+	}
+	js, ok := params.CheckGet("permissions")
+	if !ok {
+		MissingParameter(resp, req, "permissions")
+		return
+	}
+	ss, err := js.StringArray()
+	if err != nil {
+		InvalidParameter(resp, req, "permissions")
+		return
+	}
+	perms := make([]model.Permission, 0, len(ss))
+	for _, s := range ss {
+		perm, err := model.ParsePermission(s)
+		if err != nil {
+			InvalidParameter(resp, req, "permissions")
+			return
+		}
+		perms = append(perms, perm)
+	}
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	ok, err = model.UserHasPermission(user.Id, model.PermAdmin)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if !ok {
+		Forbidden(resp, req)
+		return
+	}
+
+	err = model.SaveRole(name, perms)
+	if err == model.ErrInvalidRole {
+		jsonapi.Error(resp, 400, err)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	role, err := model.FindRole(name)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{
+		"name":        role.Name,
+		"permissions": role.Permissions,
+	})
+}
+
+// Delete a role, unassigning it from its users. Requires PermAdmin.
+func RoleDelete(resp http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	ok, err := model.UserHasPermission(user.Id, model.PermAdmin)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if !ok {
+		Forbidden(resp, req)
+		return
+	}
+
+	err = model.DeleteRole(name)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, nil)
+}
+
+// Assign (PUT) or unassign (DELETE) a role. Requires PermAdmin.
+func UserRole(resp http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	userid, role := vars["id"], vars["role"]
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	ok, err := model.UserHasPermission(user.Id, model.PermAdmin)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if !ok {
+		Forbidden(resp, req)
+		return
+	}
+
+	_, err = model.FindUser(userid)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if req.Method == "DELETE" {
+		err = model.UnassignRole(userid, role)
+	} else {
+		err = model.AssignRole(userid, role)
+	}
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	roles, err := model.UserRoles(userid)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{
+		"roles": roles,
+	})
+}
@@ -0,0 +1,223 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// scan.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/bmatsuo/mtrack/http/jsonapi"
+	"github.com/bmatsuo/mtrack/model"
+	"github.com/bmatsuo/mtrack/scan"
+	"github.com/gorilla/mux"
+)
+
+// Authorize a caller viewing scans, who may be anonymous, writing an error
+// response and returning false on failure. Scan errors contain filesystem
+// paths and are only shown to callers with PermScan or PermAdmin.
+func scanViewer(resp http.ResponseWriter, req *http.Request) (access *rootAccess, showErrors bool, ok bool) {
+	user, err := optionalUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return nil, false, false
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return nil, false, false
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return nil, false, false
+	}
+	access, err = newRootAccess(user)
+	if err != nil {
+		InternalError(resp, req, err)
+		return nil, false, false
+	}
+	if user != nil {
+		showErrors, err = model.UserHasAnyPermission(user.Id, model.PermScan, model.PermAdmin)
+		if err != nil {
+			InternalError(resp, req, err)
+			return nil, false, false
+		}
+	}
+	return access, showErrors, true
+}
+
+// The state of scanning and of each root the caller can read.
+func ScanStatus(resp http.ResponseWriter, req *http.Request) {
+	if scan.DefaultCron == nil {
+		jsonapi.Error(resp, 503, "scanning is not configured")
+		return
+	}
+	access, showErrors, ok := scanViewer(resp, req)
+	if !ok {
+		return
+	}
+	status := scan.Status()
+	result := cronStatusJSON(status, showErrors)
+	roots := make([]jsonapi.Map, 0, len(status.Roots))
+	for _, root := range status.Roots {
+		if access.canReadNamed(root.Root) {
+			roots = append(roots, cronStatusJSON(root, showErrors))
+		}
+	}
+	result["roots"] = roots
+	jsonapi.Success(resp, result)
+}
+
+// Request a scan. The optional parameters "root" and "dir" limit the scan to a
+// named root and a directory beneath it. The response contains a job id that
+// can be polled at /api/scan/jobs/{id}.
+func ScanTrigger(resp http.ResponseWriter, req *http.Request) {
+	if scan.DefaultCron == nil {
+		jsonapi.Error(resp, 503, "scanning is not configured")
+		return
+	}
+	params, err := jsonapi.Read(req)
+	if err == io.EOF {
+		// all parameters are optional
+		params, err = simplejson.New(), nil
+	}
+	if err == jsonapi.ErrNotJson {
+		NotJson(resp, req)
+		return
+	}
+	if err != nil {
+		InvalidJson(resp, req, err)
+		return
+	}
+
+	root, err := StringParameter(params, "root")
+	if _, ok := err.(InvalidParameterError); ok {
+		InvalidParameter(resp, req, "root")
+		return
+	}
+	dir, err := StringParameter(params, "dir")
+	if _, ok := err.(InvalidParameterError); ok {
+		InvalidParameter(resp, req, "dir")
+		return
+	}
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	ok, err := model.UserHasAnyPermission(user.Id, model.PermScan, model.PermAdmin)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if !ok {
+		Forbidden(resp, req)
+		return
+	}
+
+	job, err := scan.Trigger(root, dir)
+	switch err {
+	case nil:
+	case scan.ErrUnknownRoot:
+		NotFound(resp, req)
+		return
+	case scan.ErrInvalidDir:
+		InvalidParameter(resp, req, "dir")
+		return
+	default:
+		InternalError(resp, req, err)
+		return
+	}
+
+	// the content type must be set before the status is written.
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+	resp.WriteHeader(202)
+	jsonapi.Success(resp, jsonapi.Map{
+		"jobId": job.Id,
+		"job":   scanJobJSON(job, true),
+	})
+}
+
+func ScanJobShow(resp http.ResponseWriter, req *http.Request) {
+	if scan.DefaultCron == nil {
+		jsonapi.Error(resp, 503, "scanning is not configured")
+		return
+	}
+	access, showErrors, ok := scanViewer(resp, req)
+	if !ok {
+		return
+	}
+	job := scan.Job(mux.Vars(req)["id"])
+	if job == nil || (job.Root != "" && !access.canReadNamed(job.Root)) {
+		NotFound(resp, req)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{
+		"job": scanJobJSON(job, showErrors),
+	})
+}
+
+// errors are omitted unless showErrors is true.
+func scanJobJSON(job *scan.ScanJob, showErrors bool) jsonapi.Map {
+	js := jsonapi.Map{
+		"jobId":    job.Id,
+		"root":     job.Root,
+		"dir":      job.Dir,
+		"state":    job.State,
+		"created":  job.Created,
+		"started":  jsonTime(job.Started),
+		"finished": jsonTime(job.Finished),
+		"files":    job.ScanStats,
+	}
+	if showErrors {
+		js["errors"] = errorStrings(job.Errors)
+	}
+	return js
+}
+
+// errors are omitted unless showErrors is true.
+func cronStatusJSON(status *scan.CronStatus, showErrors bool) jsonapi.Map {
+	js := jsonapi.Map{
+		"state":           status.State,
+		"lastScan":        jsonTime(status.LastScan),
+		"lastScanSeconds": status.LastScanDur.Seconds(),
+		"nextScan":        jsonTime(status.NextScan),
+		"files":           status.ScanStats,
+	}
+	if status.Root != "" {
+		js["root"] = status.Root
+		if showErrors {
+			js["errors"] = errorStrings(status.Errors)
+		}
+	}
+	return js
+}
+
+func errorStrings(errs []error) []string {
+	strs := make([]string, len(errs))
+	for i := range errs {
+		strs[i] = errs[i].Error()
+	}
+	return strs
+}
+
+// zero times are serialized as null.
+func jsonTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
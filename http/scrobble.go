@@ -0,0 +1,119 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// scrobble.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/bmatsuo/mtrack/http/jsonapi"
+	"github.com/bmatsuo/mtrack/model"
+	"github.com/bmatsuo/mtrack/scrobble"
+)
+
+// Maps the accounts players report to the usernames (or verified emails) of
+// users. If it is empty scrobbles are recorded for the caller. Otherwise
+// scrobbles from accounts it does not contain are ignored, so a player shared
+// by a household only records progress for the people mapped.
+var ScrobbleUsers map[string]string
+
+// Record a playback event sent by a player's webhook. See package scrobble
+// for the formats understood. Players that cannot set an Authorization
+// header may pass an access token in the token query parameter. Recording
+// progress for a mapped user other than the caller requires
+// PermUserProgressUpdate, and both must be allowed to record progress in the
+// media's root. Events that record nothing succeed with the reason in
+// "ignored".
+func Scrobble(resp http.ResponseWriter, req *http.Request) {
+	if token := req.URL.Query().Get("token"); token != "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "token "+token)
+	}
+
+	s, err := scrobble.Parse(req)
+	if reason, ok := err.(scrobble.IgnoredError); ok {
+		jsonapi.Success(resp, jsonapi.Map{"ignored": reason.Error()})
+		return
+	}
+	if err != nil {
+		jsonapi.Error(resp, 400, err)
+		return
+	}
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+
+	target := user
+	if len(ScrobbleUsers) > 0 {
+		name, ok := ScrobbleUsers[s.Account]
+		if !ok {
+			jsonapi.Success(resp, jsonapi.Map{"ignored": "unmapped account: " + s.Account})
+			return
+		}
+		target, err = model.FindUserByName(name)
+		if err == sql.ErrNoRows {
+			// the configuration is wrong, which the operator needs to know.
+			HTTPLog(req, "scrobble user not found: ", name)
+			jsonapi.Error(resp, 500, "configuration error: scrobble user not found: ", name)
+			return
+		}
+		if err != nil {
+			InternalError(resp, req, err)
+			return
+		}
+	}
+	if target.Id != user.Id {
+		ok, err := model.UserHasPermission(user.Id, model.PermUserProgressUpdate)
+		if err != nil {
+			InternalError(resp, req, err)
+			return
+		}
+		if !ok {
+			Forbidden(resp, req)
+			return
+		}
+	}
+
+	media, err := s.Match()
+	if err == sql.ErrNoRows {
+		NotFound(resp, req, "no media matches")
+		return
+	}
+	if err == model.ErrAmbiguousMedia {
+		jsonapi.Error(resp, 409, err)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if progressMedia(resp, req, user, target.Id, media.Id) == nil {
+		return
+	}
+
+	finished, err := s.Apply(target.Id, media)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{
+		"mediaId":  media.Id,
+		"userId":   target.Id,
+		"action":   s.Action,
+		"finished": finished,
+	})
+}
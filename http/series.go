@@ -0,0 +1,148 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// series.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/bmatsuo/mtrack/http/jsonapi"
+	"github.com/bmatsuo/mtrack/model"
+	"github.com/gorilla/mux"
+)
+
+// The series with episodes in the roots the caller may see.
+func SeriesIndex(resp http.ResponseWriter, req *http.Request) {
+	user, err := optionalUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	access, err := newRootAccess(user)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+
+	results, err := model.AllSeries(access.readableRoots())
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{
+		"results": results,
+	})
+}
+
+// A series along with its seasons. Only episodes in the roots the caller may
+// see are counted and a series without any is not found.
+func SeriesShow(resp http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+
+	user, err := optionalUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	access, err := newRootAccess(user)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+
+	roots := access.readableRoots()
+	series, err := model.FindSeries(id, roots)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	seasons, err := model.SeriesSeasons(id, roots)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{
+		"series":  series,
+		"seasons": seasons,
+	})
+}
+
+// The episodes of a single season of a series in the roots the caller may
+// see.
+func SeasonShow(resp http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	season, err := strconv.Atoi(vars["season"])
+	if err != nil {
+		NotFound(resp, req)
+		return
+	}
+
+	user, err := optionalUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	access, err := newRootAccess(user)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+
+	roots := access.readableRoots()
+	series, err := model.FindSeries(vars["id"], roots)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	episodes, err := model.SeriesEpisodes(series.Id, season, roots)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if len(episodes) == 0 {
+		NotFound(resp, req)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{
+		"series":   series,
+		"season":   season,
+		"episodes": episodes,
+	})
+}
@@ -0,0 +1,258 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// session.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"crypto/hmac"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bmatsuo/mtrack/http/jsonapi"
+	"github.com/bmatsuo/mtrack/model"
+)
+
+// The cookie holding the id of a login session.
+const SessionCookie = "mtrack_session"
+
+// Requests authorized by a session cookie that change state must carry the
+// session's CSRF token in this header.
+const CSRFHeader = "X-CSRF-Token"
+
+var ErrCSRF = fmt.Errorf("missing or invalid csrf token")
+
+// Allow anyone to create a local account with POST /api/register.
+var OpenRegistration = false
+
+// Always mark session cookies Secure. Otherwise they are only Secure when the
+// request was made over TLS (directly or through a proxy setting
+// X-Forwarded-Proto).
+var SecureCookies = false
+
+func safeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+// the unexpired session identified by the request's cookie.
+func requestSession(req *http.Request) (*model.Session, error) {
+	c, err := req.Cookie(SessionCookie)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	s, err := model.FindSession(c.Value)
+	if err == sql.ErrNoRows || err == model.ErrSessionExpired {
+		return nil, ErrUnauthorized
+	}
+	return s, err
+}
+
+func checkCSRF(req *http.Request, s *model.Session) error {
+	if safeMethod(req.Method) {
+		return nil
+	}
+	token := req.Header.Get(CSRFHeader)
+	if token == "" || !hmac.Equal([]byte(token), []byte(s.CSRFToken)) {
+		return ErrCSRF
+	}
+	return nil
+}
+
+// authorize a request without an Authorization header using its session.
+func authorizeSession(req *http.Request) (*model.User, error) {
+	s, err := requestSession(req)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCSRF(req, s)
+	if err != nil {
+		return nil, err
+	}
+	return model.FindUser(s.UserId)
+}
+
+func secureCookie(req *http.Request) bool {
+	return SecureCookies || req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func setSessionCookie(resp http.ResponseWriter, req *http.Request, s *model.Session) {
+	c := &http.Cookie{
+		Name:     SessionCookie,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secureCookie(req),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if s != nil {
+		c.Value = s.Id
+		c.Expires = s.Expires
+	} else {
+		c.MaxAge = -1
+		c.Expires = time.Unix(0, 0)
+	}
+	http.SetCookie(resp, c)
+}
+
+func sessionJSON(user *model.User, s *model.Session) jsonapi.Map {
+	return jsonapi.Map{
+		"userId":    user.Id,
+		"username":  user.Username,
+		"csrfToken": s.CSRFToken,
+		"expires":   s.Expires,
+	}
+}
+
+// read the username and password parameters of a login or registration.
+func loginParameters(resp http.ResponseWriter, req *http.Request) (username, password string, ok bool) {
+	params, err := jsonapi.Read(req)
+	if err == jsonapi.ErrNotJson {
+		NotJson(resp, req)
+		return "", "", false
+	}
+	if err != nil {
+		InvalidJson(resp, req, err)
+		return "", "", false
+	}
+
+	username, err = StringParameter(params, "username")
+	switch err.(type) {
+	case MissingParameterError:
+		MissingParameter(resp, req, "username")
+		return "", "", false
+	case InvalidParameterError:
+		InvalidParameter(resp, req, "username")
+		return "", "", false
+	}
+
+	password, err = StringParameter(params, "password")
+	switch err.(type) {
+	case MissingParameterError:
+		MissingParameter(resp, req, "password")
+		return "", "", false
+	case InvalidParameterError:
+		InvalidParameter(resp, req, "password")
+		return "", "", false
+	}
+	return username, password, true
+}
+
+// Start a session for a local account. The session id is returned in an
+// HTTP-only cookie and the CSRF token in the response body.
+func Login(resp http.ResponseWriter, req *http.Request) {
+	username, password, ok := loginParameters(resp, req)
+	if !ok {
+		return
+	}
+
+	user, err := model.AuthenticateLocalUser(username, password)
+	if err == model.ErrInvalidLogin {
+		jsonapi.Error(resp, 401, err)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+
+	s, err := model.CreateSession(user.Id)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	setSessionCookie(resp, req, s)
+	jsonapi.Success(resp, sessionJSON(user, s))
+}
+
+// Create a local account and start a session for it. Registration is only
+// possible when OpenRegistration is true.
+func Register(resp http.ResponseWriter, req *http.Request) {
+	if !OpenRegistration {
+		jsonapi.Error(resp, 403, "registration is closed")
+		return
+	}
+	username, password, ok := loginParameters(resp, req)
+	if !ok {
+		return
+	}
+
+	userid, err := model.CreateLocalUser(username, password)
+	switch err {
+	case nil:
+	case model.ErrInvalidUsername:
+		InvalidParameter(resp, req, "username")
+		return
+	case model.ErrUsernameTaken:
+		jsonapi.Error(resp, 409, err)
+		return
+	case model.ErrWeakPassword, model.ErrLongPassword:
+		jsonapi.Error(resp, 400, err)
+		return
+	default:
+		InternalError(resp, req, err)
+		return
+	}
+
+	user, err := model.FindUser(userid)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	s, err := model.CreateSession(user.Id)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	setSessionCookie(resp, req, s)
+	jsonapi.Success(resp, sessionJSON(user, s))
+}
+
+// End the request's session. Logging out without a session succeeds.
+func Logout(resp http.ResponseWriter, req *http.Request) {
+	s, err := requestSession(req)
+	if err == ErrUnauthorized {
+		setSessionCookie(resp, req, nil)
+		jsonapi.Success(resp, nil)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	err = checkCSRF(req, s)
+	if err != nil {
+		Forbidden(resp, req)
+		return
+	}
+
+	err = model.DeleteSession(s.Id)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	setSessionCookie(resp, req, nil)
+	jsonapi.Success(resp, nil)
+}
+
+// The user and CSRF token of the request's session, so a client can resume a
+// session after a reload.
+func SessionShow(resp http.ResponseWriter, req *http.Request) {
+	s, err := requestSession(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	user, err := model.FindUser(s.UserId)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, sessionJSON(user, s))
+}
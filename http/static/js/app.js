@@ -1,9 +1,11 @@
 var config = {
-    persona: {
-                 verifyUrl: '/api/persona/verify',
-                 statusUrl: null,
-                 logoutUrl: null
-             }
+    auth: {
+              loginUrl: '/api/login',
+              logoutUrl: '/api/logout',
+              sessionUrl: '/api/session',
+              providersUrl: '/api/auth/providers',
+              oidcLoginUrl: '/api/oidc/login'
+          }
 };
 
-var mtrack = angular.module('mtrack', ["persona"]);
+var mtrack = angular.module('mtrack', ["auth"]);
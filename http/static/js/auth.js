@@ -0,0 +1,67 @@
+var auth = angular.module("auth", []);
+
+// the current login session: { userId, username, csrfToken, expires }. the
+// session id itself is kept in an http-only cookie.
+auth.factory('sessionService', ["$http", function($http) {
+    var _current;
+    var _use = function(session) {
+        _current = session;
+        if (session) {
+            $http.defaults.headers.common['X-CSRF-Token'] = session.csrfToken;
+        } else {
+            delete $http.defaults.headers.common['X-CSRF-Token'];
+        }
+    };
+    return {
+        session: function() { return _current || { status: 'unauthenticated' }; },
+        store: _use,
+        endSession: function() { _use(undefined); }
+    };
+}]);
+
+auth.factory("authService", ["$http", "$q", "sessionService", function($http, $q, sessionService) {
+    var _request = function(promise) {
+        var deferred = $q.defer();
+        promise.
+            success(function(data) {
+                sessionService.store(data);
+                deferred.resolve(data);
+            }).
+            error(function(data) {
+                sessionService.endSession();
+                deferred.reject(data && data.reason);
+            });
+        return deferred.promise;
+    };
+    return {
+        login: function(username, password) {
+                   return _request($http.post(config.auth.loginUrl,
+                           { username: username, password: password }));
+               },
+        // resume a session started before the page was loaded.
+        resume: function() {
+                    return _request($http.get(config.auth.sessionUrl));
+                },
+        // the login methods offered by the server.
+        providers: function() {
+                       var deferred = $q.defer();
+                       $http.get(config.auth.providersUrl).
+                           success(function(data) { deferred.resolve(data); }).
+                           error(function(data) { deferred.reject(data && data.reason); });
+                       return deferred.promise;
+                   },
+        logout: function() {
+                    var deferred = $q.defer();
+                    $http.post(config.auth.logoutUrl, {}).
+                        success(function() {
+                            sessionService.endSession();
+                            deferred.resolve(true);
+                        }).
+                        error(function() {
+                            sessionService.endSession();
+                            deferred.resolve(true);
+                        });
+                    return deferred.promise;
+                }
+    };
+}]);
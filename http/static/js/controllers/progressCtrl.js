@@ -1,7 +1,10 @@
-mtrack.controller('ProgressCtrl', ["$scope", "$http", "$q", "personaService", "sessionService",function ProgressCtrl($scope, $http, $q, personaService, sessionService) {
+mtrack.controller('ProgressCtrl', ["$scope", "$http", "$q", "$timeout", "authService", "sessionService",function ProgressCtrl($scope, $http, $q, $timeout, authService, sessionService) {
     $scope.verified = false;
     $scope.userId = undefined;
-    $scope.media = {};
+    $scope.login = { username: '', password: '', error: undefined };
+    $scope.oidcLoginUrl = undefined;
+    $scope.media = [];
+    $scope.mediaNext = undefined;
     $scope.usersInProgress = {};
     $scope.usersFinished = {};
     $scope.mediaRoots = [];
@@ -16,35 +19,44 @@ mtrack.controller('ProgressCtrl', ["$scope", "$http", "$q", "personaService", "s
     };
 
     $scope.verify = function() {
-        personaService.verify().
+        authService.login($scope.login.username, $scope.login.password).
             then(function(result) {
-                console.log('verified', result);
+                console.log('logged in', result);
                 $scope.verified = true;
                 $scope.userId = result.userId;
-            }, function(result) {
-                console.log('verification failure', result);
+                $scope.login = { username: '', password: '', error: undefined };
+                $scope.getMedia();
+                $scope.getProgress();
+                listen();
+            }, function(reason) {
+                console.log('login failure', reason);
+                $scope.login.password = '';
+                $scope.login.error = reason || 'login failed';
             });
     };
 
     $scope.logout = function() {
-        personaService.logout().
+        authService.logout().
             then(function(result) {
                 console.log('logged out', result);
                 $scope.verified = false;
                 $scope.userId = undefined;
+                $scope.getMedia();
+                $scope.getProgress();
+                listen();
             });
     };
 
-    $scope.getProgress = function() {
-        var resp = $http.get('/api/media/progress');
+    // progress is small next to the library, so every page is loaded.
+    $scope.getProgress = function(cursor) {
+        var params = cursor ? { cursor: cursor } : {};
+        var resp = $http.get('/api/media/progress', { params: params });
         resp.success(function(data, status, headers) {
-            $scope.usersInProgress = {};
-            $scope.usersFinished = {};
-            for (i in $scope.media) {
-                var m = $scope.media[i].mediaId;
-                $scope.usersInProgress[m.mediaId] = [];
-                $scope.usersFinished[m.mediaId] = [];
+            if (!cursor) {
+                $scope.usersInProgress = {};
+                $scope.usersFinished = {};
             }
+            if (data.next) $scope.getProgress(data.next);
             var progress = data.results;
             for (i in progress) {
                 var p = progress[i];
@@ -67,14 +79,23 @@ mtrack.controller('ProgressCtrl', ["$scope", "$http", "$q", "personaService", "s
         });
     };
 
-    $scope.getMedia = function() {
-        var resp = $http.get('/api/media');
+    // load the first page of media, or the next page when more is true.
+    // signed in users get their own status, position and last watched time
+    // with each item.
+    $scope.getMedia = function(more) {
+        var params = more ? { cursor: $scope.mediaNext } : {},
+            url = $scope.verified ? '/api/me/media' : '/api/media';
+        var resp = $http.get(url, { params: params });
         resp.success(function(data, status, headers) {
-            $scope.mediaByRoot = {};
             var media = data.results;
 
-            mediaByRoot = {};
-            mediaById = {};
+            if (!more) {
+                $scope.mediaByRoot = {};
+                $scope.media = [];
+                mediaByRoot = {};
+                mediaById = {};
+            }
+            $scope.mediaNext = data.next;
 
             for (i in media) {
                 var m = media[i],
@@ -94,93 +115,151 @@ mtrack.controller('ProgressCtrl', ["$scope", "$http", "$q", "personaService", "s
                 $scope.mediaRoots = $scope.mediaRoots.concat(root);
             }
 
-            $scope.media = media;
+            $scope.media = $scope.media.concat(media);
         });
         resp.error(function(data, status, headers) {
             logApiError(data, status);
         });
     };
 
+    $scope.getScanStatus = function() {
+        var resp = $http.get('/api/scan/status');
+        resp.success(function(data, status, headers) {
+            $scope.scanStatus = data;
+        });
+        resp.error(function(data, status, headers) {
+            logApiError(data, status);
+        });
+    };
+
+    var mediaStatus = function(mediaId) {
+        var m = mediaById[mediaId];
+        return (m && m.status) || 'unwatched';
+    };
+
     $scope.mediaUnwatched = function(mediaId) {
-        return !$scope.mediaStarted(mediaId) && !$scope.mediaFinished(mediaId);
+        return mediaStatus(mediaId) == 'unwatched';
     };
 
     $scope.mediaStarted = function(mediaId) {
-        var users = $scope.usersInProgress[mediaId] || [];
-        for (i in users) {
-            if (users[i].userId == $scope.userId) {
-                console.log('finished', mediaId);
-                return true;
-            }
-        }
-        console.log('unfinished', mediaId);
-        return false;
+        return mediaStatus(mediaId) == 'in_progress';
+    };
+
+    // the position (in seconds) at which the user stopped watching.
+    $scope.mediaPosition = function(mediaId) {
+        var m = mediaById[mediaId];
+        return (m && m.position) || 0;
     };
 
     $scope.mediaFinished = function(mediaId) {
-        var users = $scope.usersFinished[mediaId] || [];
-        for (i in users) {
-            if (users[i].userId == $scope.userId) {
-                console.log('finished', mediaId);
-                return true;
-            }
-        }
-        console.log('unfinished', mediaId);
-        return false;
+        return mediaStatus(mediaId) == 'finished';
+    };
+
+    var setStatus = function(mediaId, status) {
+        var m = mediaById[mediaId];
+        if (!m) return;
+        m.status = status;
+        m.position = 0;
+        m.lastWatched = status == 'unwatched' ? undefined : new Date().toISOString();
     };
 
     $scope.startMedia = function(mediaId) {
-        var session = sessionService.session();
-        var accessToken = session.accessToken;
-        var userId = session.userId;
-        var data = { userId: userId, mediaId: mediaId };
-        var header = { Authorization: 'token ' + accessToken};
-        $http.post('/api/start', data, { headers: header }).
+        var data = { userId: $scope.userId, mediaId: mediaId };
+        $http.post('/api/start', data).
             success(function(data) {
+                setStatus(mediaId, 'in_progress');
                 $scope.getProgress();
             }).
         error(function(data, status) {
-            console.log('startMedia:', status.code, data);
+            console.log('startMedia:', status, data);
         });
     };
 
     $scope.finishMedia = function(mediaId) {
-        var sessino = sessionService.session();
-        var accessToken = session.accessToken;
-        var userId = session.userId;
-        var data = { userId: userId, mediaId: mediaId };
-        var header = { Authorization: 'token ' + accessToken};
-        $http.post('/api/finish', data, { headers: header }).
+        var data = { userId: $scope.userId, mediaId: mediaId };
+        $http.post('/api/finish', data).
             success(function(data) {
-                console.log('finish that shit');
+                setStatus(mediaId, 'finished');
                 $scope.getProgress();
             }).
         error(function(data, status) {
-            console.log('startMedia:', status.code, data);
+            console.log('finishMedia:', status, data);
         });
     };
 
     $scope.clearMedia = function(mediaId) {
-        var sessino = sessionService.session();
-        var accessToken = session.accessToken;
-        var userId = session.userId;
-        var data = { userId: userId, mediaId: mediaId };
-        var header = { Authorization: 'token ' + accessToken};
-        $http.post('/api/clear', data, { headers: header }).
+        var data = { userId: $scope.userId, mediaId: mediaId };
+        $http.post('/api/clear', data).
             success(function(data) {
-                console.log('finish that shit');
+                setStatus(mediaId, 'unwatched');
                 $scope.getProgress();
             }).
         error(function(data, status) {
-            console.log('startMedia:', status.code, data);
+            console.log('clearMedia:', status, data);
+        });
+    };
+
+    // reload things after a burst of events (e.g. a scan) has settled.
+    var reloads = {};
+    var reload = function(name, fn) {
+        if (reloads[name]) $timeout.cancel(reloads[name]);
+        reloads[name] = $timeout(function() {
+            delete reloads[name];
+            fn();
+        }, 2000);
+    };
+
+    // follow library and progress changes. the stream is reopened when the
+    // user signs in or out because that changes which roots are visible.
+    var events;
+    var listen = function() {
+        if (typeof EventSource === 'undefined') return;
+        if (events) events.close();
+        events = new EventSource('/api/events');
+        var onMedia = function() {
+            reload('media', function() { $scope.getMedia(); });
+        };
+        var onProgress = function(e) {
+            var data = JSON.parse(e.data);
+            $scope.$apply(function() {
+                if (data.userId == $scope.userId) {
+                    var status = { 'progress.started': 'in_progress',
+                                   'progress.finished': 'finished',
+                                   'progress.cleared': 'unwatched' }[data.type];
+                    var m = mediaById[data.mediaId];
+                    if (m && m.status != status) setStatus(data.mediaId, status);
+                }
+                reload('progress', function() { $scope.getProgress(); });
+            });
+        };
+        var onScan = function() {
+            $scope.$apply(function() { $scope.getScanStatus(); });
+        };
+        ['media.created', 'media.updated', 'media.missing'].forEach(function(type) {
+            events.addEventListener(type, onMedia);
+        });
+        ['progress.started', 'progress.finished', 'progress.cleared'].forEach(function(type) {
+            events.addEventListener(type, onProgress);
+        });
+        ['scan.started', 'scan.finished'].forEach(function(type) {
+            events.addEventListener(type, onScan);
         });
     };
 
-    var session = sessionService.session();
-    if (typeof session.accessToken !== 'undefined') {
-        $scope.verified = true;
-        $scope.userId = session.userId;
-    }
-    $scope.getMedia();
+    authService.providers().
+        then(function(providers) {
+            if (providers.oidc) $scope.oidcLoginUrl = config.auth.oidcLoginUrl;
+        });
+    authService.resume().
+        then(function(session) {
+            $scope.verified = true;
+            $scope.userId = session.userId;
+            $scope.getMedia();
+            listen();
+        }, function() {
+            $scope.getMedia();
+            listen();
+        });
     $scope.getProgress();
+    $scope.getScanStatus();
 }]);
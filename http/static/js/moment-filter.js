@@ -7,3 +7,16 @@ mtrack.filter('moment', function() {
         }
     };
 });
+
+// format a number of seconds as a playback position (e.g. 42:10 or 1:02:03).
+mtrack.filter('position', function() {
+    return function(seconds) {
+        var d = moment.duration(Math.floor(seconds), 'seconds'),
+            pad = function(n) { return (n < 10 ? '0' : '') + n; },
+            clock = pad(d.minutes()) + ':' + pad(d.seconds());
+        if (Math.floor(d.asHours()) > 0) {
+            clock = Math.floor(d.asHours()) + ':' + clock;
+        }
+        return clock;
+    };
+});
@@ -0,0 +1,223 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// stream.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bmatsuo/mtrack/http/jsonapi"
+	"github.com/bmatsuo/mtrack/model"
+	"github.com/bmatsuo/mtrack/scan"
+	"github.com/gorilla/mux"
+)
+
+// The key used to sign stream urls. If it is empty when the server starts a
+// random key is generated, invalidating urls signed before a restart.
+var StreamSecret []byte
+
+// The lifetime of signed stream urls.
+var StreamURLTTL = 6 * time.Hour
+
+// Content types of common media files not known to package mime on all
+// systems.
+var mediaTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/x-m4v",
+	".mkv":  "video/x-matroska",
+	".webm": "video/webm",
+	".avi":  "video/x-msvideo",
+}
+
+func initStreamSecret() error {
+	if len(StreamSecret) > 0 {
+		return nil
+	}
+	StreamSecret = make([]byte, 32)
+	_, err := rand.Read(StreamSecret)
+	return err
+}
+
+func streamSignature(mediaid string, expires int64) string {
+	mac := hmac.New(sha256.New, StreamSecret)
+	fmt.Fprintf(mac, "%s\n%d", mediaid, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// A url for streaming media that does not require an Authorization header,
+// valid until expires.
+func SignStreamURL(mediaid string, expires time.Time) string {
+	q := make(url.Values)
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("sig", streamSignature(mediaid, expires.Unix()))
+	return "/api/media/" + url.QueryEscape(mediaid) + "/stream?" + q.Encode()
+}
+
+// true if the request's query contains an unexpired signature for mediaid.
+func streamURLSigned(req *http.Request, mediaid string) bool {
+	q := req.URL.Query()
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	sig := streamSignature(mediaid, expires)
+	return hmac.Equal([]byte(sig), []byte(q.Get("sig")))
+}
+
+// Issue a signed url for streaming the media to players that cannot send an
+// access token. The caller must be able to see the media's root.
+func MediaStreamURL(resp http.ResponseWriter, req *http.Request) {
+	mediaid := mux.Vars(req)["id"]
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+
+	media, err := model.FindMedia(mediaid)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	access, err := newRootAccess(user)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if !access.canRead(media.Root) {
+		NotFound(resp, req)
+		return
+	}
+
+	expires := time.Now().Add(StreamURLTTL)
+	jsonapi.Success(resp, jsonapi.Map{
+		"url":     SignStreamURL(mediaid, expires),
+		"expires": expires,
+	})
+}
+
+// Serve the contents of a media file, supporting Range and If-Range requests.
+// Requests must carry an access token or a signature from MediaStreamURL.
+func MediaStream(resp http.ResponseWriter, req *http.Request) {
+	mediaid := mux.Vars(req)["id"]
+
+	// signed urls are only issued to users who can see the media.
+	var access *rootAccess
+	if req.URL.Query().Get("sig") != "" {
+		if !streamURLSigned(req, mediaid) {
+			Forbidden(resp, req)
+			return
+		}
+	} else {
+		user, err := AuthorizeUser(req)
+		if err == ErrUnauthorized {
+			Unauthorized(resp, req)
+			return
+		}
+		if err == ErrInsufficientScope {
+			Forbidden(resp, req)
+			return
+		}
+		if err != nil {
+			BadAuthorization(resp, req)
+			return
+		}
+		access, err = newRootAccess(user)
+		if err != nil {
+			InternalError(resp, req, err)
+			return
+		}
+	}
+
+	media, err := model.FindMedia(mediaid)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if media.Missing != nil || (access != nil && !access.canRead(media.Root)) {
+		NotFound(resp, req)
+		return
+	}
+
+	// media is only served from the roots currently configured.
+	root := scan.LookupRoot(media.Root)
+	if root == nil {
+		NotFound(resp, req)
+		return
+	}
+	path, err := root.Resolve(media.Path)
+	if err == scan.ErrOutsideRoot {
+		Forbidden(resp, req)
+		return
+	}
+	if os.IsNotExist(err) {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	ctype, ok := mediaTypes[ext]
+	if !ok {
+		ctype = mime.TypeByExtension(ext)
+	}
+	if ctype != "" {
+		resp.Header().Set("Content-Type", ctype)
+	}
+	// a strong validator lets If-Range work with an etag as well as a date.
+	etag := fmt.Sprintf(`"%s-%x-%x"`, mediaid, info.Size(), info.ModTime().UnixNano())
+	resp.Header().Set("ETag", etag)
+	http.ServeContent(resp, req, filepath.Base(path), info.ModTime(), f)
+}
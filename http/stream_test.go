@@ -0,0 +1,47 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// stream_test.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamURLSigned(t *testing.T) {
+	StreamSecret = []byte("test secret")
+	defer func() { StreamSecret = nil }()
+
+	signed := func(url string) bool {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return streamURLSigned(req, "abc123")
+	}
+
+	url := SignStreamURL("abc123", time.Now().Add(time.Hour))
+	if !strings.HasPrefix(url, "/api/media/abc123/stream?") {
+		t.Errorf("url: %q", url)
+	}
+	if !signed(url) {
+		t.Errorf("signed url rejected")
+	}
+	if signed(SignStreamURL("def456", time.Now().Add(time.Hour))) {
+		t.Errorf("url for other media accepted")
+	}
+	if signed(SignStreamURL("abc123", time.Now().Add(-time.Minute))) {
+		t.Errorf("expired url accepted")
+	}
+	if signed(strings.Replace(url, "expires=", "expires=9", 1)) {
+		t.Errorf("modified expiration accepted")
+	}
+	if signed("/api/media/abc123/stream") {
+		t.Errorf("unsigned url accepted")
+	}
+}
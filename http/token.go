@@ -0,0 +1,157 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// token.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/bmatsuo/mtrack/http/jsonapi"
+	"github.com/bmatsuo/mtrack/model"
+	"github.com/gorilla/mux"
+)
+
+// The caller's access tokens. Tokens themselves are never returned.
+func TokenIndex(resp http.ResponseWriter, req *http.Request) {
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+
+	tokens, err := model.UserAccessTokens(user.Id)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{"results": tokens})
+}
+
+// Create an access token for the caller. The request names the token and may
+// list its scopes (default "all") and an RFC3339 expiration time.
+func TokenCreate(resp http.ResponseWriter, req *http.Request) {
+	params, err := jsonapi.Read(req)
+	if err == jsonapi.ErrNotJson {
+		NotJson(resp, req)
+		return
+	}
+	if err != nil {
+		InvalidJson(resp, req, err)
+		return
+	}
+
+	name, err := StringParameter(params, "name")
+	switch err.(type) {
+	case MissingParameterError:
+		MissingParameter(resp, req, "name")
+		return
+	case InvalidParameterError:
+		InvalidParameter(resp, req, "name")
+		return
+	}
+
+	scopes := []model.Scope{model.ScopeAll}
+	if js, ok := params.CheckGet("scopes"); ok {
+		ss, err := js.StringArray()
+		if err != nil || len(ss) == 0 {
+			InvalidParameter(resp, req, "scopes")
+			return
+		}
+		scopes = scopes[:0]
+		for _, s := range ss {
+			scope, err := model.ParseScope(s)
+			if err != nil {
+				InvalidParameter(resp, req, "scopes")
+				return
+			}
+			scopes = append(scopes, scope)
+		}
+	}
+
+	var expires *time.Time
+	expiresStr, err := StringParameter(params, "expires")
+	switch err.(type) {
+	case nil:
+		t, err := time.Parse(time.RFC3339, expiresStr)
+		if err != nil || t.Before(time.Now()) {
+			InvalidParameter(resp, req, "expires")
+			return
+		}
+		t = t.UTC()
+		expires = &t
+	case InvalidParameterError:
+		InvalidParameter(resp, req, "expires")
+		return
+	}
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+
+	token, at, err := model.CreateAccessToken(user.Id, name, scopes, expires)
+	if err == model.ErrTooManyTokens {
+		jsonapi.Error(resp, 409, err)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{
+		"accessToken": token,
+		"token":       at,
+	})
+}
+
+// Revoke one of the caller's access tokens.
+func TokenRevoke(resp http.ResponseWriter, req *http.Request) {
+	tokenid := mux.Vars(req)["id"]
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+
+	err = model.RevokeAccessToken(user.Id, tokenid)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, nil)
+}
@@ -0,0 +1,51 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// token_test.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bmatsuo/mtrack/model"
+	"github.com/gorilla/mux"
+)
+
+func TestRequiredScope(t *testing.T) {
+	var scope model.Scope
+	record := func(resp http.ResponseWriter, req *http.Request) {
+		scope = requiredScope(req)
+	}
+	router := mux.NewRouter()
+	router.Path("/api/media").HandlerFunc(record)
+	router.Path("/api/start").HandlerFunc(record)
+	router.Path("/api/media/{id}/stream_url").HandlerFunc(record)
+	router.Path("/api/tokens").HandlerFunc(record)
+
+	for _, test := range []struct {
+		method, path string
+		scope        model.Scope
+	}{
+		{"GET", "/api/media", model.ScopeRead},
+		{"HEAD", "/api/media", model.ScopeRead},
+		{"POST", "/api/start", model.ScopeProgressWrite},
+		{"POST", "/api/media/abc/stream_url", model.ScopeRead},
+		{"GET", "/api/tokens", model.ScopeRead},
+		{"POST", "/api/tokens", model.ScopeAll},
+		{"DELETE", "/api/tokens", model.ScopeAll},
+	} {
+		scope = ""
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		if scope != test.scope {
+			t.Errorf("%s %s: scope %q (expected %q)", test.method, test.path, scope, test.scope)
+		}
+	}
+}
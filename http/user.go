@@ -0,0 +1,503 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// user.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/bmatsuo/mtrack/http/jsonapi"
+	"github.com/bmatsuo/mtrack/model"
+	"github.com/gorilla/mux"
+)
+
+// the account details shown to a user and to user administrators. emails are
+// otherwise kept private.
+func userJSON(u *model.User) (jsonapi.Map, error) {
+	perms, err := model.UserPermissions(u.Id)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := model.UserRoles(u.Id)
+	if err != nil {
+		return nil, err
+	}
+	return jsonapi.Map{
+		"userId":      u.Id,
+		"username":    u.Username,
+		"email":       u.Email,
+		"created":     u.Created,
+		"permissions": perms,
+		"roles":       roles,
+	}, nil
+}
+
+// Whether user may act on the account of target with perm. Only admins may
+// act on the accounts of admins, so that managing users is not a way to
+// become one.
+func canManageUser(user *model.User, target string, perm model.Permission) (bool, error) {
+	ok, err := model.UserHasAnyPermission(user.Id, perm, model.PermAdmin)
+	if err != nil || !ok {
+		return false, err
+	}
+	admin, err := model.UserHasPermission(target, model.PermAdmin)
+	if err != nil {
+		return false, err
+	}
+	if !admin {
+		return true, nil
+	}
+	return model.UserHasPermission(user.Id, model.PermAdmin)
+}
+
+// All users. Requires PermUserList.
+func UserIndex(resp http.ResponseWriter, req *http.Request) {
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	ok, err := model.UserHasAnyPermission(user.Id, model.PermUserList, model.PermAdmin)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if !ok {
+		Forbidden(resp, req)
+		return
+	}
+
+	users, err := model.AllUsers()
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	results := make([]jsonapi.Map, len(users))
+	for i, u := range users {
+		results[i], err = userJSON(u)
+		if err != nil {
+			InternalError(resp, req, err)
+			return
+		}
+	}
+	jsonapi.Success(resp, jsonapi.Map{
+		"results": results,
+	})
+}
+
+// Create a user. The request contains a username and password for a local
+// login, an email for a user who logs in with OIDC, or both. Requires
+// PermUserCreate.
+func UserCreate(resp http.ResponseWriter, req *http.Request) {
+	params, err := jsonapi.Read(req)
+	if err == jsonapi.ErrNotJson {
+		NotJson(resp, req)
+		return
+	}
+	if err != nil {
+		InvalidJson(resp, req, err)
+		return
+	}
+
+	username, err := StringParameter(params, "username")
+	if _, ok := err.(InvalidParameterError); ok {
+		InvalidParameter(resp, req, "username")
+		return
+	}
+	email, err := StringParameter(params, "email")
+	if _, ok := err.(InvalidParameterError); ok {
+		InvalidParameter(resp, req, "email")
+		return
+	}
+	var password string
+	if username != "" {
+		password, err = StringParameter(params, "password")
+		switch err.(type) {
+		case MissingParameterError:
+			MissingParameter(resp, req, "password")
+			return
+		case InvalidParameterError:
+			InvalidParameter(resp, req, "password")
+			return
+		}
+	} else if email == "" {
+		MissingParameter(resp, req, "username")
+		return
+	}
+	if email != "" && !strings.Contains(email, "@") {
+		InvalidParameter(resp, req, "email")
+		return
+	}
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	ok, err := model.UserHasAnyPermission(user.Id, model.PermUserCreate, model.PermAdmin)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if !ok {
+		Forbidden(resp, req)
+		return
+	}
+
+	if email != "" {
+		_, err := model.FindUserByName(email)
+		if err == nil {
+			jsonapi.Error(resp, 409, model.ErrEmailTaken)
+			return
+		}
+		if err != sql.ErrNoRows {
+			InternalError(resp, req, err)
+			return
+		}
+	}
+	var userid string
+	if username != "" {
+		userid, err = model.CreateLocalUser(username, password)
+		if err == nil && email != "" {
+			err = model.SetUserEmail(userid, email)
+		}
+	} else {
+		userid, err = model.LocateOrCreateUserByEmail(email)
+	}
+	switch err {
+	case nil:
+	case model.ErrInvalidUsername:
+		InvalidParameter(resp, req, "username")
+		return
+	case model.ErrInvalidEmail:
+		InvalidParameter(resp, req, "email")
+		return
+	case model.ErrUsernameTaken, model.ErrEmailTaken:
+		jsonapi.Error(resp, 409, err)
+		return
+	case model.ErrWeakPassword, model.ErrLongPassword:
+		jsonapi.Error(resp, 400, err)
+		return
+	default:
+		InternalError(resp, req, err)
+		return
+	}
+
+	created, err := model.FindUser(userid)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	js, err := userJSON(created)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, js)
+}
+
+// A user's account. Users can see their own; others require PermUserRead.
+func UserShow(resp http.ResponseWriter, req *http.Request) {
+	userid := mux.Vars(req)["id"]
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	if user.Id != userid {
+		ok, err := model.UserHasAnyPermission(user.Id, model.PermUserRead, model.PermAdmin)
+		if err != nil {
+			InternalError(resp, req, err)
+			return
+		}
+		if !ok {
+			Forbidden(resp, req)
+			return
+		}
+	}
+
+	u, err := model.FindUser(userid)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	js, err := userJSON(u)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, js)
+}
+
+// Change any of a user's username, password and email. Users can update
+// their own account, giving their currentPassword to change their password or
+// email; others require PermUserUpdate, and PermAdmin for the account of an
+// admin. Emails set here are unverified and cannot be used to log in with
+// OIDC. Users without a local login log in by their email and cannot change
+// it themselves.
+func UserUpdate(resp http.ResponseWriter, req *http.Request) {
+	userid := mux.Vars(req)["id"]
+	params, err := jsonapi.Read(req)
+	if err == jsonapi.ErrNotJson {
+		NotJson(resp, req)
+		return
+	}
+	if err != nil {
+		InvalidJson(resp, req, err)
+		return
+	}
+
+	username, err := StringParameter(params, "username")
+	if _, ok := err.(InvalidParameterError); ok {
+		InvalidParameter(resp, req, "username")
+		return
+	}
+	password, err := StringParameter(params, "password")
+	if _, ok := err.(InvalidParameterError); ok {
+		InvalidParameter(resp, req, "password")
+		return
+	}
+	email, err := StringParameter(params, "email")
+	if _, ok := err.(InvalidParameterError); ok {
+		InvalidParameter(resp, req, "email")
+		return
+	}
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	if user.Id != userid {
+		ok, err := canManageUser(user, userid, model.PermUserUpdate)
+		if err != nil {
+			InternalError(resp, req, err)
+			return
+		}
+		if !ok {
+			Forbidden(resp, req)
+			return
+		}
+	}
+
+	u, err := model.FindUser(userid)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if username != "" && u.Username == "" && password == "" {
+		MissingParameter(resp, req, "password")
+		return
+	}
+	if email != "" && user.Id == userid && u.Username == "" {
+		Forbidden(resp, req)
+		return
+	}
+	// a stolen session is not enough to take over an account.
+	if (password != "" || email != "") && user.Id == userid && u.Username != "" {
+		current, err := StringParameter(params, "currentPassword")
+		if err != nil {
+			MissingParameter(resp, req, "currentPassword")
+			return
+		}
+		_, err = model.AuthenticateLocalUser(u.Username, current)
+		if err == model.ErrInvalidLogin {
+			Forbidden(resp, req)
+			return
+		}
+		if err != nil {
+			InternalError(resp, req, err)
+			return
+		}
+	}
+	if username != "" && u.Username != "" {
+		err = model.RenameUser(userid, username)
+	}
+	if err == nil && password != "" {
+		if username == "" {
+			username = u.Username
+		}
+		err = model.SetUserPassword(userid, username, password)
+	}
+	if err == nil && email != "" {
+		err = model.SetUserEmail(userid, email)
+	}
+	switch err {
+	case nil:
+	case model.ErrInvalidUsername:
+		InvalidParameter(resp, req, "username")
+		return
+	case model.ErrInvalidEmail:
+		InvalidParameter(resp, req, "email")
+		return
+	case model.ErrUsernameTaken, model.ErrEmailTaken:
+		jsonapi.Error(resp, 409, err)
+		return
+	case model.ErrWeakPassword, model.ErrLongPassword:
+		jsonapi.Error(resp, 400, err)
+		return
+	default:
+		InternalError(resp, req, err)
+		return
+	}
+
+	u, err = model.FindUser(userid)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	js, err := userJSON(u)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, js)
+}
+
+// Delete a user and everything they have recorded. Requires PermUserDelete,
+// and PermAdmin to delete an admin. Users cannot delete themselves, so an
+// admin cannot lock everyone out.
+func UserDelete(resp http.ResponseWriter, req *http.Request) {
+	userid := mux.Vars(req)["id"]
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	ok, err := canManageUser(user, userid, model.PermUserDelete)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if !ok || user.Id == userid {
+		Forbidden(resp, req)
+		return
+	}
+
+	err = model.DeleteUser(userid)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, nil)
+}
+
+// Grant (PUT) or revoke (DELETE) a permission. Requires PermAdmin.
+func UserPermission(resp http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	userid := vars["id"]
+	perm, err := model.ParsePermission(vars["perm"])
+	if err != nil {
+		NotFound(resp, req)
+		return
+	}
+
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return
+	}
+	ok, err := model.UserHasPermission(user.Id, model.PermAdmin)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if !ok {
+		Forbidden(resp, req)
+		return
+	}
+
+	_, err = model.FindUser(userid)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	if req.Method == "DELETE" {
+		err = model.RevokePermission(userid, perm)
+	} else {
+		err = model.GrantPermission(userid, perm)
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	perms, err := model.UserPermissions(userid)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{
+		"permissions": perms,
+	})
+}
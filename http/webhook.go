@@ -0,0 +1,240 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// webhook.go [created: Sun, 18 Oct 2026]
+
+package http
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/bmatsuo/mtrack/http/jsonapi"
+	"github.com/bmatsuo/mtrack/model"
+	"github.com/bmatsuo/mtrack/webhook"
+	"github.com/gorilla/mux"
+)
+
+// The default and maximum number of deliveries in a webhook's delivery log.
+const (
+	DeliveryLimit    = 100
+	MaxDeliveryLimit = 1000
+)
+
+// authorize an admin for the webhook api. false is returned if a response
+// has been written.
+func authorizeAdmin(resp http.ResponseWriter, req *http.Request) bool {
+	user, err := AuthorizeUser(req)
+	if err == ErrUnauthorized {
+		Unauthorized(resp, req)
+		return false
+	}
+	if err == ErrInsufficientScope {
+		Forbidden(resp, req)
+		return false
+	}
+	if err != nil {
+		BadAuthorization(resp, req)
+		return false
+	}
+	ok, err := model.UserHasPermission(user.Id, model.PermAdmin)
+	if err != nil {
+		InternalError(resp, req, err)
+		return false
+	}
+	if !ok {
+		Forbidden(resp, req)
+		return false
+	}
+	return true
+}
+
+// All webhooks. Requires PermAdmin. Secrets are never returned.
+func WebhookIndex(resp http.ResponseWriter, req *http.Request) {
+	if !authorizeAdmin(resp, req) {
+		return
+	}
+
+	hooks, err := model.AllWebhooks()
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{"results": hooks})
+}
+
+// Create a webhook. Requires PermAdmin. The request gives the url and may
+// give a secret, a list of event types, a root path and a user id to filter
+// on. The secret, generated if not given, is only returned here.
+func WebhookCreate(resp http.ResponseWriter, req *http.Request) {
+	params, err := jsonapi.Read(req)
+	if err == jsonapi.ErrNotJson {
+		NotJson(resp, req)
+		return
+	}
+	if err != nil {
+		InvalidJson(resp, req, err)
+		return
+	}
+
+	url, err := StringParameter(params, "url")
+	switch err.(type) {
+	case MissingParameterError:
+		MissingParameter(resp, req, "url")
+		return
+	case InvalidParameterError:
+		InvalidParameter(resp, req, "url")
+		return
+	}
+	optional := make(map[string]string)
+	for _, name := range []string{"secret", "root", "userId"} {
+		val, err := StringParameter(params, name)
+		if _, ok := err.(InvalidParameterError); ok {
+			InvalidParameter(resp, req, name)
+			return
+		}
+		optional[name] = val
+	}
+	var events []string
+	if js, ok := params.CheckGet("events"); ok {
+		events, err = js.StringArray()
+		if err != nil {
+			InvalidParameter(resp, req, "events")
+			return
+		}
+	}
+
+	if !authorizeAdmin(resp, req) {
+		return
+	}
+
+	hook, err := model.CreateWebhook(url, optional["secret"], events, optional["root"], optional["userId"])
+	if err == model.ErrInvalidWebhookURL {
+		InvalidParameter(resp, req, "url")
+		return
+	}
+	if err == model.ErrInvalidEventType {
+		InvalidParameter(resp, req, "events")
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{
+		"webhook": hook,
+		"secret":  hook.Secret,
+	})
+}
+
+// A webhook. Requires PermAdmin.
+func WebhookShow(resp http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+
+	if !authorizeAdmin(resp, req) {
+		return
+	}
+
+	hook, err := model.FindWebhook(id)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{"webhook": hook})
+}
+
+// Delete a webhook and its delivery log. Requires PermAdmin.
+func WebhookDelete(resp http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+
+	if !authorizeAdmin(resp, req) {
+		return
+	}
+
+	err := model.DeleteWebhook(id)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, nil)
+}
+
+// The delivery log of a webhook, most recent first. Requires PermAdmin. The
+// query parameter state may be "pending", "delivered" or "dead" and limit
+// bounds the number of deliveries returned.
+func WebhookDeliveryIndex(resp http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+	query := req.URL.Query()
+	state := query.Get("state")
+	switch state {
+	case "", model.DeliveryPending, model.DeliveryDelivered, model.DeliveryDead:
+	default:
+		InvalidParameter(resp, req, "state")
+		return
+	}
+	limit := DeliveryLimit
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > MaxDeliveryLimit {
+			InvalidParameter(resp, req, "limit")
+			return
+		}
+		limit = n
+	}
+
+	if !authorizeAdmin(resp, req) {
+		return
+	}
+
+	_, err := model.FindWebhook(id)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	deliveries, err := model.WebhookDeliveries(id, state, limit)
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	jsonapi.Success(resp, jsonapi.Map{"results": deliveries})
+}
+
+// Attempt a dead delivery again. Requires PermAdmin.
+func WebhookDeliveryRetry(resp http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	deliveryid, err := strconv.ParseInt(vars["delivery"], 10, 64)
+	if err != nil {
+		NotFound(resp, req)
+		return
+	}
+
+	if !authorizeAdmin(resp, req) {
+		return
+	}
+
+	err = model.RequeueWebhookDelivery(vars["id"], deliveryid)
+	if err == sql.ErrNoRows {
+		NotFound(resp, req)
+		return
+	}
+	if err != nil {
+		InternalError(resp, req, err)
+		return
+	}
+	webhook.DefaultDispatcher.Wake()
+	jsonapi.Success(resp, nil)
+}
@@ -0,0 +1,157 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// history.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Kinds of WatchEvent.
+const (
+	EventStarted  = "started"
+	EventFinished = "finished"
+	EventCleared  = "cleared"
+	EventPosition = "position"
+)
+
+// Position events are recorded at most once per PositionEventInterval for a
+// user and media. Heartbeats between them only update UserStartedMedia.
+var PositionEventInterval = 5 * time.Minute
+
+// An entry in a user's append-only watch history.
+type WatchEvent struct {
+	Id       int64     `json:"eventId"`
+	UserId   string    `json:"userId"`
+	MediaId  string    `json:"mediaId"`
+	Event    string    `json:"event"`
+	Position float64   `json:"position,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// A summary of the times a user has finished a media file.
+type WatchStats struct {
+	MediaId      string    `json:"mediaId"`
+	Watches      int       `json:"watches"`
+	Rewatches    int       `json:"rewatches"`
+	FirstWatched time.Time `json:"firstWatched"`
+	LastWatched  time.Time `json:"lastWatched"`
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func recordWatchEvent(db execer, userid, mediaid, event string, position float64) error {
+	q := `INSERT INTO WatchEvents (UserId, MediaId, Event, Position) VALUES (?, ?, ?, ?)`
+	_, err := db.Exec(q, userid, mediaid, event, position)
+	return err
+}
+
+// record a position event unless one was recorded recently.
+func recordPositionEvent(tx *sql.Tx, userid, mediaid string, position float64) error {
+	q := `SELECT COUNT(*) FROM WatchEvents
+		WHERE UserId = ? AND MediaId = ? AND Event = ? AND Time > ?`
+	since := time.Now().Add(-PositionEventInterval)
+	var count int
+	err := tx.QueryRow(q, userid, mediaid, EventPosition, dbTime(since)).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return recordWatchEvent(tx, userid, mediaid, EventPosition, position)
+}
+
+// WatchEvents times are stored by sqlite as UTC with second precision.
+const dbTimeFormat = "2006-01-02 15:04:05"
+
+func dbTime(t time.Time) string {
+	return t.UTC().Format(dbTimeFormat)
+}
+
+// The events in a user's history between since and until, most recent first.
+// Zero times leave the range open and a limit less than one returns all
+// events.
+func UserHistory(userid string, since, until time.Time, limit int) ([]*WatchEvent, error) {
+	q := `SELECT EventId, UserId, MediaId, Event, Position, Time
+		FROM WatchEvents
+		WHERE UserId = ?`
+	args := []interface{}{userid}
+	if !since.IsZero() {
+		q += ` AND Time >= ?`
+		args = append(args, dbTime(since))
+	}
+	if !until.IsZero() {
+		q += ` AND Time < ?`
+		args = append(args, dbTime(until))
+	}
+	q += ` ORDER BY Time DESC, EventId DESC`
+	if limit > 0 {
+		q += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := DB.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := make([]*WatchEvent, 0, 20)
+	for rows.Next() {
+		e := new(WatchEvent)
+		err := rows.Scan(&e.Id, &e.UserId, &e.MediaId, &e.Event, &e.Position, &e.Time)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Watch counts for each media file the user has finished, most recently
+// watched first.
+func UserWatchStats(userid string) ([]*WatchStats, error) {
+	rows, err := DB.Query(`
+		SELECT MediaId, Time
+		FROM WatchEvents
+		WHERE UserId = ? AND Event = ?
+		ORDER BY Time DESC, EventId DESC
+	`, userid, EventFinished)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := make([]*WatchStats, 0, 20)
+	index := make(map[string]*WatchStats)
+	for rows.Next() {
+		var mediaid string
+		var t time.Time
+		err := rows.Scan(&mediaid, &t)
+		if err != nil {
+			return nil, err
+		}
+		s := index[mediaid]
+		if s == nil {
+			s = &WatchStats{MediaId: mediaid, LastWatched: t}
+			index[mediaid] = s
+			stats = append(stats, s)
+		}
+		s.Watches++
+		s.Rewatches = s.Watches - 1
+		s.FirstWatched = t
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
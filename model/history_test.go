@@ -0,0 +1,75 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// history_test.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchHistory(t *testing.T) {
+	DBTest(t, func() {
+		userid, err := LocateOrCreateUserByEmail("test@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		mod := time.Date(2013, 8, 3, 12, 0, 0, 0, time.UTC)
+		id, _ := testSyncMedia(t, "/media", "/media/a.mkv", 10, mod)
+
+		for i := 0; i < 2; i++ {
+			err = StartMedia(userid, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = FinishMedia(userid, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = ClearProgress(userid, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		events, err := UserHistory(userid, time.Time{}, time.Time{}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := []string{EventCleared, EventFinished, EventStarted, EventFinished, EventStarted}
+		if len(events) != len(expect) {
+			t.Fatalf("events: %d (expected %d)", len(events), len(expect))
+		}
+		for i := range expect {
+			if events[i].Event != expect[i] {
+				t.Errorf("event %d: %q (expected %q)", i, events[i].Event, expect[i])
+			}
+		}
+
+		events, err = UserHistory(userid, time.Time{}, time.Time{}, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 {
+			t.Errorf("limited events: %d", len(events))
+		}
+		events, err = UserHistory(userid, time.Now().Add(time.Hour), time.Time{}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 0 {
+			t.Errorf("future events: %d", len(events))
+		}
+
+		stats, err := UserWatchStats(userid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stats) != 1 || stats[0].Watches != 2 || stats[0].Rewatches != 1 {
+			t.Errorf("stats: %+v", stats)
+		}
+	})
+}
@@ -0,0 +1,505 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// list.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+var ErrInvalidSort = errors.New("invalid sort key")
+var ErrInvalidStatus = errors.New("invalid watch status")
+
+// The number of results in a page when ListOptions.Limit is zero, and the
+// largest limit allowed.
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// A user's progress on a media file.
+type WatchStatus string
+
+const (
+	StatusUnwatched  WatchStatus = "unwatched"
+	StatusInProgress WatchStatus = "in_progress"
+	StatusFinished   WatchStatus = "finished"
+)
+
+func ParseWatchStatus(s string) (WatchStatus, error) {
+	switch status := WatchStatus(s); status {
+	case StatusUnwatched, StatusInProgress, StatusFinished:
+		return status, nil
+	}
+	return "", ErrInvalidStatus
+}
+
+// Filters, ordering and the page of a listing. Zero values do not filter.
+// Times ranges include Since and exclude Until.
+type ListOptions struct {
+	// Roots restricts results to media in the given roots when it is not
+	// nil. An empty, non-nil slice lists nothing.
+	Roots []string
+	Root  string
+
+	// UserId restricts progress to a user. Listing media, Status is the
+	// user's progress on the media and if Status is empty only media the
+	// user has started or finished is listed.
+	UserId string
+	Status WatchStatus
+
+	ModifiedSince time.Time
+	ModifiedUntil time.Time
+	CreatedSince  time.Time
+	CreatedUntil  time.Time
+
+	// Sort is one of the listing's sort keys, prefixed with "-" for
+	// descending order. An empty Sort uses the listing's default order.
+	Sort string
+
+	// Cursor is the next cursor returned with the previous page.
+	Cursor string
+	Limit  int
+}
+
+// A query over rows that each concern one media file, joined as Media.
+type listing struct {
+	columns  string
+	from     string
+	fromArgs []interface{} // for placeholders in from
+	where    string
+
+	// an expression unique to each row, ordering rows with equal sort
+	// values.
+	key string
+
+	sorts       map[string]string
+	defaultSort string
+
+	user   string // the UserId column, empty if rows are not owned by users
+	status func(status WatchStatus, userid string) (string, []interface{}, error)
+}
+
+// the position of a page in a listing.
+type cursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v"`
+	Key   string      `json:"k"`
+}
+
+func encodeCursor(c *cursor) string {
+	if p, ok := c.Value.([]byte); ok {
+		c.Value = string(p)
+	}
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := new(cursor)
+	err = json.Unmarshal(js, c)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	switch c.Value.(type) {
+	case string, float64:
+	default:
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func (l *listing) query(opt *ListOptions, limit int) (string, []interface{}, string, error) {
+	sort := opt.Sort
+	if sort == "" {
+		sort = l.defaultSort
+	}
+	desc := strings.HasPrefix(sort, "-")
+	expr, ok := l.sorts[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		return "", nil, "", ErrInvalidSort
+	}
+
+	var conds []string
+	args := append([]interface{}(nil), l.fromArgs...)
+	if l.where != "" {
+		conds = append(conds, l.where)
+	}
+	if len(opt.Roots) > 0 {
+		marks := strings.TrimSuffix(strings.Repeat("?, ", len(opt.Roots)), ", ")
+		conds = append(conds, `Media.Root IN (`+marks+`)`)
+		for _, root := range opt.Roots {
+			args = append(args, root)
+		}
+	}
+	if opt.Root != "" {
+		conds = append(conds, `Media.Root = ?`)
+		args = append(args, opt.Root)
+	}
+	if opt.UserId != "" && l.user != "" {
+		conds = append(conds, l.user+` = ?`)
+		args = append(args, opt.UserId)
+	}
+	if opt.Status != "" || (opt.UserId != "" && l.user == "") {
+		if l.status == nil {
+			return "", nil, "", ErrInvalidStatus
+		}
+		cond, condargs, err := l.status(opt.Status, opt.UserId)
+		if err != nil {
+			return "", nil, "", err
+		}
+		if cond != "" {
+			conds = append(conds, cond)
+			args = append(args, condargs...)
+		}
+	}
+	for _, r := range []struct {
+		col   string
+		since time.Time
+		until time.Time
+	}{
+		{"Media.ModTime", opt.ModifiedSince, opt.ModifiedUntil},
+		{"Media.Created", opt.CreatedSince, opt.CreatedUntil},
+	} {
+		// stored times are in mixed formats and time zones.
+		if !r.since.IsZero() {
+			conds = append(conds, `julianday(`+r.col+`) >= julianday(?)`)
+			args = append(args, dbTime(r.since))
+		}
+		if !r.until.IsZero() {
+			conds = append(conds, `julianday(`+r.col+`) < julianday(?)`)
+			args = append(args, dbTime(r.until))
+		}
+	}
+	order, cmp := "ASC", ">"
+	if desc {
+		order, cmp = "DESC", "<"
+	}
+	if opt.Cursor != "" {
+		c, err := decodeCursor(opt.Cursor)
+		if err != nil {
+			return "", nil, "", err
+		}
+		if c.Sort != sort {
+			return "", nil, "", ErrInvalidCursor
+		}
+		conds = append(conds, `(`+expr+`, `+l.key+`) `+cmp+` (?, ?)`)
+		args = append(args, c.Value, c.Key)
+	}
+
+	q := `SELECT ` + l.columns + `, ` + expr + ` AS ListSort, ` + l.key + ` AS ListKey
+		FROM ` + l.from
+	if len(conds) > 0 {
+		q += `
+		WHERE ` + strings.Join(conds, ` AND `)
+	}
+	q += `
+		ORDER BY ListSort ` + order + `, ListKey ` + order + `
+		LIMIT ?`
+	// one more row tells whether there is another page.
+	args = append(args, limit+1)
+	return q, args, sort, nil
+}
+
+// Run the listing, calling scan with each row of the page and pointers to
+// the extra columns that follow l.columns. The cursor of the next page is
+// returned, or an empty string if this is the last page.
+func (l *listing) list(opt *ListOptions, scan func(row rowScanner, extra ...interface{}) error) (string, error) {
+	limit := opt.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	q, args, sort, err := l.query(opt, limit)
+	if err != nil {
+		return "", err
+	}
+	if opt.Roots != nil && len(opt.Roots) == 0 {
+		return "", nil
+	}
+	rows, err := DB.Query(q, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	last := &cursor{Sort: sort}
+	for n := 0; rows.Next(); n++ {
+		if n == limit {
+			return encodeCursor(last), nil
+		}
+		err := scan(rows, &last.Value, &last.Key)
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", rows.Err()
+}
+
+// conditions on a user's progress on Media.
+func mediaStatus(status WatchStatus, userid string) (string, []interface{}, error) {
+	if userid == "" {
+		return "", nil, ErrInvalidStatus
+	}
+	started := `EXISTS (SELECT 1 FROM UserStartedMedia AS S
+		WHERE S.MediaId = Media.MediaId AND S.UserId = ?)`
+	finished := `EXISTS (SELECT 1 FROM UserFinishedMedia AS F
+		WHERE F.MediaId = Media.MediaId AND F.UserId = ?)`
+	switch status {
+	case "":
+		return `(` + started + ` OR ` + finished + `)`, []interface{}{userid, userid}, nil
+	case StatusUnwatched:
+		return `NOT ` + started + ` AND NOT ` + finished, []interface{}{userid, userid}, nil
+	case StatusInProgress:
+		return started, []interface{}{userid}, nil
+	case StatusFinished:
+		return finished, []interface{}{userid}, nil
+	}
+	return "", nil, ErrInvalidStatus
+}
+
+var mediaListing = &listing{
+	columns: mediaColumns,
+	from:    `Media`,
+	where:   `Media.Missing IS NULL`,
+	key:     `Media.MediaId`,
+	sorts: map[string]string{
+		"modified": `julianday(Media.ModTime)`,
+		"created":  `julianday(Media.Created)`,
+		"path":     `Media.PathNorm`,
+		"size":     `Media.Size`,
+	},
+	defaultSort: "-modified",
+	status:      mediaStatus,
+}
+
+// A page of media that is not missing, most recently modified first unless
+// opt gives another order. The cursor of the next page is returned with it.
+func ListMedia(opt *ListOptions) ([]*Media, string, error) {
+	ms := make([]*Media, 0, 20)
+	next, err := mediaListing.list(opt, func(row rowScanner, extra ...interface{}) error {
+		m, err := scanMediaRow(row, extra...)
+		if err != nil {
+			return err
+		}
+		ms = append(ms, m)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return ms, next, nil
+}
+
+var inProgressListing = &listing{
+	columns: `S.MediaId, S.UserId, S.Started, S.Position, S.Updated, Media.Root`,
+	from:    `UserStartedMedia AS S JOIN Media ON Media.MediaId = S.MediaId`,
+	key:     `S.UserId || ':' || S.MediaId`,
+	sorts: map[string]string{
+		"started": `julianday(S.Started)`,
+		"updated": `julianday(COALESCE(S.Updated, S.Started))`,
+		"path":    `Media.PathNorm`,
+	},
+	defaultSort: "-started",
+	user:        `S.UserId`,
+}
+
+// A page of started media, most recently started first unless opt gives
+// another order.
+func ListInProgress(opt *ListOptions) ([]*ActionStarted, string, error) {
+	as := make([]*ActionStarted, 0, 20)
+	next, err := inProgressListing.list(opt, func(row rowScanner, extra ...interface{}) error {
+		a := new(ActionStarted)
+		dest := []interface{}{&a.MediaId, &a.UserId, &a.StartTime, &a.Position, &a.Updated, &a.Root}
+		err := row.Scan(append(dest, extra...)...)
+		if err != nil {
+			return err
+		}
+		as = append(as, a)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return as, next, nil
+}
+
+var finishedListing = &listing{
+	columns: `F.MediaId, F.UserId, F.Finished, Media.Root`,
+	from:    `UserFinishedMedia AS F JOIN Media ON Media.MediaId = F.MediaId`,
+	key:     `F.UserId || ':' || F.MediaId`,
+	sorts: map[string]string{
+		"finished": `julianday(F.Finished)`,
+		"path":     `Media.PathNorm`,
+	},
+	defaultSort: "-finished",
+	user:        `F.UserId`,
+}
+
+// A page of finished media, most recently finished first unless opt gives
+// another order.
+func ListFinished(opt *ListOptions) ([]*ActionFinished, string, error) {
+	as := make([]*ActionFinished, 0, 20)
+	next, err := finishedListing.list(opt, func(row rowScanner, extra ...interface{}) error {
+		a := new(ActionFinished)
+		dest := []interface{}{&a.MediaId, &a.UserId, &a.FinishTime, &a.Root}
+		err := row.Scan(append(dest, extra...)...)
+		if err != nil {
+			return err
+		}
+		as = append(as, a)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return as, next, nil
+}
+
+// Media annotated with a user's progress on it. LastWatched is when the user
+// last started, updated the position of, or finished the media.
+type UserMedia struct {
+	*Media
+	Status      WatchStatus `json:"status"`
+	Position    float64     `json:"position"`
+	LastWatched *time.Time  `json:"lastWatched,omitempty"`
+}
+
+func userMediaListing(userid string) *listing {
+	return &listing{
+		columns: mediaColumns + `,
+			COALESCE(S.Position, 0), S.Started, S.Updated, F.Finished`,
+		from: `Media
+			LEFT JOIN UserStartedMedia AS S
+				ON S.MediaId = Media.MediaId AND S.UserId = ?
+			LEFT JOIN UserFinishedMedia AS F
+				ON F.MediaId = Media.MediaId AND F.UserId = ?`,
+		fromArgs: []interface{}{userid, userid},
+		where:    `Media.Missing IS NULL`,
+		key:      `Media.MediaId`,
+		sorts: map[string]string{
+			"modified": `julianday(Media.ModTime)`,
+			"created":  `julianday(Media.Created)`,
+			"path":     `Media.PathNorm`,
+			"size":     `Media.Size`,
+			"watched":  `COALESCE(julianday(COALESCE(F.Finished, S.Updated, S.Started)), 0)`,
+		},
+		defaultSort: "-modified",
+		status: func(status WatchStatus, _ string) (string, []interface{}, error) {
+			switch status {
+			case "":
+				return "", nil, nil
+			case StatusUnwatched:
+				return `F.MediaId IS NULL AND S.MediaId IS NULL`, nil, nil
+			case StatusInProgress:
+				return `S.MediaId IS NOT NULL`, nil, nil
+			case StatusFinished:
+				return `F.MediaId IS NOT NULL`, nil, nil
+			}
+			return "", nil, ErrInvalidStatus
+		},
+	}
+}
+
+// A page of media that is not missing, annotated with the user's progress.
+// The media is ordered and filtered like ListMedia, except that opt.UserId
+// is ignored and opt.Status refers to userid.
+func ListUserMedia(userid string, opt *ListOptions) ([]*UserMedia, string, error) {
+	ums := make([]*UserMedia, 0, 20)
+	next, err := userMediaListing(userid).list(opt, func(row rowScanner, extra ...interface{}) error {
+		um := &UserMedia{Status: StatusUnwatched}
+		var started, updated, finished *time.Time
+		dest := []interface{}{&um.Position, &started, &updated, &finished}
+		m, err := scanMediaRow(row, append(dest, extra...)...)
+		if err != nil {
+			return err
+		}
+		um.Media = m
+		switch {
+		case finished != nil:
+			um.Status = StatusFinished
+			um.LastWatched = finished
+		case updated != nil:
+			um.Status = StatusInProgress
+			um.LastWatched = updated
+		case started != nil:
+			um.Status = StatusInProgress
+			um.LastWatched = started
+		}
+		ums = append(ums, um)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return ums, next, nil
+}
+
+// started and finished media in one listing, distinguished by Kind.
+var progressListing = &listing{
+	columns: `P.Kind, P.MediaId, P.UserId, P.Time, P.Position, P.Updated, Media.Root`,
+	from: `(
+			SELECT 'started' AS Kind, MediaId, UserId, Started AS Time, Position, Updated
+			FROM UserStartedMedia
+			UNION ALL
+			SELECT 'finished', MediaId, UserId, Finished, 0, NULL
+			FROM UserFinishedMedia
+		) AS P
+		JOIN Media ON Media.MediaId = P.MediaId`,
+	key: `P.Kind || ':' || P.UserId || ':' || P.MediaId`,
+	sorts: map[string]string{
+		"time": `julianday(P.Time)`,
+		"path": `Media.PathNorm`,
+	},
+	defaultSort: "-time",
+	user:        `P.UserId`,
+	status: func(status WatchStatus, userid string) (string, []interface{}, error) {
+		switch status {
+		case StatusInProgress:
+			return `P.Kind = 'started'`, nil, nil
+		case StatusFinished:
+			return `P.Kind = 'finished'`, nil, nil
+		}
+		return "", nil, ErrInvalidStatus
+	},
+}
+
+// A page of started and finished media, most recent first unless opt gives
+// another order. Each result is an *ActionStarted or an *ActionFinished.
+func ListProgress(opt *ListOptions) ([]interface{}, string, error) {
+	as := make([]interface{}, 0, 20)
+	next, err := progressListing.list(opt, func(row rowScanner, extra ...interface{}) error {
+		var kind, mediaid, userid, root string
+		var t time.Time
+		var position float64
+		var updated *time.Time
+		dest := []interface{}{&kind, &mediaid, &userid, &t, &position, &updated, &root}
+		err := row.Scan(append(dest, extra...)...)
+		if err != nil {
+			return err
+		}
+		if kind == "finished" {
+			as = append(as, &ActionFinished{mediaid, userid, t, root})
+		} else {
+			as = append(as, &ActionStarted{mediaid, userid, t, position, updated, root})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return as, next, nil
+}
@@ -0,0 +1,205 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// list_test.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListMedia(t *testing.T) {
+	DBTest(t, func() {
+		userid, err := LocateOrCreateUserByEmail("test@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		base := time.Date(2013, 8, 3, 12, 0, 0, 0, time.UTC)
+		var ids []string // oldest first
+		for i := 0; i < 5; i++ {
+			root := "/a"
+			if i%2 == 1 {
+				root = "/b"
+			}
+			path := fmt.Sprintf("%s/%d.mkv", root, i)
+			id, _ := testSyncMedia(t, root, path, int64(10-i), base.Add(time.Duration(i)*time.Hour))
+			ids = append(ids, id)
+		}
+		err = StartMedia(userid, ids[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = FinishMedia(userid, ids[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// pages follow each other without gaps or repeats.
+		var all []string
+		opt := &ListOptions{Limit: 2}
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatalf("too many pages")
+			}
+			ms, next, err := ListMedia(opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range ms {
+				all = append(all, m.Id)
+			}
+			if next == "" {
+				break
+			}
+			opt.Cursor = next
+		}
+		want := []string{ids[4], ids[3], ids[2], ids[1], ids[0]}
+		if !reflect.DeepEqual(all, want) {
+			t.Errorf("pages: %v != %v", all, want)
+		}
+
+		for _, test := range []struct {
+			opt *ListOptions
+			ids []string
+		}{
+			{&ListOptions{Sort: "size"}, []string{ids[4], ids[3], ids[2], ids[1], ids[0]}},
+			{&ListOptions{Sort: "path"}, []string{ids[0], ids[2], ids[4], ids[1], ids[3]}},
+			{&ListOptions{Root: "/b"}, []string{ids[3], ids[1]}},
+			{&ListOptions{Roots: []string{"/b"}, Root: "/a"}, nil},
+			{&ListOptions{Roots: []string{}}, nil},
+			{&ListOptions{ModifiedSince: base.Add(time.Hour), ModifiedUntil: base.Add(3 * time.Hour)}, []string{ids[2], ids[1]}},
+			{&ListOptions{UserId: userid}, []string{ids[1], ids[0]}},
+			{&ListOptions{UserId: userid, Status: StatusInProgress}, []string{ids[0]}},
+			{&ListOptions{UserId: userid, Status: StatusFinished}, []string{ids[1]}},
+			{&ListOptions{UserId: userid, Status: StatusUnwatched}, []string{ids[4], ids[3], ids[2]}},
+		} {
+			ms, next, err := ListMedia(test.opt)
+			if err != nil {
+				t.Errorf("%+v: %v", test.opt, err)
+				continue
+			}
+			var got []string
+			for _, m := range ms {
+				got = append(got, m.Id)
+			}
+			if next != "" || !reflect.DeepEqual(got, test.ids) {
+				t.Errorf("%+v: %v %q", test.opt, got, next)
+			}
+		}
+
+		_, next, err := ListMedia(&ListOptions{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = ListMedia(&ListOptions{Limit: 1, Sort: "path", Cursor: next})
+		if err != ErrInvalidCursor {
+			t.Errorf("cursor of another sort: %v", err)
+		}
+		_, _, err = ListMedia(&ListOptions{Sort: "color"})
+		if err != ErrInvalidSort {
+			t.Errorf("unknown sort: %v", err)
+		}
+		_, _, err = ListMedia(&ListOptions{Status: StatusFinished})
+		if err != ErrInvalidStatus {
+			t.Errorf("status without a user: %v", err)
+		}
+
+		progress, _, err := ListProgress(&ListOptions{UserId: userid, Sort: "path"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(progress) != 2 {
+			t.Fatalf("progress: %v", progress)
+		}
+		if a, ok := progress[0].(*ActionStarted); !ok || a.MediaId != ids[0] || a.StartTime.IsZero() {
+			t.Errorf("started: %+v", progress[0])
+		}
+		if a, ok := progress[1].(*ActionFinished); !ok || a.MediaId != ids[1] || a.FinishTime.IsZero() {
+			t.Errorf("finished: %+v", progress[1])
+		}
+		progress, _, err = ListProgress(&ListOptions{Status: StatusFinished})
+		if err != nil || len(progress) != 1 {
+			t.Errorf("finished progress: %v %v", progress, err)
+		}
+		started, _, err := ListInProgress(&ListOptions{Root: "/a"})
+		if err != nil || len(started) != 1 || started[0].MediaId != ids[0] {
+			t.Errorf("in progress: %v %v", started, err)
+		}
+		finished, _, err := ListFinished(&ListOptions{Root: "/a"})
+		if err != nil || len(finished) != 0 {
+			t.Errorf("finished: %v %v", finished, err)
+		}
+	})
+}
+
+func TestListUserMedia(t *testing.T) {
+	DBTest(t, func() {
+		userid, err := LocateOrCreateUserByEmail("test@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := LocateOrCreateUserByEmail("other@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		mod := time.Date(2013, 8, 3, 12, 0, 0, 0, time.UTC)
+		a, _ := testSyncMedia(t, "/media", "/media/a.mkv", 10, mod)
+		b, _ := testSyncMedia(t, "/media", "/media/b.mkv", 10, mod.Add(time.Hour))
+		c, _ := testSyncMedia(t, "/media", "/media/c.mkv", 10, mod.Add(2*time.Hour))
+		_, err = UpdatePosition(userid, a, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = FinishMedia(userid, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = FinishMedia(other, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ums, next, err := ListUserMedia(userid, &ListOptions{Sort: "path"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ums) != 3 || next != "" {
+			t.Fatalf("media: %v %q", ums, next)
+		}
+		for i, want := range []struct {
+			id       string
+			status   WatchStatus
+			position float64
+			watched  bool
+		}{
+			{a, StatusInProgress, 42, true},
+			{b, StatusFinished, 0, true},
+			{c, StatusUnwatched, 0, false},
+		} {
+			um := ums[i]
+			if um.Id != want.id || um.Status != want.status || um.Position != want.position || (um.LastWatched != nil) != want.watched {
+				t.Errorf("%d: %+v", i, um)
+			}
+		}
+
+		ums, _, err = ListUserMedia(userid, &ListOptions{Status: StatusFinished, Sort: "-watched"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ums) != 1 || ums[0].Id != b {
+			t.Errorf("finished: %v", ums)
+		}
+		ums, _, err = ListUserMedia(userid, &ListOptions{Status: StatusUnwatched})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ums) != 1 || ums[0].Id != c {
+			t.Errorf("unwatched: %v", ums)
+		}
+	})
+}
@@ -0,0 +1,249 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// login.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidLogin = errors.New("invalid username or password")
+var ErrInvalidUsername = errors.New("invalid username")
+var ErrUsernameTaken = errors.New("username is taken")
+var ErrWeakPassword = errors.New("password is too short")
+var ErrLongPassword = errors.New("password is too long")
+var ErrSessionExpired = errors.New("session expired")
+
+// The bcrypt cost of password hashes. Existing hashes are upgraded when their
+// users log in.
+var PasswordCost = 12
+
+const (
+	MinPasswordLength = 8
+	// bcrypt ignores bytes past 72.
+	MaxPasswordLength = 72
+)
+
+// The lifetime of login sessions.
+var SessionTTL = 30 * 24 * time.Hour
+
+var validUsername = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+
+func hashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrWeakPassword
+	}
+	if len(password) > MaxPasswordLength {
+		return "", ErrLongPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func randomHex(n int) (string, error) {
+	p := make([]byte, n)
+	_, err := rand.Read(p)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", p), nil
+}
+
+// Create a user who logs in with a username and password. The new user's id
+// is returned.
+func CreateLocalUser(username, password string) (string, error) {
+	if !validUsername.MatchString(username) {
+		return "", ErrInvalidUsername
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	userid, err := randomHex(20)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	var count int
+	q := `SELECT COUNT(*) FROM UserLogins WHERE Username = ?`
+	err = tx.QueryRow(q, username).Scan(&count)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if count > 0 {
+		tx.Rollback()
+		return "", ErrUsernameTaken
+	}
+	q = `INSERT INTO Users(UserId) VALUES (?)`
+	_, err = tx.Exec(q, userid)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	q = `INSERT INTO UserLogins(UserId, Username, PasswordHash) VALUES (?, ?, ?)`
+	_, err = tx.Exec(q, userid, username, hash)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	return userid, tx.Commit()
+}
+
+// Set the password of a user, giving them a login with the given username if
+// they do not have one.
+func SetUserPassword(userid, username, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	q := `UPDATE UserLogins SET PasswordHash = ?, Updated = ? WHERE UserId = ?`
+	res, err := DB.Exec(q, hash, time.Now().UTC(), userid)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	if !validUsername.MatchString(username) {
+		return ErrInvalidUsername
+	}
+	var count int
+	q = `SELECT COUNT(*) FROM UserLogins WHERE Username = ?`
+	err = DB.QueryRow(q, username).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrUsernameTaken
+	}
+	q = `INSERT INTO UserLogins(UserId, Username, PasswordHash) VALUES (?, ?, ?)`
+	_, err = DB.Exec(q, userid, username, hash)
+	return err
+}
+
+var dummyPasswordOnce sync.Once
+var dummyPasswordHash []byte
+
+// compare password with a dummy hash, so that unknown usernames take as long to
+// reject as wrong passwords.
+func compareDummyPassword(password string) {
+	dummyPasswordOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), PasswordCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
+
+// Check a username and password. ErrInvalidLogin is returned if either is
+// incorrect.
+func AuthenticateLocalUser(username, password string) (*User, error) {
+	var userid, hash string
+	q := `SELECT UserId, PasswordHash FROM UserLogins WHERE Username = ?`
+	err := DB.QueryRow(q, username).Scan(&userid, &hash)
+	if err == sql.ErrNoRows {
+		compareDummyPassword(password)
+		return nil, ErrInvalidLogin
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return nil, ErrInvalidLogin
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cost, err := bcrypt.Cost([]byte(hash)); err == nil && cost < PasswordCost {
+		err := SetUserPassword(userid, username, password)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return FindUser(userid)
+}
+
+// A login session. The Id is only known when the session is created; the
+// database stores its hash.
+type Session struct {
+	Id        string    `json:"-"`
+	UserId    string    `json:"userId"`
+	CSRFToken string    `json:"csrfToken"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+}
+
+func sessionHash(id string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(id)))
+}
+
+// Start a session for the user, expiring after SessionTTL. Expired sessions
+// of all users are removed.
+func CreateSession(userid string) (*Session, error) {
+	s := &Session{UserId: userid}
+	var err error
+	s.Id, err = randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	s.CSRFToken, err = randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	s.Created = time.Now().UTC()
+	s.Expires = s.Created.Add(SessionTTL)
+
+	q := `DELETE FROM Sessions WHERE Expires < ?`
+	_, err = DB.Exec(q, s.Created)
+	if err != nil {
+		return nil, err
+	}
+	q = `INSERT INTO Sessions(SessionHash, UserId, CSRFToken, Created, Expires)
+		VALUES (?, ?, ?, ?, ?)`
+	_, err = DB.Exec(q, sessionHash(s.Id), s.UserId, s.CSRFToken, s.Created, s.Expires)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Find an unexpired session. sql.ErrNoRows is returned if the session does not
+// exist and ErrSessionExpired if it has expired.
+func FindSession(id string) (*Session, error) {
+	s := &Session{Id: id}
+	q := `SELECT UserId, CSRFToken, Created, Expires FROM Sessions WHERE SessionHash = ?`
+	row := DB.QueryRow(q, sessionHash(id))
+	err := row.Scan(&s.UserId, &s.CSRFToken, &s.Created, &s.Expires)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(s.Expires) {
+		return nil, ErrSessionExpired
+	}
+	return s, nil
+}
+
+func DeleteSession(id string) error {
+	q := `DELETE FROM Sessions WHERE SessionHash = ?`
+	_, err := DB.Exec(q, sessionHash(id))
+	return err
+}
@@ -0,0 +1,135 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// login_test.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	// keep the tests fast.
+	PasswordCost = bcrypt.MinCost
+}
+
+func TestLocalUser(t *testing.T) {
+	DBTest(t, func() {
+		userid, err := CreateLocalUser("alice", "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = CreateLocalUser("ALICE", "battery staple")
+		if err != ErrUsernameTaken {
+			t.Errorf("duplicate username: %v", err)
+		}
+		_, err = CreateLocalUser("bob", "short")
+		if err != ErrWeakPassword {
+			t.Errorf("short password: %v", err)
+		}
+		_, err = CreateLocalUser("../bob", "long enough")
+		if err != ErrInvalidUsername {
+			t.Errorf("invalid username: %v", err)
+		}
+
+		user, err := AuthenticateLocalUser("Alice", "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Id != userid || user.Username != "alice" {
+			t.Errorf("user: %#v", user)
+		}
+		_, err = AuthenticateLocalUser("alice", "wrong horse")
+		if err != ErrInvalidLogin {
+			t.Errorf("wrong password: %v", err)
+		}
+		_, err = AuthenticateLocalUser("carol", "correct horse")
+		if err != ErrInvalidLogin {
+			t.Errorf("unknown user: %v", err)
+		}
+
+		err = SetUserPassword(userid, "", "battery staple")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = AuthenticateLocalUser("alice", "correct horse")
+		if err != ErrInvalidLogin {
+			t.Errorf("old password: %v", err)
+		}
+		_, err = AuthenticateLocalUser("alice", "battery staple")
+		if err != nil {
+			t.Errorf("new password: %v", err)
+		}
+	})
+}
+
+func TestSetUserPasswordNewLogin(t *testing.T) {
+	DBTest(t, func() {
+		userid, err := LocateOrCreateUserByEmail("test@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = SetUserPassword(userid, "tester", "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, err := AuthenticateLocalUser("tester", "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Id != userid || user.Email != "test@example.com" {
+			t.Errorf("user: %#v", user)
+		}
+	})
+}
+
+func TestSession(t *testing.T) {
+	DBTest(t, func() {
+		userid, err := CreateLocalUser("alice", "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := CreateSession(userid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found, err := FindSession(s.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.UserId != userid || found.CSRFToken != s.CSRFToken {
+			t.Errorf("session: %#v", found)
+		}
+		_, err = FindSession(s.CSRFToken)
+		if err != sql.ErrNoRows {
+			t.Errorf("unknown session: %v", err)
+		}
+
+		err = DeleteSession(s.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = FindSession(s.Id)
+		if err != sql.ErrNoRows {
+			t.Errorf("deleted session: %v", err)
+		}
+
+		ttl := SessionTTL
+		SessionTTL = -time.Minute
+		defer func() { SessionTTL = ttl }()
+		s, err = CreateSession(userid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = FindSession(s.Id)
+		if err != ErrSessionExpired {
+			t.Errorf("expired session: %v", err)
+		}
+	})
+}
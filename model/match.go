@@ -0,0 +1,155 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// match.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+var ErrAmbiguousMedia = errors.New("several media match")
+
+// escape the LIKE wildcards in s for use with ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// the media, not missing, selected by a query returning mediaColumns.
+func queryMedia(q string, args ...interface{}) ([]*Media, error) {
+	rows, err := DB.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ms []*Media
+	for rows.Next() {
+		m, err := scanMediaRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// split a path from any platform into its elements.
+func pathElems(path string) []string {
+	path = strings.Replace(path, `\`, "/", -1)
+	var elems []string
+	for _, e := range strings.Split(path, "/") {
+		if e != "" {
+			elems = append(elems, e)
+		}
+	}
+	return elems
+}
+
+// Find media by the path of its file as another program sees it, e.g. through
+// a different mount point or on another platform. The media whose path shares
+// the longest suffix of elements with path is returned. sql.ErrNoRows is
+// returned if no media has the base name of path and ErrAmbiguousMedia if
+// several share the longest suffix.
+func MatchMediaPath(path string) (*Media, error) {
+	elems := pathElems(path)
+	if len(elems) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	base := elems[len(elems)-1]
+	sep := string(filepath.Separator)
+	ms, err := queryMedia(`
+		SELECT `+mediaColumns+`
+		FROM Media
+		WHERE Missing IS NULL AND Path LIKE ? ESCAPE '\'
+	`, "%"+escapeLike(sep+base))
+	if err != nil {
+		return nil, err
+	}
+
+	var best []*Media
+	bestn := 0
+	for _, m := range ms {
+		melems := pathElems(m.Path)
+		n := 0
+		for n < len(elems) && n < len(melems) && elems[len(elems)-1-n] == melems[len(melems)-1-n] {
+			n++
+		}
+		switch {
+		case n == 0:
+		case n > bestn:
+			best, bestn = []*Media{m}, n
+		case n == bestn:
+			best = append(best, m)
+		}
+	}
+	return onlyMedia(best)
+}
+
+// Find media by name, ignoring case. The name may be the title read from the
+// media file or the base name of its path with or without the extension.
+// sql.ErrNoRows is returned if nothing has the name and ErrAmbiguousMedia if
+// several media do.
+func MatchMediaName(name string) (*Media, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, sql.ErrNoRows
+	}
+	sep := string(filepath.Separator)
+	ms, err := queryMedia(`
+		SELECT `+mediaColumns+`
+		FROM Media
+		WHERE Missing IS NULL
+			AND (Title = ? COLLATE NOCASE OR Path LIKE ? ESCAPE '\')
+	`, name, "%"+escapeLike(sep+name)+"%")
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []*Media
+	for _, m := range ms {
+		base := filepath.Base(m.Path)
+		if strings.EqualFold(m.Title, name) ||
+			strings.EqualFold(base, name) ||
+			strings.EqualFold(strings.TrimSuffix(base, filepath.Ext(base)), name) {
+			matched = append(matched, m)
+		}
+	}
+	return onlyMedia(matched)
+}
+
+// Find the media of an episode of a series. Series names match as they do
+// when paths are parsed. sql.ErrNoRows is returned if the episode has no
+// media and ErrAmbiguousMedia if it has several files.
+func MatchEpisode(series string, season, episode int) (*Media, error) {
+	ms, err := queryMedia(`
+		SELECT `+mediaColumns+`
+		FROM Media
+		JOIN Episodes ON Episodes.MediaId = Media.MediaId
+		WHERE Media.Missing IS NULL
+			AND Episodes.SeriesId = ? AND Episodes.Season = ? AND Episodes.Episode = ?
+	`, seriesId(series), season, episode)
+	if err != nil {
+		return nil, err
+	}
+	return onlyMedia(ms)
+}
+
+func onlyMedia(ms []*Media) (*Media, error) {
+	switch len(ms) {
+	case 0:
+		return nil, sql.ErrNoRows
+	case 1:
+		return ms[0], nil
+	default:
+		return nil, ErrAmbiguousMedia
+	}
+}
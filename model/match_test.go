@@ -0,0 +1,81 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// match_test.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestMatchMedia(t *testing.T) {
+	DBTest(t, func() {
+		mod := time.Date(2013, 8, 3, 12, 0, 0, 0, time.UTC)
+		s1e1, _ := testSyncMedia(t, "/media", "/media/Firefly/Season 1/Firefly.S01E01.mkv", 10, mod)
+		s2e1, _ := testSyncMedia(t, "/media", "/media/Firefly/Season 2/Firefly.S01E01.mkv", 10, mod)
+		movie, _ := testSyncMedia(t, "/media", "/media/Movies/Serenity (2005)/Serenity.mkv", 10, mod)
+		err := SyncEpisode(s1e1, &EpisodeInfo{Series: "Firefly", Season: 1, Episode: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = UpdateMediaInfo(movie, &MediaInfo{Title: "Serenity: The Movie"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, test := range []struct {
+			path string
+			id   string
+			err  error
+		}{
+			{"/mnt/nas/Firefly/Season 1/Firefly.S01E01.mkv", s1e1, nil},
+			{`D:\TV\Firefly\Season 2\Firefly.S01E01.mkv`, s2e1, nil},
+			{"/elsewhere/Firefly.S01E01.mkv", "", ErrAmbiguousMedia},
+			{"/elsewhere/Firefly.S01E02.mkv", "", sql.ErrNoRows},
+			{"Serenity.mkv", movie, nil},
+			{"", "", sql.ErrNoRows},
+		} {
+			m, err := MatchMediaPath(test.path)
+			if err != test.err {
+				t.Errorf("path %d: %v", i, err)
+			} else if err == nil && m.Id != test.id {
+				t.Errorf("path %d: %v", i, m.Path)
+			}
+		}
+
+		for i, test := range []struct {
+			name string
+			id   string
+			err  error
+		}{
+			{"serenity", movie, nil},
+			{"Serenity: the movie", movie, nil},
+			{"Serenity.mkv", movie, nil},
+			{"Firefly.S01E01", "", ErrAmbiguousMedia},
+			{"Seren", "", sql.ErrNoRows},
+		} {
+			m, err := MatchMediaName(test.name)
+			if err != test.err {
+				t.Errorf("name %d: %v", i, err)
+			} else if err == nil && m.Id != test.id {
+				t.Errorf("name %d: %v", i, m.Path)
+			}
+		}
+
+		m, err := MatchEpisode("firefly", 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Id != s1e1 {
+			t.Errorf("episode: %v", m.Path)
+		}
+		_, err = MatchEpisode("Firefly", 1, 2)
+		if err != sql.ErrNoRows {
+			t.Errorf("missing episode: %v", err)
+		}
+	})
+}
@@ -11,45 +11,455 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"time"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/bmatsuo/mtrack/event"
 )
 
 type Media struct {
-	Id      string    `json:"mediaId"`
-	Root    string    `json:"root"`
-	Path    string    `json:"path"`
-	ModTime time.Time `json:"modified"`
+	Id      string     `json:"mediaId"`
+	Root    string     `json:"root"`
+	Path    string     `json:"path"`
+	Size    int64      `json:"size"`
+	ModTime time.Time  `json:"modified"`
+	Missing *time.Time `json:"missing,omitempty"`
+	MovedTo string     `json:"movedTo,omitempty"`
+	MediaInfo
+}
+
+// Metadata read from the headers of a media file. Duration is in seconds.
+type MediaInfo struct {
+	Duration       float64  `json:"duration,omitempty"`
+	Width          int      `json:"width,omitempty"`
+	Height         int      `json:"height,omitempty"`
+	VideoCodec     string   `json:"videoCodec,omitempty"`
+	AudioCodecs    []string `json:"audioCodecs,omitempty"`
+	AudioLanguages []string `json:"audioLanguages,omitempty"`
+	Title          string   `json:"title,omitempty"`
 }
 
 var ErrNotImplemented = errors.New("not implemented")
 
-func SyncMedia(root string, path string, info os.FileInfo) (string, error) {
+// the columns read by scanMediaRow, in order. queries name the table Media.
+const mediaColumns = `Media.MediaId, Media.Root, Media.Path, Media.Size,
+	Media.ModTime, Media.Missing, Media.MovedTo, Media.Duration, Media.Width,
+	Media.Height, Media.VideoCodec, Media.AudioCodecs, Media.AudioLanguages,
+	Media.Title`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// columns selected after mediaColumns are scanned into extra.
+func scanMediaRow(row rowScanner, extra ...interface{}) (*Media, error) {
+	m := new(Media)
+	var movedTo sql.NullString
+	var acodecs, alangs string
+	dest := []interface{}{&m.Id, &m.Root, &m.Path, &m.Size, &m.ModTime, &m.Missing, &movedTo,
+		&m.Duration, &m.Width, &m.Height, &m.VideoCodec, &acodecs, &alangs, &m.Title}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	m.MovedTo = movedTo.String
+	m.AudioCodecs = splitList(acodecs)
+	m.AudioLanguages = splitList(alangs)
+	return m, nil
+}
+
+// lists are stored as comma separated strings.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func joinList(xs []string) string {
+	return strings.Join(xs, ",")
+}
+
+// Store metadata read from the file of the given media. The media is no
+// longer returned by UnprobedMedia.
+func UpdateMediaInfo(id string, info *MediaInfo) error {
+	q := `UPDATE Media
+		SET Duration = ?, Width = ?, Height = ?, VideoCodec = ?,
+			AudioCodecs = ?, AudioLanguages = ?, Title = ?, Probed = ?
+		WHERE MediaId = ?`
+	_, err := DB.Exec(q, info.Duration, info.Width, info.Height, info.VideoCodec,
+		joinList(info.AudioCodecs), joinList(info.AudioLanguages), info.Title,
+		time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return indexMedia(DB, id)
+}
+
+// Media under root (and beneath the directory dir if it is not empty) that has
+// not been probed for metadata since it was created or last modified.
+func UnprobedMedia(root, dir string) ([]*Media, error) {
+	return mediaUnder(root, dir, `Probed IS NULL`)
+}
+
+// Media under root beneath the directory dir (all of root if dir is empty)
+// that is not missing.
+func MediaUnder(root, dir string) ([]*Media, error) {
+	return mediaUnder(root, dir, `1`)
+}
+
+// media in root beneath dir that is not missing and matches cond.
+func mediaUnder(root, dir, cond string) ([]*Media, error) {
+	q := `SELECT ` + mediaColumns + `
+		FROM Media
+		WHERE Root = ? AND Missing IS NULL AND ` + cond
+	rows, err := DB.Query(q, root)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prefix string
+	if dir != "" && dir != root {
+		sep := string(filepath.Separator)
+		prefix = strings.TrimRight(dir, sep) + sep
+	}
+	var ms []*Media
+	for rows.Next() {
+		m, err := scanMediaRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(m.Path, prefix) {
+			ms = append(ms, m)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// The outcome of synchronizing a file with the Media table.
+type SyncStatus uint
+
+const (
+	SyncUnchanged SyncStatus = iota
+	SyncCreated
+	SyncUpdated
+	SyncMissing
+)
+
+func (s SyncStatus) String() string {
+	switch s {
+	case SyncUnchanged:
+		return "unchanged"
+	case SyncCreated:
+		return "created"
+	case SyncUpdated:
+		return "updated"
+	case SyncMissing:
+		return "missing"
+	default:
+		return fmt.Sprintf("SyncStatus(%d)", uint(s))
+	}
+}
+
+// Record the file at path in the Media table. A file previously marked
+// missing is restored. If info is nil the file no longer exists and its media
+// is marked missing. The media id is returned along with what, if anything,
+// changed.
+func SyncMedia(root string, path string, info os.FileInfo) (string, SyncStatus, error) {
 	pathnorm := strings.ToLower(path)
 	sha1 := getsha1(pathnorm)
 
+	if info == nil {
+		q := `UPDATE Media SET Missing = ? WHERE MediaId = ? AND Missing IS NULL`
+		res, err := DB.Exec(q, time.Now(), sha1)
+		if err != nil {
+			return "", SyncUnchanged, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil || n == 0 {
+			return sha1, SyncUnchanged, err
+		}
+		publishMedia(event.MediaMissing, root, sha1, map[string]string{"path": path})
+		return sha1, SyncMissing, nil
+	}
+
 	var mod time.Time
-	q := `select ModTime from Media where MediaId = ?`
+	var size int64
+	var missing *time.Time
+	q := `select ModTime, Size, Missing from Media where MediaId = ?`
 	row := DB.QueryRow(q, sha1)
-	err := row.Scan(&mod)
+	err := row.Scan(&mod, &size, &missing)
 	switch err {
 	case sql.ErrNoRows:
-		q := `INSERT INTO Media(MediaId, Root, Path, PathNorm, ModTime)`
-		q += ` VALUES (?, ?, ?, ?, ?)`
-		_, err = DB.Exec(q, sha1, root, path, pathnorm, info.ModTime())
+		q := `INSERT INTO Media(MediaId, Root, Path, PathNorm, Size, ModTime)`
+		q += ` VALUES (?, ?, ?, ?, ?, ?)`
+		_, err = DB.Exec(q, sha1, root, path, pathnorm, info.Size(), info.ModTime())
+		if err == nil {
+			err = indexMedia(DB, sha1)
+		}
 		if err != nil {
-			return "", err
+			return "", SyncUnchanged, err
 		}
+		publishMedia(event.MediaCreated, root, sha1, map[string]string{"path": path})
+		return sha1, SyncCreated, nil
 	case nil:
 		_mod := info.ModTime()
-		if _mod.After(mod) {
-			q := `UPDATE Media SET ModTime = ? WHERE MediaId = ?`
-			_, err = DB.Exec(q, _mod, sha1)
+		if _mod.After(mod) || info.Size() != size || missing != nil {
+			q := `UPDATE Media
+				SET ModTime = ?, Size = ?, Missing = NULL, MovedTo = NULL,
+					Probed = NULL
+				WHERE MediaId = ?`
+			_, err = DB.Exec(q, _mod, info.Size(), sha1)
+			if err == nil {
+				err = indexMedia(DB, sha1)
+			}
+			if err == nil {
+				publishMedia(event.MediaUpdated, root, sha1, map[string]string{"path": path})
+			}
 			// want to return the existing id in this case
+			return sha1, SyncUpdated, err
 		}
 	}
-	return sha1, err
+	return sha1, SyncUnchanged, err
+}
+
+// The changes made by ReconcileMedia. Moved maps the id of each media file
+// that was moved to its new id.
+type Reconciliation struct {
+	Missing []string          `json:"missing"`
+	Moved   map[string]string `json:"moved"`
+}
+
+// Tables with a MediaId column that follows media when it is moved.
+var mediaRefTables = []string{
+	"UserStartedMedia",
+	"UserFinishedMedia",
+	"Episodes",
+	"WatchEvents",
+}
+
+// Compare the media recorded under root with the ids seen during a complete
+// walk of root. Media that was not seen is marked missing, never deleted. A
+// missing file whose size and modification time match exactly one file
+// created during the walk is considered moved, and user progress is rekeyed
+// to follow it.
+func ReconcileMedia(root string, seen, created map[string]bool) (*Reconciliation, error) {
+	return ReconcileMediaDir(root, root, seen, created)
+}
+
+// Like ReconcileMedia but only media in the directory dir (beneath root) is
+// considered. The ids in seen come from a complete walk of dir.
+func ReconcileMediaDir(root, dir string, seen, created map[string]bool) (*Reconciliation, error) {
+	q := `SELECT ` + mediaColumns + ` FROM Media WHERE Root = ? AND Missing IS NULL`
+	rows, err := DB.Query(q, root)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// paths are compared as they were walked, without cleaning.
+	var prefix string
+	if dir != root {
+		sep := string(filepath.Separator)
+		prefix = strings.TrimRight(dir, sep) + sep
+	}
+	var vanished, fresh []*Media
+	for rows.Next() {
+		m, err := scanMediaRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(m.Path, prefix) {
+			continue
+		}
+		switch {
+		case !seen[m.Id]:
+			vanished = append(vanished, m)
+		case created[m.Id]:
+			fresh = append(fresh, m)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rec := &Reconciliation{Moved: make(map[string]string)}
+	if len(vanished) == 0 {
+		return rec, nil
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, m := range vanished {
+		q := `UPDATE Media SET Missing = ? WHERE MediaId = ?`
+		_, err = tx.Exec(q, now, m.Id)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	rec.Moved, err = linkMovedMediaTx(tx, vanished, fresh)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range vanished {
+		data := map[string]string{"path": m.Path}
+		if rec.Moved[m.Id] == "" {
+			rec.Missing = append(rec.Missing, m.Id)
+		} else {
+			data["movedTo"] = rec.Moved[m.Id]
+		}
+		publishMedia(event.MediaMissing, root, m.Id, data)
+	}
+
+	return rec, nil
+}
+
+// announce a change to the media of a root.
+func publishMedia(typ, root, mediaid string, data map[string]string) {
+	event.Publish(&event.Event{Type: typ, Root: root, MediaId: mediaid, Data: data})
+}
+
+// Like ReconcileMedia but for media already known to be missing, as when a
+// filesystem watcher sees a file removed and another created. A map from the
+// id of each moved media to its new id is returned.
+func RelinkMedia(missing, created []string) (map[string]string, error) {
+	var vanished, fresh []*Media
+	for _, id := range missing {
+		m, err := FindMedia(id)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if m.Missing != nil && m.MovedTo == "" {
+			vanished = append(vanished, m)
+		}
+	}
+	for _, id := range created {
+		m, err := FindMedia(id)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if m.Missing == nil {
+			fresh = append(fresh, m)
+		}
+	}
+	if len(vanished) == 0 || len(fresh) == 0 {
+		return nil, nil
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	moved, err := linkMovedMediaTx(tx, vanished, fresh)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// match missing media in vanished with media in fresh and link them. each
+// match has its references rekeyed and is recorded in the returned map.
+func linkMovedMediaTx(tx *sql.Tx, vanished, fresh []*Media) (map[string]string, error) {
+	moved := make(map[string]string)
+	claimed := make(map[string]bool, len(fresh))
+	for _, m := range vanished {
+		dest := movedMedia(m, fresh, claimed)
+		if dest == nil {
+			continue
+		}
+		claimed[dest.Id] = true
+		err := rekeyMediaTx(tx, m.Id, dest.Id)
+		if err != nil {
+			return nil, err
+		}
+		q := `UPDATE Media SET MovedTo = ? WHERE MediaId = ?`
+		_, err = tx.Exec(q, dest.Id, m.Id)
+		if err != nil {
+			return nil, err
+		}
+		moved[m.Id] = dest.Id
+	}
+	return moved, nil
+}
+
+// find the file in fresh that m was most likely moved to. nil is returned if
+// there is no unambiguous candidate.
+func movedMedia(m *Media, fresh []*Media, claimed map[string]bool) *Media {
+	if m.Size <= 0 {
+		return nil // empty files all look alike
+	}
+	var match []*Media
+	for _, f := range fresh {
+		if claimed[f.Id] || f.Size != m.Size || !f.ModTime.Equal(m.ModTime) {
+			continue
+		}
+		match = append(match, f)
+	}
+	if len(match) == 1 {
+		return match[0]
+	}
+
+	// prefer a candidate that kept its name (moved, not renamed)
+	var named *Media
+	base := strings.ToLower(filepath.Base(m.Path))
+	for _, f := range match {
+		if strings.ToLower(filepath.Base(f.Path)) == base {
+			if named != nil {
+				return nil
+			}
+			named = f
+		}
+	}
+	return named
+}
+
+// point all references to the media old at the media id instead.
+func rekeyMediaTx(tx *sql.Tx, old, id string) error {
+	for _, table := range mediaRefTables {
+		q := `UPDATE OR IGNORE ` + table + ` SET MediaId = ? WHERE MediaId = ?`
+		_, err := tx.Exec(q, id, old)
+		if err != nil {
+			return err
+		}
+		// rows left behind conflicted with existing rows for id.
+		q = `DELETE FROM ` + table + ` WHERE MediaId = ?`
+		_, err = tx.Exec(q, old)
+		if err != nil {
+			return err
+		}
+	}
+	// id may have gained the episode of old.
+	return indexMedia(tx, id)
 }
 
 func getsha1(path string) string {
@@ -60,21 +470,17 @@ func getsha1(path string) string {
 }
 
 func FindMedia(id string) (*Media, error) {
-	m := new(Media)
-	q := `SELECT MediaId, Root, Path, ModTime FROM Media WHERE MediaId = ?`
-	row := DB.QueryRow(q, id)
-	err := row.Scan(&m.Id, &m.Root, &m.Path, &m.ModTime)
-	if err != nil {
-		return nil, err
-	}
-	return m, nil
+	q := `SELECT ` + mediaColumns + ` FROM Media WHERE MediaId = ?`
+	return scanMediaRow(DB.QueryRow(q, id))
 }
 
+// All media that is not missing, most recently modified first.
 func AllMedia() ([]*Media, error) {
 	ms := make([]*Media, 0, 20)
 	rows, err := DB.Query(`
-		SELECT MediaId, Root, Path, ModTime
+		SELECT ` + mediaColumns + `
 		FROM Media
+		WHERE Missing IS NULL
 		ORDER BY ModTime DESC
 	`)
 	if err != nil {
@@ -83,8 +489,7 @@ func AllMedia() ([]*Media, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		m := new(Media)
-		err = rows.Scan(&m.Id, &m.Root, &m.Path, &m.ModTime)
+		m, err := scanMediaRow(rows)
 		if err != nil {
 			return nil, err
 		}
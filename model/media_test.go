@@ -0,0 +1,191 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// media_test.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi testFileInfo) Name() string       { return filepath.Base(fi.name) }
+func (fi testFileInfo) Size() int64        { return fi.size }
+func (fi testFileInfo) Mode() os.FileMode  { return 0644 }
+func (fi testFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi testFileInfo) IsDir() bool        { return false }
+func (fi testFileInfo) Sys() interface{}   { return nil }
+
+func testSyncMedia(t *testing.T, root, path string, size int64, mod time.Time) (string, SyncStatus) {
+	id, status, err := SyncMedia(root, path, testFileInfo{path, size, mod})
+	if err != nil {
+		t.Fatalf("sync %q: %v", path, err)
+	}
+	return id, status
+}
+
+func TestSyncMedia(t *testing.T) {
+	DBTest(t, func() {
+		mod := time.Date(2013, 8, 3, 12, 0, 0, 0, time.UTC)
+		id, status := testSyncMedia(t, "/media", "/media/a.mkv", 10, mod)
+		if status != SyncCreated {
+			t.Fatalf("first sync: %v", status)
+		}
+		_, status = testSyncMedia(t, "/media", "/media/a.mkv", 10, mod)
+		if status != SyncUnchanged {
+			t.Fatalf("second sync: %v", status)
+		}
+		_, status = testSyncMedia(t, "/media", "/media/a.mkv", 20, mod)
+		if status != SyncUpdated {
+			t.Fatalf("resized sync: %v", status)
+		}
+		m, err := FindMedia(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Size != 20 {
+			t.Fatalf("size: %d", m.Size)
+		}
+	})
+}
+
+func TestReconcileMedia(t *testing.T) {
+	DBTest(t, func() {
+		mod := time.Date(2013, 8, 3, 12, 0, 0, 0, time.UTC)
+		user, err := LocateOrCreateUserByEmail("test@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		gone, _ := testSyncMedia(t, "/media", "/media/gone.mkv", 10, mod)
+		old, _ := testSyncMedia(t, "/media", "/media/old/show.mkv", 20, mod)
+		kept, _ := testSyncMedia(t, "/media", "/media/kept.mkv", 30, mod)
+		err = FinishMedia(user, old)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// gone.mkv was deleted and show.mkv moved to a new directory.
+		seen := map[string]bool{kept: true}
+		created := make(map[string]bool)
+		moved, status := testSyncMedia(t, "/media", "/media/new/show.mkv", 20, mod)
+		if status != SyncCreated {
+			t.Fatalf("moved sync: %v", status)
+		}
+		seen[moved] = true
+		created[moved] = true
+
+		rec, err := ReconcileMedia("/media", seen, created)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rec.Missing) != 1 || rec.Missing[0] != gone {
+			t.Errorf("missing: %v", rec.Missing)
+		}
+		if rec.Moved[old] != moved {
+			t.Errorf("moved: %v", rec.Moved)
+		}
+
+		ms, err := AllMedia()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ms) != 2 {
+			t.Errorf("%d media", len(ms))
+		}
+
+		m, err := FindMedia(old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Missing == nil || m.MovedTo != moved {
+			t.Errorf("moved media: %+v", m)
+		}
+
+		finished, _, err := ListFinished(&ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(finished) != 1 || finished[0].MediaId != moved {
+			t.Errorf("progress did not follow the move: %v", finished)
+		}
+
+		// a missing file that reappears is restored.
+		_, status = testSyncMedia(t, "/media", "/media/gone.mkv", 10, mod)
+		if status != SyncUpdated {
+			t.Errorf("restored sync: %v", status)
+		}
+		m, err = FindMedia(gone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Missing != nil {
+			t.Errorf("restored media is missing")
+		}
+	})
+}
+
+func TestMediaInfo(t *testing.T) {
+	DBTest(t, func() {
+		mod := time.Date(2013, 8, 3, 12, 0, 0, 0, time.UTC)
+		a, _ := testSyncMedia(t, "/media", "/media/show/a.mkv", 10, mod)
+		b, _ := testSyncMedia(t, "/media", "/media/b.mkv", 10, mod)
+
+		unprobed, err := UnprobedMedia("/media", "/media/show")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(unprobed) != 1 || unprobed[0].Id != a {
+			t.Fatalf("unprobed in dir: %v", unprobed)
+		}
+
+		info := &MediaInfo{
+			Duration:       1500,
+			Width:          1920,
+			Height:         1080,
+			VideoCodec:     "h264",
+			AudioCodecs:    []string{"aac", "ac3"},
+			AudioLanguages: []string{"eng", "jpn"},
+			Title:          "Sintel",
+		}
+		err = UpdateMediaInfo(a, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := FindMedia(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(&m.MediaInfo, info) {
+			t.Errorf("info: %+v (expected %+v)", m.MediaInfo, *info)
+		}
+
+		unprobed, err = UnprobedMedia("/media", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(unprobed) != 1 || unprobed[0].Id != b {
+			t.Fatalf("unprobed in root: %v", unprobed)
+		}
+
+		// modified files must be probed again.
+		testSyncMedia(t, "/media", "/media/show/a.mkv", 20, mod)
+		unprobed, err = UnprobedMedia("/media", "/media/show")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(unprobed) != 1 || unprobed[0].Id != a {
+			t.Fatalf("unprobed after update: %v", unprobed)
+		}
+	})
+}
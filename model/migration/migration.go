@@ -67,6 +67,20 @@ func (m String) Exec(db *sql.Tx) error {
 	return err
 }
 
+// a sequence of raw sql queries executed in order. useful for migrations that
+// alter a table in several steps.
+type Strings []string
+
+func (m Strings) Exec(db *sql.Tx) error {
+	for _, q := range m {
+		_, err := db.Exec(q)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type namedMigration struct {
 	Name string
 	M    Interface
@@ -28,30 +28,6 @@ func (err dbError) Error() string {
 	return fmt.Sprintf("%s: %v", err.op, err.err)
 }
 
-func DBDemoUser() error {
-	userid, err := LocateOrCreateUserByEmail("bryan.matsuo@gmail.com")
-	if err != nil {
-		return dbError{"get user", err}
-	}
-
-	tokens, err := AllAccessTokensForUser(userid)
-	if err != nil {
-		return dbError{"get access tokens", err}
-	}
-
-	if len(tokens) == 0 {
-		_, err := CreateAccessTokenForUser(userid)
-		if err != nil {
-			return dbError{"create access tokens", err}
-		}
-	}
-
-	log.Print("ADMIN")
-	log.Print(UserHasPermission(userid, "ADMIN"))
-
-	return nil
-}
-
 func DBInit() error {
 	var err error
 	DB, err = sql.Open("sqlite3", DBPath)
@@ -62,6 +38,10 @@ func DBInit() error {
 	if err != nil {
 		return dbError{"migrations", err}
 	}
+	err = ensureSearchIndex()
+	if err != nil {
+		return dbError{"search index", err}
+	}
 	return nil
 }
 
@@ -226,6 +206,352 @@ func dbInitMigrations() error {
 		),
 	)
 
+	Migrations = Migrations.Append("017 add media size",
+		migration.MigrationIrreversible(
+			migration.String(
+				`ALTER TABLE Media ADD COLUMN Size INTEGER NOT NULL DEFAULT 0`,
+			),
+		),
+	)
+	Migrations = Migrations.Append("018 add media missing",
+		migration.MigrationIrreversible(
+			migration.String(
+				`ALTER TABLE Media ADD COLUMN Missing DATETIME DEFAULT NULL`,
+			),
+		),
+	)
+	Migrations = Migrations.Append("019 add media movedto",
+		migration.MigrationIrreversible(
+			migration.String(
+				`ALTER TABLE Media ADD COLUMN MovedTo TEXT DEFAULT NULL
+					REFERENCES Media(MediaId)`,
+			),
+		),
+	)
+	Migrations = Migrations.Append("020 create index mediamissing",
+		migration.New(
+			migration.String(
+				`CREATE INDEX IF NOT EXISTS MediaMissing ON Media (Root, Missing)`,
+			),
+			migration.String(`DROP INDEX MediaMissing`),
+		),
+	)
+	Migrations = Migrations.Append("021 add media metadata",
+		migration.MigrationIrreversible(
+			migration.Strings{
+				`ALTER TABLE Media ADD COLUMN Duration REAL NOT NULL DEFAULT 0`,
+				`ALTER TABLE Media ADD COLUMN Width INTEGER NOT NULL DEFAULT 0`,
+				`ALTER TABLE Media ADD COLUMN Height INTEGER NOT NULL DEFAULT 0`,
+				`ALTER TABLE Media ADD COLUMN VideoCodec TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE Media ADD COLUMN AudioCodecs TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE Media ADD COLUMN AudioLanguages TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE Media ADD COLUMN Title TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE Media ADD COLUMN Probed DATETIME DEFAULT NULL`,
+			},
+		),
+	)
+	Migrations = Migrations.Append("022 create table series",
+		migration.New(
+			migration.String(
+				`CREATE TABLE IF NOT EXISTS Series(
+					SeriesId TEXT PRIMARY KEY ON CONFLICT ABORT,
+					Name     TEXT NOT NULL,
+					Created  DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`,
+			),
+			migration.String(`DROP TABLE Series`),
+		),
+	)
+	Migrations = Migrations.Append("023 create table seasons",
+		migration.New(
+			migration.String(
+				`CREATE TABLE IF NOT EXISTS Seasons(
+					SeriesId TEXT NOT NULL,
+					Season   INTEGER NOT NULL,
+					Created  DATETIME DEFAULT CURRENT_TIMESTAMP,
+					PRIMARY KEY (SeriesId, Season) ON CONFLICT IGNORE,
+					FOREIGN KEY (SeriesId) REFERENCES Series(SeriesId)
+				)`,
+			),
+			migration.String(`DROP TABLE Seasons`),
+		),
+	)
+	Migrations = Migrations.Append("024 create table episodes",
+		migration.New(
+			migration.String(
+				`CREATE TABLE IF NOT EXISTS Episodes(
+					MediaId  TEXT PRIMARY KEY ON CONFLICT REPLACE,
+					SeriesId TEXT NOT NULL,
+					Season   INTEGER NOT NULL,
+					Episode  INTEGER NOT NULL,
+					Title    TEXT NOT NULL DEFAULT '',
+					FOREIGN KEY (MediaId) REFERENCES Media(MediaId),
+					FOREIGN KEY (SeriesId, Season) REFERENCES Seasons(SeriesId, Season)
+				)`,
+			),
+			migration.String(`DROP TABLE Episodes`),
+		),
+	)
+	Migrations = Migrations.Append("025 create index episodesseason",
+		migration.New(
+			migration.String(
+				`CREATE INDEX IF NOT EXISTS EpisodesSeason
+					ON Episodes (SeriesId, Season, Episode)`,
+			),
+			migration.String(`DROP INDEX EpisodesSeason`),
+		),
+	)
+	Migrations = Migrations.Append("026 add userstartedmedia position",
+		migration.MigrationIrreversible(
+			migration.Strings{
+				`ALTER TABLE UserStartedMedia ADD COLUMN Position REAL NOT NULL DEFAULT 0`,
+				`ALTER TABLE UserStartedMedia ADD COLUMN Updated DATETIME DEFAULT NULL`,
+			},
+		),
+	)
+	Migrations = Migrations.Append("027 create table watchevents",
+		migration.New(
+			migration.String(
+				`CREATE TABLE IF NOT EXISTS WatchEvents(
+					EventId  INTEGER PRIMARY KEY AUTOINCREMENT,
+					UserId   TEXT NOT NULL,
+					MediaId  TEXT NOT NULL,
+					Event    TEXT NOT NULL,
+					Position REAL NOT NULL DEFAULT 0,
+					Time     DATETIME DEFAULT CURRENT_TIMESTAMP,
+					FOREIGN KEY (UserId) REFERENCES Users(UserId),
+					FOREIGN KEY (MediaId) REFERENCES Media(MediaId)
+				)`,
+			),
+			migration.String(`DROP TABLE WatchEvents`),
+		),
+	)
+	Migrations = Migrations.Append("028 create index watcheventsusertime",
+		migration.New(
+			migration.String(
+				`CREATE INDEX IF NOT EXISTS WatchEventsUserTime
+					ON WatchEvents (UserId, Time DESC)`,
+			),
+			migration.String(`DROP INDEX WatchEventsUserTime`),
+		),
+	)
+	Migrations = Migrations.Append("029 create index watcheventsmedia",
+		migration.New(
+			migration.String(
+				`CREATE INDEX IF NOT EXISTS WatchEventsMedia
+					ON WatchEvents (MediaId, UserId, Event)`,
+			),
+			migration.String(`DROP INDEX WatchEventsMedia`),
+		),
+	)
+	Migrations = Migrations.Append("030 backfill watchevents",
+		migration.New(
+			migration.Strings{
+				`INSERT INTO WatchEvents (UserId, MediaId, Event, Position, Time)
+					SELECT UserId, MediaId, 'started', Position, Started
+					FROM UserStartedMedia`,
+				`INSERT INTO WatchEvents (UserId, MediaId, Event, Time)
+					SELECT UserId, MediaId, 'finished', Finished
+					FROM UserFinishedMedia`,
+			},
+			migration.String(`DELETE FROM WatchEvents`),
+		),
+	)
+	Migrations = Migrations.Append("031 create table userlogins",
+		migration.New(
+			migration.String(
+				`CREATE TABLE IF NOT EXISTS UserLogins(
+					UserId       TEXT PRIMARY KEY ON CONFLICT ABORT,
+					Username     TEXT NOT NULL UNIQUE COLLATE NOCASE,
+					PasswordHash TEXT NOT NULL,
+					Created      DATETIME DEFAULT CURRENT_TIMESTAMP,
+					Updated      DATETIME DEFAULT CURRENT_TIMESTAMP,
+					FOREIGN KEY (UserId) REFERENCES Users(UserId)
+				)`,
+			),
+			migration.String(`DROP TABLE UserLogins`),
+		),
+	)
+	Migrations = Migrations.Append("032 create table sessions",
+		migration.New(
+			migration.String(
+				`CREATE TABLE IF NOT EXISTS Sessions(
+					SessionHash TEXT PRIMARY KEY ON CONFLICT ABORT,
+					UserId      TEXT NOT NULL,
+					CSRFToken   TEXT NOT NULL,
+					Created     DATETIME DEFAULT CURRENT_TIMESTAMP,
+					Expires     DATETIME NOT NULL,
+					FOREIGN KEY (UserId) REFERENCES Users(UserId)
+				)`,
+			),
+			migration.String(`DROP TABLE Sessions`),
+		),
+	)
+	Migrations = Migrations.Append("033 create index sessionsuser",
+		migration.New(
+			migration.String(
+				`CREATE INDEX IF NOT EXISTS SessionsUser ON Sessions (UserId)`,
+			),
+			migration.String(`DROP INDEX SessionsUser`),
+		),
+	)
+	Migrations = Migrations.Append("034 rename plain accesstokens",
+		migration.MigrationIrreversible(
+			migration.Strings{
+				`ALTER TABLE AccessTokens RENAME TO AccessTokensPlain`,
+				`CREATE TABLE IF NOT EXISTS AccessTokens(
+					TokenId   TEXT PRIMARY KEY ON CONFLICT ABORT,
+					TokenHash TEXT NOT NULL UNIQUE,
+					UserId    TEXT NOT NULL,
+					Name      TEXT NOT NULL DEFAULT '',
+					Scopes    TEXT NOT NULL,
+					Created   DATETIME DEFAULT CURRENT_TIMESTAMP,
+					LastUsed  DATETIME,
+					Expires   DATETIME,
+					FOREIGN KEY (UserId) REFERENCES Users(UserId)
+				)`,
+			},
+		),
+	)
+	Migrations = Migrations.Append("035 hash accesstokens",
+		migration.MigrationIrreversible(
+			migration.ExecutorFunc(hashPlainAccessTokens),
+		),
+	)
+	Migrations = Migrations.Append("036 create index accesstokensuser",
+		migration.New(
+			migration.String(
+				`CREATE INDEX IF NOT EXISTS AccessTokensUser ON AccessTokens (UserId)`,
+			),
+			migration.String(`DROP INDEX AccessTokensUser`),
+		),
+	)
+	Migrations = Migrations.Append("037 create table roles",
+		migration.New(
+			migration.String(
+				`CREATE TABLE IF NOT EXISTS Roles(
+					RoleName TEXT PRIMARY KEY ON CONFLICT ABORT,
+					Created  DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`,
+			),
+			migration.String(`DROP TABLE Roles`),
+		),
+	)
+	Migrations = Migrations.Append("038 create table rolepermissions",
+		migration.New(
+			migration.String(
+				`CREATE TABLE IF NOT EXISTS RolePermissions(
+					RoleName       TEXT NOT NULL,
+					PermissionName TEXT NOT NULL,
+					FOREIGN KEY (RoleName) REFERENCES Roles(RoleName),
+					PRIMARY KEY (RoleName, PermissionName) ON CONFLICT IGNORE
+				)`,
+			),
+			migration.String(`DROP TABLE RolePermissions`),
+		),
+	)
+	Migrations = Migrations.Append("039 create table userroles",
+		migration.New(
+			migration.String(
+				`CREATE TABLE IF NOT EXISTS UserRoles(
+					UserId   TEXT NOT NULL,
+					RoleName TEXT NOT NULL,
+					Created  DATETIME DEFAULT CURRENT_TIMESTAMP,
+					FOREIGN KEY (UserId) REFERENCES Users(UserId),
+					FOREIGN KEY (RoleName) REFERENCES Roles(RoleName),
+					PRIMARY KEY (UserId, RoleName) ON CONFLICT IGNORE
+				)`,
+			),
+			migration.String(`DROP TABLE UserRoles`),
+		),
+	)
+	Migrations = Migrations.Append("040 seed roles",
+		migration.New(
+			migration.ExecutorFunc(seedRoles),
+			migration.Strings{
+				`DELETE FROM UserRoles`,
+				`DELETE FROM RolePermissions`,
+				`DELETE FROM Roles`,
+			},
+		),
+	)
+	Migrations = Migrations.Append("041 create table mediasearchids",
+		migration.New(
+			migration.String(
+				`CREATE TABLE IF NOT EXISTS MediaSearchIds(
+					SearchId INTEGER PRIMARY KEY,
+					MediaId  TEXT NOT NULL UNIQUE,
+					FOREIGN KEY (MediaId) REFERENCES Media(MediaId)
+				)`,
+			),
+			migration.String(`DROP TABLE MediaSearchIds`),
+		),
+	)
+	Migrations = Migrations.Append("042 create table mediasearch",
+		migration.New(
+			migration.ExecutorFunc(createSearchIndex),
+			migration.String(`DROP TABLE IF EXISTS MediaSearch`),
+		),
+	)
+	Migrations = Migrations.Append("043 index media",
+		migration.New(
+			migration.ExecutorFunc(indexAllMedia),
+			migration.ExecutorFunc(clearSearchIndex),
+		),
+	)
+	Migrations = Migrations.Append("044 create table webhooks",
+		migration.New(
+			migration.String(
+				`CREATE TABLE IF NOT EXISTS Webhooks(
+					WebhookId TEXT PRIMARY KEY ON CONFLICT ABORT,
+					URL       TEXT NOT NULL,
+					Secret    TEXT NOT NULL,
+					Events    TEXT NOT NULL DEFAULT '',
+					Root      TEXT NOT NULL DEFAULT '',
+					UserId    TEXT NOT NULL DEFAULT '',
+					Created   DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`,
+			),
+			migration.String(`DROP TABLE Webhooks`),
+		),
+	)
+	Migrations = Migrations.Append("045 create table webhookdeliveries",
+		migration.New(
+			migration.String(
+				`CREATE TABLE IF NOT EXISTS WebhookDeliveries(
+					DeliveryId  INTEGER PRIMARY KEY AUTOINCREMENT,
+					WebhookId   TEXT NOT NULL,
+					Event       TEXT NOT NULL,
+					Payload     TEXT NOT NULL,
+					State       TEXT NOT NULL,
+					Attempts    INTEGER NOT NULL DEFAULT 0,
+					NextAttempt DATETIME,
+					LastStatus  INTEGER NOT NULL DEFAULT 0,
+					LastError   TEXT NOT NULL DEFAULT '',
+					Created     DATETIME DEFAULT CURRENT_TIMESTAMP,
+					Updated     DATETIME,
+					FOREIGN KEY (WebhookId) REFERENCES Webhooks(WebhookId)
+				)`,
+			),
+			migration.String(`DROP TABLE WebhookDeliveries`),
+		),
+	)
+	Migrations = Migrations.Append("046 create index webhookdeliveriesdue",
+		migration.New(
+			migration.String(
+				`CREATE INDEX IF NOT EXISTS WebhookDeliveriesDue ON WebhookDeliveries (State, NextAttempt)`,
+			),
+			migration.String(`DROP INDEX WebhookDeliveriesDue`),
+		),
+	)
+	Migrations = Migrations.Append("047 add useremails verified",
+		migration.MigrationIrreversible(
+			migration.String(
+				`ALTER TABLE UserEmails ADD COLUMN Verified BOOLEAN NOT NULL DEFAULT 1`,
+			),
+		),
+	)
+
 	ahead, behind, err := migration.Diff(DB, Migrations)
 	switch {
 	case err != nil:
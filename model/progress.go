@@ -9,74 +9,29 @@ package model
 import (
 	"database/sql"
 	"errors"
+	"log"
 	"time"
+
+	"github.com/bmatsuo/mtrack/event"
 )
 
 var ErrAlreadyStarted = errors.New("already started")
 var ErrAlreadyFinished = errors.New("already finished")
 
 type ActionStarted struct {
-	MediaId   string    `json:"mediaId"`
-	UserId    string    `json:"userId"`
-	StartTime time.Time `json:"started"`
+	MediaId   string     `json:"mediaId"`
+	UserId    string     `json:"userId"`
+	StartTime time.Time  `json:"started"`
+	Position  float64    `json:"position"` // seconds
+	Updated   *time.Time `json:"updated,omitempty"`
+	Root      string     `json:"-"` // the media's root
 }
 
 type ActionFinished struct {
 	MediaId    string    `json:"mediaId"`
 	UserId     string    `json:"userId"`
 	FinishTime time.Time `json:"finished"`
-}
-
-func AllInProgress() ([]*ActionStarted, error) {
-	as := make([]*ActionStarted, 0, 20)
-	rows, err := DB.Query(`
-		SELECT S.MediaId, S.UserId, S.Started
-		FROM UserStartedMedia as S
-		NATURAL JOIN Media
-		ORDER BY Started DESC
-	`)
-	if err != nil {
-		return nil, err
-	}
-	for rows.Next() {
-		a := new(ActionStarted)
-		err = rows.Scan(&a.MediaId, &a.UserId, &a.StartTime)
-		if err != nil {
-			return nil, err
-		}
-		as = append(as, a)
-	}
-	err = rows.Err()
-	if err != nil {
-		return nil, err
-	}
-	return as, nil
-}
-
-func AllFinished() ([]*ActionFinished, error) {
-	as := make([]*ActionFinished, 0, 20)
-	rows, err := DB.Query(`
-		SELECT S.MediaId, S.UserId, S.Finished
-		FROM UserFinishedMedia as S
-		NATURAL JOIN Media
-		ORDER BY S.Finished DESC
-	`)
-	if err != nil {
-		return nil, err
-	}
-	for rows.Next() {
-		a := new(ActionFinished)
-		err = rows.Scan(&a.MediaId, &a.UserId, &a.FinishTime)
-		if err != nil {
-			return nil, err
-		}
-		as = append(as, a)
-	}
-	err = rows.Err()
-	if err != nil {
-		return nil, err
-	}
-	return as, nil
+	Root       string    `json:"-"` // the media's root
 }
 
 func ClearProgress(userid, mediaid string) error {
@@ -92,9 +47,26 @@ func ClearProgress(userid, mediaid string) error {
 		return err
 	}
 
+	err = recordWatchEvent(DB, userid, mediaid, EventCleared, 0)
+	if err != nil {
+		return err
+	}
+	publishProgress(event.ProgressCleared, userid, mediaid)
 	return nil
 }
 
+// announce a change in a user's progress on media.
+func publishProgress(typ, userid, mediaid string) {
+	var root string
+	err := DB.QueryRow(`SELECT Root FROM Media WHERE MediaId = ?`, mediaid).Scan(&root)
+	if err != nil {
+		// without a root nobody can be allowed to see the event.
+		log.Printf("%s %v: %v", typ, mediaid, err)
+		return
+	}
+	event.Publish(&event.Event{Type: typ, Root: root, MediaId: mediaid, UserId: userid})
+}
+
 func StartMedia(userid, mediaid string) error {
 	row := DB.QueryRow(`
 		SELECT COUNT(*)
@@ -138,12 +110,18 @@ func StartMedia(userid, mediaid string) error {
 		err := tx.Rollback()
 		return err
 	}
+	err = recordWatchEvent(tx, userid, mediaid, EventStarted, 0)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
+	publishProgress(event.ProgressStarted, userid, mediaid)
 	return nil
 }
 
@@ -159,7 +137,7 @@ func FinishMedia(userid, mediaid string) error {
 		return err
 	}
 	if count > 0 {
-		return ErrAlreadyStarted
+		return ErrAlreadyFinished
 	}
 
 	row = DB.QueryRow(`
@@ -190,11 +168,105 @@ func FinishMedia(userid, mediaid string) error {
 		err := tx.Rollback()
 		return err
 	}
+	err = recordWatchEvent(tx, userid, mediaid, EventFinished, 0)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
+	publishProgress(event.ProgressFinished, userid, mediaid)
 	return nil
 }
+
+// The fraction of a media file's duration after which UpdatePosition finishes
+// it. Zero disables finishing media automatically.
+var FinishThreshold = 0.9
+
+// Record the playback position (in seconds) of media a user is watching,
+// starting the media if necessary. Once position passes FinishThreshold of
+// the media's duration the media is finished and true is returned. Positions
+// reported for finished media are ignored, because players and webhooks may
+// report them late. Only a position of zero starts finished media again.
+func UpdatePosition(userid, mediaid string, position float64) (bool, error) {
+	media, err := FindMedia(mediaid)
+	if err != nil {
+		return false, err
+	}
+	if FinishThreshold > 0 && media.Duration > 0 && position >= FinishThreshold*media.Duration {
+		err := FinishMedia(userid, mediaid)
+		if err == ErrAlreadyFinished {
+			err = nil
+		}
+		return err == nil, err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	if position > 0 {
+		var count int
+		q := `SELECT COUNT(*) FROM UserFinishedMedia WHERE MediaId = ? AND UserId = ?`
+		err = tx.QueryRow(q, mediaid, userid).Scan(&count)
+		if err != nil {
+			tx.Rollback()
+			return false, err
+		}
+		if count > 0 {
+			err = tx.Rollback()
+			return false, err
+		}
+	}
+	q := `DELETE FROM UserFinishedMedia WHERE MediaId = ? AND UserId = ?`
+	_, err = tx.Exec(q, mediaid, userid)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	q = `INSERT OR IGNORE INTO UserStartedMedia(MediaId, UserId) VALUES(?, ?)`
+	res, err := tx.Exec(q, mediaid, userid)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	started := false
+	if n, _ := res.RowsAffected(); n > 0 {
+		started = true
+		err = recordWatchEvent(tx, userid, mediaid, EventStarted, position)
+	} else {
+		err = recordPositionEvent(tx, userid, mediaid, position)
+	}
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	q = `UPDATE UserStartedMedia SET Position = ?, Updated = ?
+		WHERE MediaId = ? AND UserId = ?`
+	_, err = tx.Exec(q, position, time.Now(), mediaid, userid)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	err = tx.Commit()
+	if err == nil && started {
+		publishProgress(event.ProgressStarted, userid, mediaid)
+	}
+	return false, err
+}
+
+// The last position recorded for media the user has started. Zero is
+// returned if the user has not started the media.
+func FindPosition(userid, mediaid string) (float64, error) {
+	q := `SELECT Position FROM UserStartedMedia WHERE MediaId = ? AND UserId = ?`
+	var position float64
+	err := DB.QueryRow(q, mediaid, userid).Scan(&position)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return position, err
+}
@@ -0,0 +1,95 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// progress_test.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdatePosition(t *testing.T) {
+	DBTest(t, func() {
+		userid, err := LocateOrCreateUserByEmail("test@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		mod := time.Date(2013, 8, 3, 12, 0, 0, 0, time.UTC)
+		id, _ := testSyncMedia(t, "/media", "/media/a.mkv", 10, mod)
+		err = UpdateMediaInfo(id, &MediaInfo{Duration: 1000})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		finished, err := UpdatePosition(userid, id, 420.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if finished {
+			t.Errorf("finished early")
+		}
+		pos, err := FindPosition(userid, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pos != 420.5 {
+			t.Errorf("position: %v", pos)
+		}
+		inprogress, _, err := ListInProgress(&ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(inprogress) != 1 || inprogress[0].Position != 420.5 || inprogress[0].Updated == nil {
+			t.Errorf("in progress: %+v", inprogress)
+		}
+
+		finished, err = UpdatePosition(userid, id, 905)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !finished {
+			t.Errorf("not finished past the threshold")
+		}
+		// late heartbeats are ignored.
+		finished, err = UpdatePosition(userid, id, 910)
+		if err != nil || !finished {
+			t.Errorf("late heartbeat: %v %v", finished, err)
+		}
+		finishedList, _, err := ListFinished(&ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(finishedList) != 1 {
+			t.Errorf("finished: %v", finishedList)
+		}
+
+		// a late report of an earlier position is ignored.
+		_, err = UpdatePosition(userid, id, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		finishedList, _, err = ListFinished(&ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(finishedList) != 1 {
+			t.Errorf("finished after late position: %v", finishedList)
+		}
+
+		// rewatching from the beginning starts the media again.
+		_, err = UpdatePosition(userid, id, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		finishedList, _, err = ListFinished(&ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(finishedList) != 0 {
+			t.Errorf("finished after rewatch: %v", finishedList)
+		}
+	})
+}
@@ -0,0 +1,238 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// role.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"sort"
+)
+
+var ErrInvalidRole = errors.New("invalid role name")
+
+// Roles seeded by the migrations. Viewers need no permission to track their
+// own progress.
+const (
+	RoleViewer  = "viewer"
+	RoleCurator = "curator"
+	RoleAdmin   = "admin"
+)
+
+var validRoleName = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// A named set of permissions granted to every user assigned the role.
+type Role struct {
+	Name        string       `json:"name"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// All roles ordered by name.
+func AllRoles() ([]*Role, error) {
+	rows, err := DB.Query(`
+		SELECT r.RoleName, rp.PermissionName
+		FROM Roles AS r
+		LEFT JOIN RolePermissions AS rp ON rp.RoleName = r.RoleName
+		ORDER BY r.RoleName, rp.PermissionName
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := make([]*Role, 0, 5)
+	for rows.Next() {
+		var name string
+		var perm sql.NullString
+		err := rows.Scan(&name, &perm)
+		if err != nil {
+			return nil, err
+		}
+		if len(roles) == 0 || roles[len(roles)-1].Name != name {
+			roles = append(roles, &Role{Name: name, Permissions: []Permission{}})
+		}
+		if perm.Valid {
+			r := roles[len(roles)-1]
+			r.Permissions = append(r.Permissions, Permission(perm.String))
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// sql.ErrNoRows is returned if the role does not exist.
+func FindRole(name string) (*Role, error) {
+	roles, err := AllRoles()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range roles {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// Create a role or replace the permissions of an existing one.
+func SaveRole(name string, perms []Permission) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	err = saveRole(tx, name, perms)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func saveRole(tx *sql.Tx, name string, perms []Permission) error {
+	if !validRoleName.MatchString(name) {
+		return ErrInvalidRole
+	}
+	for _, perm := range perms {
+		_, err := ParsePermission(string(perm))
+		if err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`INSERT OR IGNORE INTO Roles(RoleName) VALUES (?)`, name)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM RolePermissions WHERE RoleName = ?`, name)
+	if err != nil {
+		return err
+	}
+	for _, perm := range perms {
+		q := `INSERT INTO RolePermissions(RoleName, PermissionName) VALUES (?, ?)`
+		_, err := tx.Exec(q, name, string(perm))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save every role in roles, as given in the config file. Roles not in the
+// map are left alone.
+func DefineRoles(roles map[string][]Permission) error {
+	names := make([]string, 0, len(roles))
+	for name := range roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		err := saveRole(tx, name, roles[name])
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete a role, unassigning it from all users. sql.ErrNoRows is returned if
+// the role does not exist.
+func DeleteRole(name string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	for _, q := range []string{
+		`DELETE FROM UserRoles WHERE RoleName = ?`,
+		`DELETE FROM RolePermissions WHERE RoleName = ?`,
+	} {
+		_, err := tx.Exec(q, name)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	res, err := tx.Exec(`DELETE FROM Roles WHERE RoleName = ?`, name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// Assign a role to a user. sql.ErrNoRows is returned if the role does not
+// exist.
+func AssignRole(userid, role string) error {
+	var count int
+	err := DB.QueryRow(`SELECT COUNT(*) FROM Roles WHERE RoleName = ?`, role).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	_, err = DB.Exec(`INSERT INTO UserRoles(UserId, RoleName) VALUES (?, ?)`, userid, role)
+	return err
+}
+
+func UnassignRole(userid, role string) error {
+	_, err := DB.Exec(`DELETE FROM UserRoles WHERE UserId = ? AND RoleName = ?`, userid, role)
+	return err
+}
+
+// The names of the roles assigned to a user, in alphabetical order.
+func UserRoles(userid string) ([]string, error) {
+	rows, err := DB.Query(`SELECT RoleName FROM UserRoles WHERE UserId = ? ORDER BY RoleName`, userid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := make([]string, 0, 2)
+	for rows.Next() {
+		var role string
+		err := rows.Scan(&role)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// seed the default roles.
+func seedRoles(tx *sql.Tx) error {
+	defaults := []*Role{
+		{RoleViewer, nil},
+		{RoleCurator, []Permission{PermMediaUpdate, PermMediaDelete, PermScan}},
+		{RoleAdmin, []Permission{PermAdmin}},
+	}
+	for _, r := range defaults {
+		err := saveRole(tx, r.Name, r.Permissions)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
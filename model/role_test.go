@@ -0,0 +1,97 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// role_test.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestDefaultRoles(t *testing.T) {
+	DBTest(t, func() {
+		roles, err := AllRoles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make([]string, len(roles))
+		for i := range roles {
+			names[i] = roles[i].Name
+		}
+		if len(names) != 3 || names[0] != RoleAdmin || names[1] != RoleCurator || names[2] != RoleViewer {
+			t.Errorf("roles: %v", names)
+		}
+		admin, err := FindRole(RoleAdmin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(admin.Permissions) != 1 || admin.Permissions[0] != PermAdmin {
+			t.Errorf("admin permissions: %v", admin.Permissions)
+		}
+	})
+}
+
+func TestRolePermissions(t *testing.T) {
+	DBTest(t, func() {
+		userid, err := LocateOrCreateUserByEmail("test@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		has := func(perm Permission) bool {
+			ok, err := UserHasPermission(userid, perm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return ok
+		}
+
+		err = AssignRole(userid, "nobody")
+		if err != sql.ErrNoRows {
+			t.Errorf("unknown role: %v", err)
+		}
+		err = AssignRole(userid, RoleCurator)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !has(PermScan) || has(PermAdmin) {
+			t.Errorf("curator permissions")
+		}
+
+		err = DefineRoles(map[string][]Permission{
+			RoleCurator: {PermScan},
+			"household": {PermUserList},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !has(PermScan) || has(PermMediaDelete) {
+			t.Errorf("redefined curator permissions")
+		}
+		err = SaveRole("Bad Name", nil)
+		if err != ErrInvalidRole {
+			t.Errorf("invalid role name: %v", err)
+		}
+
+		err = GrantPermission(userid, PermMediaDelete)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = DeleteRole(RoleCurator)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has(PermScan) || !has(PermMediaDelete) {
+			t.Errorf("permissions after deleting role")
+		}
+		roles, err := UserRoles(userid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(roles) != 0 {
+			t.Errorf("roles: %v", roles)
+		}
+	})
+}
@@ -0,0 +1,275 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// search.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+var ErrEmptySearch = errors.New("empty search query")
+var ErrNoFTS5 = errors.New("built without FTS5 support; build with -tags sqlite_fts5")
+
+// Matched terms in search highlights are surrounded by these markers.
+const (
+	HighlightOpen  = "[["
+	HighlightClose = "]]"
+)
+
+// A search result. Highlights are the indexed text of the media with the
+// matched terms marked by HighlightOpen and HighlightClose.
+type SearchResult struct {
+	*Media
+	Highlights SearchHighlights `json:"highlights"`
+}
+
+type SearchHighlights struct {
+	Name   string `json:"name"`
+	Dirs   string `json:"dirs,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Series string `json:"series,omitempty"`
+}
+
+type queryExecer interface {
+	execer
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Rebuild the search index entry of media from the Media, Episodes and Series
+// tables. Call it whenever any of them change. Nothing is indexed in builds
+// without FTS5.
+func indexMedia(db queryExecer, mediaid string) error {
+	if !searchEnabled {
+		return nil
+	}
+	var root, path, title, vcodec, acodecs, alangs string
+	var height int
+	var series, eptitle sql.NullString
+	var season, episode sql.NullInt64
+	q := `SELECT m.Root, m.Path, m.Title, m.Height, m.VideoCodec,
+			m.AudioCodecs, m.AudioLanguages,
+			s.Name, e.Season, e.Episode, e.Title
+		FROM Media AS m
+		LEFT JOIN Episodes AS e ON e.MediaId = m.MediaId
+		LEFT JOIN Series AS s ON s.SeriesId = e.SeriesId
+		WHERE m.MediaId = ?`
+	err := db.QueryRow(q, mediaid).Scan(&root, &path, &title, &height, &vcodec,
+		&acodecs, &alangs,
+		&series, &season, &episode, &eptitle)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(path)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	dirs := ""
+	if rel, err := filepath.Rel(root, filepath.Dir(path)); err == nil && rel != "." {
+		dirs = strings.Join(strings.Split(rel, string(filepath.Separator)), " / ")
+	}
+	var seriesText string
+	if series.Valid {
+		seriesText = fmt.Sprintf("%s S%02dE%02d %s",
+			series.String, season.Int64, episode.Int64, eptitle.String)
+		seriesText = strings.TrimSpace(seriesText)
+	}
+	var meta []string
+	if height > 0 {
+		meta = append(meta, fmt.Sprintf("%dp", height))
+	}
+	if vcodec != "" {
+		meta = append(meta, vcodec)
+	}
+	meta = append(meta, splitList(acodecs)...)
+	meta = append(meta, splitList(alangs)...)
+
+	q = `INSERT OR IGNORE INTO MediaSearchIds(MediaId) VALUES (?)`
+	_, err = db.Exec(q, mediaid)
+	if err != nil {
+		return err
+	}
+	var searchid int64
+	q = `SELECT SearchId FROM MediaSearchIds WHERE MediaId = ?`
+	err = db.QueryRow(q, mediaid).Scan(&searchid)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`DELETE FROM MediaSearch WHERE rowid = ?`, searchid)
+	if err != nil {
+		return err
+	}
+	q = `INSERT INTO MediaSearch(rowid, Name, Dirs, Title, Series, Meta)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = db.Exec(q, searchid, name, dirs, title, seriesText, strings.Join(meta, " "))
+	return err
+}
+
+// the search index is an FTS5 table whose rows are tied to media through
+// MediaSearchIds. builds without FTS5 skip it, and ensureSearchIndex creates
+// it once the database is opened by a build with FTS5.
+func createSearchIndex(tx *sql.Tx) error {
+	if !searchEnabled {
+		return nil
+	}
+	_, err := tx.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS MediaSearch USING fts5(
+		Name, Dirs, Title, Series, Meta,
+		tokenize = 'unicode61 remove_diacritics 2'
+	)`)
+	return err
+}
+
+// index all existing media when the search index is created.
+func indexAllMedia(tx *sql.Tx) error {
+	if !searchEnabled {
+		return nil
+	}
+	rows, err := tx.Query(`SELECT MediaId FROM Media`)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		err := rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		err := indexMedia(tx, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// empty the search index, if there is one.
+func clearSearchIndex(tx *sql.Tx) error {
+	if searchEnabled {
+		_, err := tx.Exec(`DELETE FROM MediaSearch`)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`DELETE FROM MediaSearchIds`)
+	return err
+}
+
+// create and fill the search index of a database migrated by a build without
+// FTS5.
+func ensureSearchIndex() error {
+	if !searchEnabled {
+		return nil
+	}
+	var n int
+	q := `SELECT count(*) FROM sqlite_master WHERE name = 'MediaSearch'`
+	err := DB.QueryRow(q).Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	err = createSearchIndex(tx)
+	if err == nil {
+		err = indexAllMedia(tx)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Translate user input into an FTS5 query. Every word must match, and the
+// words are prefixes so results appear while a query is being typed. FTS5
+// syntax in the input is not interpreted.
+func searchQuery(input string) string {
+	var terms []string
+	for _, word := range strings.Fields(input) {
+		word = strings.Replace(word, `"`, "", -1)
+		if word != "" {
+			terms = append(terms, `"`+word+`"*`)
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// Media in roots matching query that is not missing, best match first. At
+// most limit results are returned. The roots are unrestricted when nil, like
+// ListOptions.Roots. ErrNoFTS5 is returned by builds without FTS5.
+func SearchMedia(query string, limit int, roots []string) ([]*SearchResult, error) {
+	if !searchEnabled {
+		return nil, ErrNoFTS5
+	}
+	match := searchQuery(query)
+	if match == "" {
+		return nil, ErrEmptySearch
+	}
+	cond, rootArgs := rootsCond("Media.Root", roots)
+	args := []interface{}{
+		HighlightOpen, HighlightClose,
+		HighlightOpen, HighlightClose,
+		HighlightOpen, HighlightClose,
+		HighlightOpen, HighlightClose,
+		match,
+	}
+	args = append(args, rootArgs...)
+	args = append(args, limit)
+	// file names and titles say more about media than its directories or
+	// codecs do.
+	rows, err := DB.Query(`
+		SELECT `+mediaColumns+`, s.HName, s.HDirs, s.HTitle, s.HSeries
+		FROM (
+			SELECT i.MediaId AS SearchMediaId,
+				highlight(MediaSearch, 0, ?, ?) AS HName,
+				highlight(MediaSearch, 1, ?, ?) AS HDirs,
+				highlight(MediaSearch, 2, ?, ?) AS HTitle,
+				highlight(MediaSearch, 3, ?, ?) AS HSeries,
+				bm25(MediaSearch, 10.0, 2.0, 8.0, 6.0, 1.0) AS Score
+			FROM MediaSearch
+			JOIN MediaSearchIds AS i ON i.SearchId = MediaSearch.rowid
+			WHERE MediaSearch MATCH ?
+		) AS s
+		JOIN Media ON Media.MediaId = s.SearchMediaId
+		WHERE Media.Missing IS NULL AND `+cond+`
+		ORDER BY s.Score, Media.Path
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*SearchResult, 0, limit)
+	for rows.Next() {
+		r := new(SearchResult)
+		h := &r.Highlights
+		m, err := scanMediaRow(rows, &h.Name, &h.Dirs, &h.Title, &h.Series)
+		if err != nil {
+			return nil, err
+		}
+		r.Media = m
+		results = append(results, r)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
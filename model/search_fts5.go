@@ -0,0 +1,13 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// search_fts5.go [created: Sun, 18 Oct 2026]
+
+//go:build sqlite_fts5
+// +build sqlite_fts5
+
+package model
+
+// go-sqlite3 only compiles in FTS5 with the sqlite_fts5 build tag.
+const searchEnabled = true
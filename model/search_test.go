@@ -0,0 +1,147 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// search_test.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSearchQuery(t *testing.T) {
+	for _, test := range []struct {
+		input, query string
+	}{
+		{"", ""},
+		{`  " `, ""},
+		{"star", `"star"*`},
+		{"Star  wars", `"Star"* "wars"*`},
+		{`the "OR" NEAR(x`, `"the"* "OR"* "NEAR(x"*`},
+	} {
+		if q := searchQuery(test.input); q != test.query {
+			t.Errorf("%q: %q != %q", test.input, q, test.query)
+		}
+	}
+}
+
+func TestSearchMedia(t *testing.T) {
+	if !searchEnabled {
+		DBTest(t, func() {
+			_, err := SearchMedia("star", 10, nil)
+			if err != ErrNoFTS5 {
+				t.Errorf("search without FTS5: %v", err)
+			}
+		})
+		t.Skip("built without FTS5")
+	}
+	DBTest(t, func() {
+		mod := time.Date(2013, 8, 3, 12, 0, 0, 0, time.UTC)
+		a, _ := testSyncMedia(t, "/media", "/media/Movies/Star Wars (1977).mkv", 10, mod)
+		b, _ := testSyncMedia(t, "/media", "/media/Documentaries/stars.and.galaxies.mp4", 11, mod)
+		c, _ := testSyncMedia(t, "/media", "/media/TV/show.s01e02.mkv", 12, mod)
+		d, _ := testSyncMedia(t, "/media", "/media/Star/other.mkv", 13, mod)
+		err := SyncEpisode(c, &EpisodeInfo{"Show", 1, 2, "Starlight"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = UpdateMediaInfo(b, &MediaInfo{Height: 1080, AudioLanguages: []string{"eng"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := func(rs []*SearchResult) []string {
+			var ids []string
+			for _, r := range rs {
+				ids = append(ids, r.Id)
+			}
+			return ids
+		}
+
+		rs, err := SearchMedia("star", 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 4 {
+			t.Fatalf("star: %v", ids(rs))
+		}
+		// file names outrank directories.
+		if rs[len(rs)-1].Id != d {
+			t.Errorf("star: %v", ids(rs))
+		}
+		for _, r := range rs {
+			if r.Id == a && r.Highlights.Name != "[[Star]] Wars (1977)" {
+				t.Errorf("name highlight: %q", r.Highlights.Name)
+			}
+			if r.Id == c && r.Highlights.Series != "Show S01E02 [[Starlight]]" {
+				t.Errorf("series highlight: %q", r.Highlights.Series)
+			}
+		}
+
+		rs, err = SearchMedia("STAR wars", 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 1 || rs[0].Id != a {
+			t.Errorf("star wars: %v", ids(rs))
+		}
+
+		rs, err = SearchMedia("1080p eng", 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 1 || rs[0].Id != b {
+			t.Errorf("metadata: %v", ids(rs))
+		}
+
+		rs, err = SearchMedia("s01e02", 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 1 || rs[0].Id != c {
+			t.Errorf("episode: %v", ids(rs))
+		}
+
+		e, _ := testSyncMedia(t, "/other", "/other/Star Trek.mkv", 14, mod)
+		rs, err = SearchMedia("star", 10, []string{"/other"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 1 || rs[0].Id != e {
+			t.Errorf("roots: %v", ids(rs))
+		}
+		rs, err = SearchMedia("star", 2, []string{"/media"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 2 || rs[0].Id == e || rs[1].Id == e {
+			t.Errorf("limit: %v", ids(rs))
+		}
+		rs, err = SearchMedia("star", 10, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 0 {
+			t.Errorf("no roots: %v", ids(rs))
+		}
+
+		_, _, err = SyncMedia("/media", "/media/Movies/Star Wars (1977).mkv", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs, err = SearchMedia("wars", 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 0 {
+			t.Errorf("missing: %v", ids(rs))
+		}
+
+		_, err = SearchMedia(` " `, 10, nil)
+		if err != ErrEmptySearch {
+			t.Errorf("empty: %v", err)
+		}
+	})
+}
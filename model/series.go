@@ -0,0 +1,265 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// series.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// A TV series. Seasons and Episodes only count episodes with media that is
+// not missing.
+type Series struct {
+	Id       string    `json:"seriesId"`
+	Name     string    `json:"name"`
+	Created  time.Time `json:"created"`
+	Seasons  int       `json:"seasons"`
+	Episodes int       `json:"episodes"`
+}
+
+type Season struct {
+	SeriesId string `json:"seriesId"`
+	Season   int    `json:"season"`
+	Episodes int    `json:"episodes"`
+}
+
+// A media file containing an episode of a series. A single episode may have
+// several media files (e.g. at different qualities).
+type Episode struct {
+	MediaId  string `json:"mediaId"`
+	SeriesId string `json:"seriesId"`
+	Season   int    `json:"season"`
+	Episode  int    `json:"episode"`
+	Title    string `json:"title,omitempty"`
+	Media    *Media `json:"media"`
+}
+
+// Series, season and episode numbers parsed from a media path.
+type EpisodeInfo struct {
+	Series  string
+	Season  int
+	Episode int
+	Title   string
+}
+
+// the SeriesId for a series name. names that differ only in case and
+// punctuation belong to the same series.
+func seriesId(name string) string {
+	return getsha1(normSeriesName(name))
+}
+
+func normSeriesName(name string) string {
+	name = strings.ToLower(name)
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(".,_-:'!?", r) {
+			return ' '
+		}
+		return r
+	}, name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// Link the media with the episode described by ep, creating the series and
+// season if they do not exist. A nil ep removes any existing link. Nothing is
+// written when the media is already linked to the episode.
+func SyncEpisode(mediaid string, ep *EpisodeInfo) error {
+	if ep == nil {
+		q := `DELETE FROM Episodes WHERE MediaId = ?`
+		res, err := DB.Exec(q, mediaid)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil || n == 0 {
+			return err
+		}
+		return indexMedia(DB, mediaid)
+	}
+
+	id := seriesId(ep.Series)
+	q := `SELECT SeriesId, Season, Episode, Title FROM Episodes WHERE MediaId = ?`
+	var cur EpisodeInfo
+	var curid string
+	err := DB.QueryRow(q, mediaid).Scan(&curid, &cur.Season, &cur.Episode, &cur.Title)
+	if err == nil && curid == id && cur.Season == ep.Season && cur.Episode == ep.Episode && cur.Title == ep.Title {
+		return nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	q = `INSERT OR IGNORE INTO Series (SeriesId, Name) VALUES (?, ?)`
+	_, err = tx.Exec(q, id, ep.Series)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	q = `INSERT INTO Seasons (SeriesId, Season) VALUES (?, ?)`
+	_, err = tx.Exec(q, id, ep.Season)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	q = `INSERT INTO Episodes (MediaId, SeriesId, Season, Episode, Title)
+		VALUES (?, ?, ?, ?, ?)`
+	_, err = tx.Exec(q, mediaid, id, ep.Season, ep.Episode, ep.Title)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = indexMedia(tx, mediaid)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// an SQL condition restricting column to roots, which are unrestricted when
+// nil and match nothing when empty, like ListOptions.Roots.
+func rootsCond(column string, roots []string) (string, []interface{}) {
+	if roots == nil {
+		return "1", nil
+	}
+	if len(roots) == 0 {
+		return "0", nil
+	}
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(roots)), ", ")
+	args := make([]interface{}, len(roots))
+	for i, root := range roots {
+		args[i] = root
+	}
+	return column + ` IN (` + marks + `)`, args
+}
+
+// All series with at least one episode in roots, ordered by name. The roots
+// are unrestricted when nil, like ListOptions.Roots.
+func AllSeries(roots []string) ([]*Series, error) {
+	cond, args := rootsCond("M.Root", roots)
+	rows, err := DB.Query(`
+		SELECT S.SeriesId, S.Name, S.Created,
+			COUNT(DISTINCT E.Season), COUNT(DISTINCT E.Season || '.' || E.Episode)
+		FROM Series AS S
+		JOIN Episodes AS E ON E.SeriesId = S.SeriesId
+		JOIN Media AS M ON M.MediaId = E.MediaId
+		WHERE M.Missing IS NULL AND `+cond+`
+		GROUP BY S.SeriesId
+		ORDER BY S.Name COLLATE NOCASE
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ss := make([]*Series, 0, 20)
+	for rows.Next() {
+		s := new(Series)
+		err := rows.Scan(&s.Id, &s.Name, &s.Created, &s.Seasons, &s.Episodes)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+// Returns sql.ErrNoRows if the series has no episodes in roots.
+func FindSeries(id string, roots []string) (*Series, error) {
+	cond, args := rootsCond("M.Root", roots)
+	row := DB.QueryRow(`
+		SELECT S.SeriesId, S.Name, S.Created,
+			COUNT(DISTINCT E.Season), COUNT(DISTINCT E.Season || '.' || E.Episode)
+		FROM Series AS S
+		JOIN Episodes AS E ON E.SeriesId = S.SeriesId
+		JOIN Media AS M ON M.MediaId = E.MediaId
+		WHERE S.SeriesId = ? AND M.Missing IS NULL AND `+cond+`
+		GROUP BY S.SeriesId
+	`, append([]interface{}{id}, args...)...)
+	s := new(Series)
+	err := row.Scan(&s.Id, &s.Name, &s.Created, &s.Seasons, &s.Episodes)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// The seasons of a series with at least one episode in roots, in order.
+func SeriesSeasons(id string, roots []string) ([]*Season, error) {
+	cond, args := rootsCond("M.Root", roots)
+	rows, err := DB.Query(`
+		SELECT E.SeriesId, E.Season, COUNT(DISTINCT E.Episode)
+		FROM Episodes AS E
+		JOIN Media AS M ON M.MediaId = E.MediaId
+		WHERE E.SeriesId = ? AND M.Missing IS NULL AND `+cond+`
+		GROUP BY E.SeriesId, E.Season
+		ORDER BY E.Season
+	`, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ss := make([]*Season, 0, 10)
+	for rows.Next() {
+		s := new(Season)
+		err := rows.Scan(&s.SeriesId, &s.Season, &s.Episodes)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+// The episodes in roots of a season of a series, in order. If season is
+// negative episodes from all seasons are returned.
+func SeriesEpisodes(id string, season int, roots []string) ([]*Episode, error) {
+	cond, args := rootsCond("M.Root", roots)
+	rows, err := DB.Query(`
+		SELECT E.MediaId, E.SeriesId, E.Season, E.Episode, E.Title
+		FROM Episodes AS E
+		JOIN Media AS M ON M.MediaId = E.MediaId
+		WHERE E.SeriesId = ? AND (? < 0 OR E.Season = ?) AND M.Missing IS NULL AND `+cond+`
+		ORDER BY E.Season, E.Episode, M.Path
+	`, append([]interface{}{id, season, season}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	eps := make([]*Episode, 0, 20)
+	for rows.Next() {
+		e := new(Episode)
+		err := rows.Scan(&e.MediaId, &e.SeriesId, &e.Season, &e.Episode, &e.Title)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		eps = append(eps, e)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range eps {
+		e.Media, err = FindMedia(e.MediaId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return eps, nil
+}
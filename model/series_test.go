@@ -0,0 +1,103 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// series_test.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestSeries(t *testing.T) {
+	DBTest(t, func() {
+		mod := time.Date(2013, 8, 3, 12, 0, 0, 0, time.UTC)
+		a, _ := testSyncMedia(t, "/tv", "/tv/show.s01e01.mkv", 10, mod)
+		b, _ := testSyncMedia(t, "/tv", "/tv/show.s01e02.mkv", 11, mod)
+		c, _ := testSyncMedia(t, "/tv", "/tv/Show/Season 2/01.mkv", 12, mod)
+		for _, link := range []struct {
+			id string
+			ep *EpisodeInfo
+		}{
+			{a, &EpisodeInfo{"show", 1, 1, ""}},
+			{b, &EpisodeInfo{"show", 1, 2, ""}},
+			{c, &EpisodeInfo{"Show", 2, 1, "Premiere"}},
+		} {
+			err := SyncEpisode(link.id, link.ep)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		series, err := AllSeries(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(series) != 1 {
+			t.Fatalf("series: %v", series)
+		}
+		if series[0].Seasons != 2 || series[0].Episodes != 3 {
+			t.Errorf("counts: %+v", series[0])
+		}
+
+		eps, err := SeriesEpisodes(series[0].Id, 1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(eps) != 2 || eps[0].MediaId != a || eps[1].MediaId != b {
+			t.Errorf("season 1: %v", eps)
+		}
+
+		// series outside the given roots are hidden.
+		hidden, err := AllSeries([]string{"/films"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hidden) != 0 {
+			t.Errorf("series outside roots: %v", hidden)
+		}
+		_, err = FindSeries(series[0].Id, []string{})
+		if err != sql.ErrNoRows {
+			t.Errorf("series outside roots: %v", err)
+		}
+		eps, err = SeriesEpisodes(series[0].Id, -1, []string{"/films"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(eps) != 0 {
+			t.Errorf("episodes outside roots: %v", eps)
+		}
+		if s, err := FindSeries(series[0].Id, []string{"/tv"}); err != nil || s.Episodes != 3 {
+			t.Errorf("series in roots: %v %v", s, err)
+		}
+
+		// unlinking the only episode in season 2 removes the season.
+		err = SyncEpisode(c, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seasons, err := SeriesSeasons(series[0].Id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(seasons) != 1 || seasons[0].Season != 1 || seasons[0].Episodes != 2 {
+			t.Errorf("seasons: %v", seasons)
+		}
+
+		// missing media is not listed.
+		_, _, err = SyncMedia("/tv", "/tv/show.s01e02.mkv", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eps, err = SeriesEpisodes(series[0].Id, -1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(eps) != 1 || eps[0].MediaId != a {
+			t.Errorf("all episodes: %v", eps)
+		}
+	})
+}
@@ -0,0 +1,265 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// token.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrTokenExpired = errors.New("access token expired")
+var ErrTooManyTokens = errors.New("too many access tokens")
+var ErrInvalidScope = errors.New("invalid scope")
+
+// The most access tokens a user can hold at once.
+var MaxAccessTokens = 50
+
+// LastUsed is updated at most once per AccessTokenUseInterval to avoid a
+// write on every request.
+var AccessTokenUseInterval = time.Minute
+
+// A scope limits the requests an access token can authorize.
+type Scope string
+
+const (
+	ScopeAll           Scope = "all"            // any request the user could make
+	ScopeRead          Scope = "read"           // requests that do not change state
+	ScopeProgressWrite Scope = "progress-write" // starting, finishing and clearing media
+)
+
+func ParseScope(s string) (Scope, error) {
+	switch scope := Scope(s); scope {
+	case ScopeAll, ScopeRead, ScopeProgressWrite:
+		return scope, nil
+	}
+	return "", ErrInvalidScope
+}
+
+// An access token's metadata. The token itself is only known when it is
+// created; the database stores its hash.
+type AccessToken struct {
+	Id       string     `json:"tokenId"`
+	UserId   string     `json:"userId"`
+	Name     string     `json:"name"`
+	Scopes   []Scope    `json:"scopes"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
+
+// true if the token grants scope.
+func (at *AccessToken) HasScope(scope Scope) bool {
+	for _, s := range at.Scopes {
+		if s == scope || s == ScopeAll {
+			return true
+		}
+	}
+	return false
+}
+
+func accessTokenHash(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.ToLower(token))))
+}
+
+func joinScopes(scopes []Scope) string {
+	ss := make([]string, len(scopes))
+	for i := range scopes {
+		ss[i] = string(scopes[i])
+	}
+	return joinList(ss)
+}
+
+func splitScopes(s string) []Scope {
+	ss := splitList(s)
+	scopes := make([]Scope, len(ss))
+	for i := range ss {
+		scopes[i] = Scope(ss[i])
+	}
+	return scopes
+}
+
+const accessTokenColumns = `TokenId, UserId, Name, Scopes, Created, LastUsed, Expires`
+
+func scanAccessTokenRow(row rowScanner) (*AccessToken, error) {
+	at := new(AccessToken)
+	var scopes string
+	err := row.Scan(&at.Id, &at.UserId, &at.Name, &scopes, &at.Created, &at.LastUsed, &at.Expires)
+	if err != nil {
+		return nil, err
+	}
+	at.Scopes = splitScopes(scopes)
+	return at, nil
+}
+
+// Create an access token for the user. The token is returned with its
+// metadata and cannot be retrieved again. A nil expires never expires.
+func CreateAccessToken(userid, name string, scopes []Scope, expires *time.Time) (string, *AccessToken, error) {
+	if len(scopes) == 0 {
+		return "", nil, ErrInvalidScope
+	}
+	for _, s := range scopes {
+		_, err := ParseScope(string(s))
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	token, err := randomHex(20)
+	if err != nil {
+		return "", nil, err
+	}
+	at := &AccessToken{
+		UserId:  userid,
+		Name:    name,
+		Scopes:  scopes,
+		Created: time.Now().UTC(),
+		Expires: expires,
+	}
+	at.Id, err = randomHex(8)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", nil, err
+	}
+	var count int
+	q := `SELECT COUNT(*) FROM AccessTokens WHERE UserId = ?`
+	err = tx.QueryRow(q, userid).Scan(&count)
+	if err != nil {
+		tx.Rollback()
+		return "", nil, err
+	}
+	if count >= MaxAccessTokens {
+		tx.Rollback()
+		return "", nil, ErrTooManyTokens
+	}
+	q = `INSERT INTO AccessTokens(TokenId, TokenHash, UserId, Name, Scopes, Created, Expires)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.Exec(q, at.Id, accessTokenHash(token), userid, name, joinScopes(scopes), at.Created, expires)
+	if err != nil {
+		tx.Rollback()
+		return "", nil, err
+	}
+	return token, at, tx.Commit()
+}
+
+// Create an unnamed access token with ScopeAll.
+func CreateAccessTokenForUser(userid string) (string, error) {
+	token, _, err := CreateAccessToken(userid, "", []Scope{ScopeAll}, nil)
+	return token, err
+}
+
+// The user's access tokens, newest first.
+func UserAccessTokens(userid string) ([]*AccessToken, error) {
+	q := `SELECT ` + accessTokenColumns + `
+		FROM AccessTokens
+		WHERE UserId = ?
+		ORDER BY Created DESC, TokenId`
+	rows, err := DB.Query(q, userid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := make([]*AccessToken, 0, 10)
+	for rows.Next() {
+		at, err := scanAccessTokenRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, at)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Find the metadata of an unexpired access token and record its use.
+// sql.ErrNoRows is returned if the token does not exist and ErrTokenExpired if
+// it has expired.
+func FindAccessToken(token string) (*AccessToken, error) {
+	q := `SELECT ` + accessTokenColumns + ` FROM AccessTokens WHERE TokenHash = ?`
+	at, err := scanAccessTokenRow(DB.QueryRow(q, accessTokenHash(token)))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if at.Expires != nil && now.After(*at.Expires) {
+		return nil, ErrTokenExpired
+	}
+	if at.LastUsed == nil || now.Sub(*at.LastUsed) > AccessTokenUseInterval {
+		q = `UPDATE AccessTokens SET LastUsed = ? WHERE TokenId = ?`
+		_, err = DB.Exec(q, now, at.Id)
+		if err != nil {
+			return nil, err
+		}
+		at.LastUsed = &now
+	}
+	return at, nil
+}
+
+// Revoke one of the user's access tokens. sql.ErrNoRows is returned if the
+// user has no token with the given id.
+func RevokeAccessToken(userid, tokenid string) error {
+	q := `DELETE FROM AccessTokens WHERE UserId = ? AND TokenId = ?`
+	res, err := DB.Exec(q, userid, tokenid)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// replace the plaintext tokens of the original AccessTokens table with hashes.
+// the tokens keep full access.
+func hashPlainAccessTokens(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT UserId, AccessToken FROM AccessTokensPlain`)
+	if err != nil {
+		return err
+	}
+	type plain struct{ userid, token string }
+	var tokens []plain
+	for rows.Next() {
+		var p plain
+		err := rows.Scan(&p.userid, &p.token)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		tokens = append(tokens, p)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	for _, p := range tokens {
+		id, err := randomHex(8)
+		if err != nil {
+			return err
+		}
+		q := `INSERT INTO AccessTokens(TokenId, TokenHash, UserId, Scopes) VALUES (?, ?, ?, ?)`
+		_, err = tx.Exec(q, id, accessTokenHash(p.token), p.userid, string(ScopeAll))
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`DROP TABLE AccessTokensPlain`)
+	return err
+}
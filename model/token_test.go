@@ -0,0 +1,140 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// token_test.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestAccessToken(t *testing.T) {
+	DBTest(t, func() {
+		userid, err := LocateOrCreateUserByEmail("test@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, at, err := CreateAccessToken(userid, "scrobbler", []Scope{ScopeProgressWrite}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stored int
+		err = DB.QueryRow(`SELECT COUNT(*) FROM AccessTokens WHERE TokenHash = ?`, token).Scan(&stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored != 0 {
+			t.Errorf("token stored in plaintext")
+		}
+
+		found, err := FindAccessToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.Id != at.Id || found.UserId != userid || found.Name != "scrobbler" {
+			t.Errorf("token: %#v", found)
+		}
+		if found.LastUsed == nil {
+			t.Errorf("use not recorded")
+		}
+		if !found.HasScope(ScopeProgressWrite) || found.HasScope(ScopeRead) || found.HasScope(ScopeAll) {
+			t.Errorf("scopes: %v", found.Scopes)
+		}
+		_, err = FindAccessToken("0123456789abcdef")
+		if err != sql.ErrNoRows {
+			t.Errorf("unknown token: %v", err)
+		}
+
+		expires := time.Now().Add(-time.Minute)
+		expired, _, err := CreateAccessToken(userid, "old", []Scope{ScopeAll}, &expires)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = FindAccessToken(expired)
+		if err != ErrTokenExpired {
+			t.Errorf("expired token: %v", err)
+		}
+
+		_, _, err = CreateAccessToken(userid, "bad", []Scope{"everything"}, nil)
+		if err != ErrInvalidScope {
+			t.Errorf("invalid scope: %v", err)
+		}
+
+		tokens, err := UserAccessTokens(userid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tokens) != 2 {
+			t.Errorf("tokens: %d", len(tokens))
+		}
+
+		err = RevokeAccessToken("someone-else", at.Id)
+		if err != sql.ErrNoRows {
+			t.Errorf("revoked another user's token: %v", err)
+		}
+		err = RevokeAccessToken(userid, at.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = FindAccessToken(token)
+		if err != sql.ErrNoRows {
+			t.Errorf("revoked token: %v", err)
+		}
+	})
+}
+
+func TestAccessTokenLimit(t *testing.T) {
+	DBTest(t, func() {
+		max := MaxAccessTokens
+		MaxAccessTokens = 2
+		defer func() { MaxAccessTokens = max }()
+		for i := 0; i < 2; i++ {
+			_, err := CreateAccessTokenForUser("abc")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := CreateAccessTokenForUser("abc")
+		if err != ErrTooManyTokens {
+			t.Errorf("token limit: %v", err)
+		}
+	})
+}
+
+func TestHashPlainAccessTokens(t *testing.T) {
+	DBTest(t, func() {
+		tx, err := DB.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		_, err = tx.Exec(`CREATE TABLE AccessTokensPlain(UserId TEXT, AccessToken TEXT)`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tx.Exec(`INSERT INTO AccessTokensPlain VALUES ('abc', '00ff00ff')`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = hashPlainAccessTokens(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		at, err := FindAccessToken("00FF00FF")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if at.UserId != "abc" || !at.HasScope(ScopeAll) {
+			t.Errorf("token: %#v", at)
+		}
+	})
+}
@@ -0,0 +1,278 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// upnext.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"database/sql"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Series and directories without any activity for UpNextIdle are considered
+// abandoned and are left out of UpNext. Zero disables the limit.
+var UpNextIdle = 60 * 24 * time.Hour
+
+// The next item a user should watch in a series or directory they have
+// started. Media without episode information is grouped by directory.
+type UpNextItem struct {
+	Group        string    `json:"group"` // series name or directory path
+	SeriesId     string    `json:"seriesId,omitempty"`
+	Episode      *Episode  `json:"episode,omitempty"`
+	Media        *Media    `json:"media"`
+	InProgress   bool      `json:"inProgress"`
+	LastActivity time.Time `json:"lastActivity"`
+}
+
+type upNextGroup struct {
+	name     string
+	seriesId string
+	dir      string
+	last     time.Time
+	started  map[string]time.Time
+	finished map[string]bool
+}
+
+// The next unfinished item in each series or directory the user has started,
+// most recently active first. The most recently started item in a group is
+// next if it is unfinished. Otherwise the item following the last finished
+// one (in natural order) is next. Groups with nothing left to watch are
+// omitted. Only media in roots is considered, which are unrestricted when nil
+// like ListOptions.Roots.
+func UpNext(userid string, roots []string) ([]*UpNextItem, error) {
+	groups, err := upNextGroups(userid, roots)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*UpNextItem, 0, len(groups))
+	for _, g := range groups {
+		if UpNextIdle > 0 && time.Since(g.last) > UpNextIdle {
+			continue
+		}
+		item, err := g.next(roots)
+		if err != nil {
+			return nil, err
+		}
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+	sort.Sort(upNextByActivity(items))
+	return items, nil
+}
+
+// collect the user's progress into groups.
+func upNextGroups(userid string, roots []string) (map[string]*upNextGroup, error) {
+	groups := make(map[string]*upNextGroup)
+	err := collectUpNext(groups, userid, roots, "UserStartedMedia", "Started", false)
+	if err != nil {
+		return nil, err
+	}
+	err = collectUpNext(groups, userid, roots, "UserFinishedMedia", "Finished", true)
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func collectUpNext(groups map[string]*upNextGroup, userid string, roots []string, table, column string, finished bool) error {
+	cond, args := rootsCond("M.Root", roots)
+	rows, err := DB.Query(`
+		SELECT P.MediaId, P.`+column+`, M.Path, S.SeriesId, S.Name
+		FROM `+table+` AS P
+		JOIN Media AS M ON M.MediaId = P.MediaId
+		LEFT JOIN Episodes AS E ON E.MediaId = P.MediaId
+		LEFT JOIN Series AS S ON S.SeriesId = E.SeriesId
+		WHERE P.UserId = ? AND M.Missing IS NULL AND `+cond+`
+	`, append([]interface{}{userid}, args...)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mediaid, path string
+		var t time.Time
+		var seriesid, name sql.NullString
+		err := rows.Scan(&mediaid, &t, &path, &seriesid, &name)
+		if err != nil {
+			return err
+		}
+		key := "series:" + seriesid.String
+		if !seriesid.Valid {
+			key = "dir:" + filepath.Dir(path)
+		}
+		g := groups[key]
+		if g == nil {
+			g = &upNextGroup{
+				name:     name.String,
+				seriesId: seriesid.String,
+				started:  make(map[string]time.Time),
+				finished: make(map[string]bool),
+			}
+			if !seriesid.Valid {
+				g.dir = filepath.Dir(path)
+				g.name = g.dir
+			}
+			groups[key] = g
+		}
+		if t.After(g.last) {
+			g.last = t
+		}
+		if finished {
+			g.finished[mediaid] = true
+		} else {
+			g.started[mediaid] = t
+		}
+	}
+	return rows.Err()
+}
+
+func (g *upNextGroup) next(roots []string) (*UpNextItem, error) {
+	var media []*Media
+	var episodes []*Episode
+	if g.seriesId != "" {
+		var err error
+		episodes, err = SeriesEpisodes(g.seriesId, -1, roots)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range episodes {
+			media = append(media, e.Media)
+		}
+	} else {
+		var err error
+		media, err = dirMedia(g.dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// an unfinished item the user most recently started.
+	next := -1
+	var started time.Time
+	for i, m := range media {
+		if t, ok := g.started[m.Id]; ok && t.After(started) {
+			next, started = i, t
+		}
+	}
+	if next < 0 {
+		last := -1
+		for i, m := range media {
+			if g.finished[m.Id] {
+				last = i
+			}
+		}
+		// skip other files for the same episode.
+		for next = last + 1; next < len(media); next++ {
+			if episodes == nil || last < 0 || !sameEpisode(episodes[next], episodes[last]) {
+				break
+			}
+		}
+		if next >= len(media) {
+			return nil, nil
+		}
+	}
+
+	item := &UpNextItem{
+		Group:        g.name,
+		SeriesId:     g.seriesId,
+		Media:        media[next],
+		InProgress:   !started.IsZero(),
+		LastActivity: g.last,
+	}
+	if episodes != nil {
+		item.Episode = episodes[next]
+	}
+	return item, nil
+}
+
+func sameEpisode(a, b *Episode) bool {
+	return a.Season == b.Season && a.Episode == b.Episode
+}
+
+// media directly inside dir in natural order.
+func dirMedia(dir string) ([]*Media, error) {
+	rows, err := DB.Query(`
+		SELECT `+mediaColumns+`
+		FROM Media
+		WHERE instr(Path, ?) = 1 AND Missing IS NULL
+	`, dir+string(filepath.Separator))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ms []*Media
+	for rows.Next() {
+		m, err := scanMediaRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		if filepath.Dir(m.Path) == dir {
+			ms = append(ms, m)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(mediaByPath(ms))
+	return ms, nil
+}
+
+type mediaByPath []*Media
+
+func (ms mediaByPath) Len() int           { return len(ms) }
+func (ms mediaByPath) Less(i, j int) bool { return naturalLess(ms[i].Path, ms[j].Path) }
+func (ms mediaByPath) Swap(i, j int)      { ms[i], ms[j] = ms[j], ms[i] }
+
+type upNextByActivity []*UpNextItem
+
+func (items upNextByActivity) Len() int { return len(items) }
+func (items upNextByActivity) Less(i, j int) bool {
+	return items[i].LastActivity.After(items[j].LastActivity)
+}
+func (items upNextByActivity) Swap(i, j int) { items[i], items[j] = items[j], items[i] }
+
+// compare strings treating runs of digits as numbers, so "2" sorts before
+// "10".
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := digitPrefix(a), digitPrefix(b)
+		if da != "" && db != "" {
+			na, nb := trimZeros(da), trimZeros(db)
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func digitPrefix(s string) string {
+	i := 0
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+func trimZeros(s string) string {
+	for len(s) > 1 && s[0] == '0' {
+		s = s[1:]
+	}
+	return s
+}
@@ -0,0 +1,113 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// upnext_test.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNaturalLess(t *testing.T) {
+	sorted := []string{"Ep3.mkv", "ep", "ep1.mkv", "ep2.mkv", "ep02b.mkv", "ep10.mkv"}
+	for i := range sorted {
+		for j := range sorted {
+			if naturalLess(sorted[i], sorted[j]) != (i < j) {
+				t.Errorf("naturalLess(%q, %q) = %v", sorted[i], sorted[j], !(i < j))
+			}
+		}
+	}
+}
+
+func TestUpNext(t *testing.T) {
+	DBTest(t, func() {
+		userid, err := LocateOrCreateUserByEmail("test@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		mod := time.Date(2013, 8, 3, 12, 0, 0, 0, time.UTC)
+		media := make(map[string]string)
+		for i, path := range []string{
+			"/tv/show.s01e01.mkv",
+			"/tv/show.s01e02.mkv",
+			"/tv/show.s01e02.720p.mkv",
+			"/tv/show.s01e03.mkv",
+			"/films/series/part 2.mkv",
+			"/films/series/part 10.mkv",
+			"/films/series/part 1.mkv",
+			"/films/other/done.mkv",
+		} {
+			media[path], _ = testSyncMedia(t, "/", path, int64(i), mod)
+		}
+		for path, ep := range map[string]*EpisodeInfo{
+			"/tv/show.s01e01.mkv":      {Series: "show", Season: 1, Episode: 1},
+			"/tv/show.s01e02.mkv":      {Series: "show", Season: 1, Episode: 2},
+			"/tv/show.s01e02.720p.mkv": {Series: "show", Season: 1, Episode: 2},
+			"/tv/show.s01e03.mkv":      {Series: "show", Season: 1, Episode: 3},
+		} {
+			err := SyncEpisode(media[path], ep)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		now := time.Now()
+		progress := func(table, column, path string, ago time.Duration) {
+			q := `INSERT INTO ` + table + ` (UserId, MediaId, ` + column + `) VALUES (?, ?, ?)`
+			_, err := DB.Exec(q, userid, media[path], now.Add(-ago))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		progress("UserFinishedMedia", "Finished", "/tv/show.s01e02.mkv", time.Hour)
+		progress("UserFinishedMedia", "Finished", "/films/series/part 2.mkv", 2*time.Hour)
+		progress("UserFinishedMedia", "Finished", "/films/other/done.mkv", 3*time.Hour)
+
+		items, err := UpNext(userid, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 2 {
+			t.Fatalf("items: %d", len(items))
+		}
+		if items[0].Media.Id != media["/tv/show.s01e03.mkv"] || items[0].Episode == nil {
+			t.Errorf("series: %+v", items[0])
+		}
+		if items[1].Media.Id != media["/films/series/part 10.mkv"] || items[1].InProgress {
+			t.Errorf("directory: %+v", items[1])
+		}
+
+		// media outside the given roots is left out.
+		items, err = UpNext(userid, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 0 {
+			t.Errorf("items outside roots: %d", len(items))
+		}
+
+		// a started item takes precedence.
+		progress("UserStartedMedia", "Started", "/films/series/part 1.mkv", time.Minute)
+		items, err = UpNext(userid, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 2 || items[0].Media.Id != media["/films/series/part 1.mkv"] || !items[0].InProgress {
+			t.Errorf("in progress: %+v", items[0])
+		}
+
+		// abandoned groups are left out.
+		defer func(idle time.Duration) { UpNextIdle = idle }(UpNextIdle)
+		UpNextIdle = 30 * time.Minute
+		items, err = UpNext(userid, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 {
+			t.Errorf("idle: %d items", len(items))
+		}
+	})
+}
@@ -7,9 +7,8 @@
 package model
 
 import (
-	"crypto/rand"
 	"database/sql"
-	"fmt"
+	"errors"
 	"strings"
 	"time"
 )
@@ -26,15 +25,53 @@ const (
 	PermUserUpdate         = "USER_UPDATE"
 	PermUserDelete         = "USER_DELETE"
 	PermUserProgressUpdate = "USER_PROGRESS_UPDATE"
+	PermScan               = "SCAN"
 )
 
+var ErrInvalidPermission = errors.New("invalid permission")
+var ErrEmailTaken = errors.New("email belongs to another user")
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// Every permission that can be granted.
+var AllPermissions = []Permission{
+	PermAdmin,
+	PermMediaDelete,
+	PermMediaUpdate,
+	PermUserList,
+	PermUserCreate,
+	PermUserRead,
+	PermUserUpdate,
+	PermUserDelete,
+	PermUserProgressUpdate,
+	PermScan,
+}
+
+func ParsePermission(s string) (Permission, error) {
+	for _, perm := range AllPermissions {
+		if string(perm) == s {
+			return perm, nil
+		}
+	}
+	return "", ErrInvalidPermission
+}
+
+// true if the permission is granted to the user directly or through one of
+// their roles.
 func UserHasPermission(userid string, perm Permission) (bool, error) {
 	q := `
-		SELECT count(*)
-		FROM UserPermissions AS up
-		JOIN Users AS u ON u.UserId = up.UserId
-		WHERE up.UserId = ? AND up.PermissionName = ?`
-	row := DB.QueryRow(q, userid, string(perm))
+		SELECT count(*) FROM (
+			SELECT up.PermissionName
+			FROM UserPermissions AS up
+			JOIN Users AS u ON u.UserId = up.UserId
+			WHERE up.UserId = ? AND up.PermissionName = ?
+			UNION ALL
+			SELECT rp.PermissionName
+			FROM UserRoles AS ur
+			JOIN RolePermissions AS rp ON rp.RoleName = ur.RoleName
+			JOIN Users AS u ON u.UserId = ur.UserId
+			WHERE ur.UserId = ? AND rp.PermissionName = ?
+		)`
+	row := DB.QueryRow(q, userid, string(perm), userid, string(perm))
 	var count int
 	err := row.Scan(&count)
 	if err != nil {
@@ -43,118 +80,264 @@ func UserHasPermission(userid string, perm Permission) (bool, error) {
 	return count > 0, nil
 }
 
-type User struct {
-	Id      string    `json:"userId"`
-	Email   string    `json:"-"`
-	Created time.Time `json:"created"`
+// Like UserHasPermission but true if the user has any of perms.
+func UserHasAnyPermission(userid string, perms ...Permission) (bool, error) {
+	for _, perm := range perms {
+		ok, err := UserHasPermission(userid, perm)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
 }
 
-type accessToken struct {
-	UserId string
-	Token  string
+func GrantPermission(userid string, perm Permission) error {
+	_, err := ParsePermission(string(perm))
+	if err != nil {
+		return err
+	}
+	q := `INSERT INTO UserPermissions(UserId, PermissionName) VALUES (?, ?)`
+	_, err = DB.Exec(q, userid, string(perm))
+	return err
 }
 
-func newAccessTokenForUser(userid string) (*accessToken, error) {
-	at := new(accessToken)
-	at.UserId = userid
+func RevokePermission(userid string, perm Permission) error {
+	q := `DELETE FROM UserPermissions WHERE UserId = ? AND PermissionName = ?`
+	_, err := DB.Exec(q, userid, string(perm))
+	return err
+}
 
-	p := make([]byte, 16)
-	_, err := rand.Read(p)
+// The permissions granted to a user directly, in alphabetical order.
+func UserPermissions(userid string) ([]Permission, error) {
+	q := `SELECT PermissionName FROM UserPermissions WHERE UserId = ? ORDER BY PermissionName`
+	rows, err := DB.Query(q, userid)
 	if err != nil {
 		return nil, err
 	}
-	at.Token = fmt.Sprintf("%x", p)
-	return at, nil
-}
-
-func CreateAccessTokenForUser(userid string) (string, error) {
-	at, err := newAccessTokenForUser(userid)
+	defer rows.Close()
+	perms := make([]Permission, 0, len(AllPermissions))
+	for rows.Next() {
+		var perm string
+		err := rows.Scan(&perm)
+		if err != nil {
+			return nil, err
+		}
+		perms = append(perms, Permission(perm))
+	}
+	err = rows.Err()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	return perms, nil
+}
 
-	q := `INSERT INTO AccessTokens(UserId, AccessToken) Values(?, ?)`
-	_, err = DB.Exec(q, at.UserId, at.Token)
+// EmailVerified is false for addresses set with SetUserEmail, which no one
+// has proven to own.
+type User struct {
+	Id            string    `json:"userId"`
+	Email         string    `json:"-"`
+	EmailVerified bool      `json:"-"`
+	Username      string    `json:"username,omitempty"`
+	Created       time.Time `json:"created"`
+}
+
+// the columns read by scanUserRow. queries must alias Users as u, UserEmails as
+// e and UserLogins as l.
+const userColumns = `u.UserId, e.Email, e.Verified, l.Username, u.Created`
+
+const userJoins = `
+	LEFT JOIN UserEmails AS e ON e.UserId = u.UserId
+	LEFT JOIN UserLogins AS l ON l.UserId = u.UserId`
+
+func scanUserRow(row rowScanner) (*User, error) {
+	u := new(User)
+	var email, username sql.NullString
+	var verified sql.NullBool
+	err := row.Scan(&u.Id, &email, &verified, &username, &u.Created)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	u.Email = email.String
+	u.EmailVerified = verified.Bool
+	u.Username = username.String
+	return u, nil
+}
 
-	return at.Token, nil
+func FindUser(userid string) (*User, error) {
+	q := `SELECT ` + userColumns + ` FROM Users AS u` + userJoins + ` WHERE u.UserId = ?`
+	return scanUserRow(DB.QueryRow(q, userid))
 }
 
-func AllAccessTokensForUser(userid string) ([]string, error) {
-	accessTokens := make([]string, 0, 10)
-	q := `SELECT AccessToken FROM AccessTokens WHERE UserId = ?`
-	rows, err := DB.Query(q, userid)
+// Find a user by username or verified email address.
+func FindUserByName(name string) (*User, error) {
+	q := `SELECT ` + userColumns + ` FROM Users AS u` + userJoins + `
+		WHERE l.Username = ? OR (e.Email = ? AND e.Verified)`
+	return scanUserRow(DB.QueryRow(q, name, name))
+}
+
+// All users, oldest first.
+func AllUsers() ([]*User, error) {
+	q := `SELECT ` + userColumns + ` FROM Users AS u` + userJoins + ` ORDER BY u.Created, u.UserId`
+	rows, err := DB.Query(q)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-
+	users := make([]*User, 0, 10)
 	for rows.Next() {
-		var token string
-		err := rows.Scan(&token)
+		u, err := scanUserRow(rows)
 		if err != nil {
 			return nil, err
 		}
-		accessTokens = append(accessTokens, token)
+		users = append(users, u)
 	}
-
 	err = rows.Err()
 	if err != nil {
 		return nil, err
 	}
+	return users, nil
+}
 
-	return accessTokens, nil
+// Replace the email address of a user. The address is unverified, so it is
+// not found by FindUserByName and LocateOrCreateUserByEmail takes it away.
+func SetUserEmail(userid, email string) error {
+	if !strings.Contains(email, "@") {
+		return ErrInvalidEmail
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	var owner string
+	q := `SELECT UserId FROM UserEmails WHERE Email = ?`
+	err = tx.QueryRow(q, email).Scan(&owner)
+	if err == nil && owner != userid {
+		tx.Rollback()
+		return ErrEmailTaken
+	}
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM UserEmails WHERE UserId = ?`, userid)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO UserEmails(UserId, Email, Verified) VALUES (?, ?, 0)`, userid, email)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
-func FindUserByAccessToken(accessToken string) (*User, error) {
-	u := new(User)
-	q := `
-		SELECT UserId, Email, Created
-		FROM Users
-		NATURAL JOIN UserEmails
-		NATURAL JOIN AccessTokens
-		WHERE AccessToken = ?`
-	row := DB.QueryRow(q, strings.ToLower(accessToken))
-	err := row.Scan(&u.Id, &u.Email, &u.Created)
+// Change the username of a user with a local login. sql.ErrNoRows is returned
+// if the user has no login.
+func RenameUser(userid, username string) error {
+	if !validUsername.MatchString(username) {
+		return ErrInvalidUsername
+	}
+	var owner string
+	q := `SELECT UserId FROM UserLogins WHERE Username = ?`
+	err := DB.QueryRow(q, username).Scan(&owner)
+	if err == nil && owner != userid {
+		return ErrUsernameTaken
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	q = `UPDATE UserLogins SET Username = ?, Updated = ? WHERE UserId = ?`
+	res, err := DB.Exec(q, username, time.Now().UTC(), userid)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return u, nil
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// tables holding rows that belong to a user.
+var userRefTables = []string{
+	"UserEmails",
+	"UserLogins",
+	"UserPermissions",
+	"UserRoles",
+	"Sessions",
+	"AccessTokens",
+	"UserStartedMedia",
+	"UserFinishedMedia",
+	"WatchEvents",
+}
+
+// Delete a user along with their logins, tokens, progress and history.
+// sql.ErrNoRows is returned if the user does not exist.
+func DeleteUser(userid string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	for _, table := range userRefTables {
+		_, err := tx.Exec(`DELETE FROM `+table+` WHERE UserId = ?`, userid)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	res, err := tx.Exec(`DELETE FROM Users WHERE UserId = ?`, userid)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
 }
 
 // Find the the id of a user with the given email. If no user exists, one is created.
-// The user's id is returned along with any error encountered.
+// The user's id is returned along with any error encountered. The email is
+// verified by the caller, so it is taken from any user who set it with
+// SetUserEmail.
 func LocateOrCreateUserByEmail(email string) (string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	q := `DELETE FROM UserEmails WHERE Email = ? AND NOT Verified`
+	_, err = tx.Exec(q, email)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
 	var id string
-	q := `
-		SELECT UserId
-		FROM Users
-		NATURAL JOIN UserEmails
-		WHERE Email = ?`
-	row := DB.QueryRow(q, email)
-	err := row.Scan(&id)
+	q = `SELECT UserId FROM UserEmails WHERE Email = ?`
+	err = tx.QueryRow(q, email).Scan(&id)
 	if err == sql.ErrNoRows {
-		var tx *sql.Tx
-		tx, err = DB.Begin()
+		id = getsha1(email) // this may be problematic
+		q = `INSERT INTO Users(UserId) VALUES (?)`
+		_, err = tx.Exec(q, id)
 		if err == nil {
-			id = getsha1(email) // this may be problematic
-			q := `INSERT INTO Users(UserId) VALUES (?)`
-			_, err = tx.Exec(q, id)
-			if err != nil {
-				tx.Rollback()
-			} else {
-				q = `INSERT INTO UserEmails(UserId, Email) Values (?, ?)`
-				_, err = tx.Exec(q, id, email)
-				if err != nil {
-					tx.Rollback()
-				} else {
-					tx.Commit()
-				}
-			}
+			q = `INSERT INTO UserEmails(UserId, Email, Verified) Values (?, ?, 1)`
+			_, err = tx.Exec(q, id, email)
 		}
 	}
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	err = tx.Commit()
 	if err != nil {
 		return "", err
 	}
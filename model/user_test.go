@@ -0,0 +1,158 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// user_test.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestPermissions(t *testing.T) {
+	DBTest(t, func() {
+		userid, err := LocateOrCreateUserByEmail("test@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = GrantPermission(userid, PermUserList)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = GrantPermission(userid, PermAdmin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = GrantPermission(userid, PermAdmin)
+		if err != nil {
+			t.Errorf("granting twice: %v", err)
+		}
+		err = GrantPermission(userid, "ROOT")
+		if err != ErrInvalidPermission {
+			t.Errorf("unknown permission: %v", err)
+		}
+		perms, err := UserPermissions(userid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(perms) != 2 || perms[0] != PermAdmin || perms[1] != PermUserList {
+			t.Errorf("permissions: %v", perms)
+		}
+
+		err = RevokePermission(userid, PermAdmin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err := UserHasPermission(userid, PermAdmin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Errorf("revoked permission still granted")
+		}
+	})
+}
+
+func TestUserAccounts(t *testing.T) {
+	DBTest(t, func() {
+		alice, err := CreateLocalUser("alice", "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bob, err := LocateOrCreateUserByEmail("bob@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = SetUserEmail(alice, "bob@example.com")
+		if err != ErrEmailTaken {
+			t.Errorf("taken email: %v", err)
+		}
+		err = SetUserEmail(alice, "alice")
+		if err != ErrInvalidEmail {
+			t.Errorf("invalid email: %v", err)
+		}
+		err = SetUserEmail(alice, "alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// addresses set by users are not trusted to name them.
+		_, err = FindUserByName("alice@example.com")
+		if err != sql.ErrNoRows {
+			t.Errorf("found by unverified email: %v", err)
+		}
+		u, err := FindUserByName("bob@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Id != bob || !u.EmailVerified {
+			t.Errorf("user: %#v", u)
+		}
+
+		err = RenameUser(bob, "bob")
+		if err != sql.ErrNoRows {
+			t.Errorf("rename without login: %v", err)
+		}
+		err = RenameUser(alice, "alicia")
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err = FindUserByName("alicia")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Id != alice || u.Email != "alice@example.com" || u.EmailVerified {
+			t.Errorf("user: %#v", u)
+		}
+
+		// a verified login takes the address from the user who set it.
+		owner, err := LocateOrCreateUserByEmail("alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if owner == alice {
+			t.Errorf("located by unverified email")
+		}
+		u, err = FindUserByName("alicia")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Email != "" {
+			t.Errorf("unverified email kept: %#v", u)
+		}
+
+		users, err := AllUsers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 3 {
+			t.Errorf("users: %d", len(users))
+		}
+
+		_, err = CreateAccessTokenForUser(alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = DeleteUser(alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = FindUserByName("alicia")
+		if err != sql.ErrNoRows {
+			t.Errorf("deleted user: %v", err)
+		}
+		tokens, err := UserAccessTokens(alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tokens) != 0 {
+			t.Errorf("tokens of deleted user: %d", len(tokens))
+		}
+		err = DeleteUser(alice)
+		if err != sql.ErrNoRows {
+			t.Errorf("deleting twice: %v", err)
+		}
+	})
+}
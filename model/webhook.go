@@ -0,0 +1,302 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// webhook.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/bmatsuo/mtrack/event"
+)
+
+var ErrInvalidWebhookURL = errors.New("webhook url must be an absolute http or https url")
+var ErrInvalidEventType = errors.New("invalid event type")
+
+// The states of a webhook delivery. Dead deliveries exhausted their attempts
+// and are kept until they are requeued or their webhook is deleted.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// A subscription to events, which are POSTed to URL signed with Secret.
+// Empty Events, Root and UserId match any event, root and user. Events about
+// no user, like media events, never match a webhook with a UserId.
+type Webhook struct {
+	Id      string    `json:"webhookId"`
+	URL     string    `json:"url"`
+	Secret  string    `json:"-"`
+	Events  []string  `json:"events"`
+	Root    string    `json:"root,omitempty"`
+	UserId  string    `json:"userId,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+func (h *Webhook) Matches(e *event.Event) bool {
+	if h.Root != "" && h.Root != e.Root {
+		return false
+	}
+	if h.UserId != "" && h.UserId != e.UserId {
+		return false
+	}
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, typ := range h.Events {
+		if typ == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// An event sent, or to be sent, to a webhook. Payload is the JSON body.
+type WebhookDelivery struct {
+	Id          int64      `json:"deliveryId"`
+	WebhookId   string     `json:"webhookId"`
+	Event       string     `json:"event"`
+	Payload     string     `json:"payload"`
+	State       string     `json:"state"`
+	Attempts    int        `json:"attempts"`
+	NextAttempt *time.Time `json:"nextAttempt,omitempty"`
+	LastStatus  int        `json:"lastStatus,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	Created     time.Time  `json:"created"`
+	Updated     *time.Time `json:"updated,omitempty"`
+}
+
+const webhookColumns = `WebhookId, URL, Secret, Events, Root, UserId, Created`
+
+func scanWebhook(row rowScanner) (*Webhook, error) {
+	h := new(Webhook)
+	var events string
+	err := row.Scan(&h.Id, &h.URL, &h.Secret, &events, &h.Root, &h.UserId, &h.Created)
+	if err != nil {
+		return nil, err
+	}
+	h.Events = splitList(events)
+	if h.Events == nil {
+		h.Events = []string{}
+	}
+	return h, nil
+}
+
+// Create a webhook. A random secret is generated if secret is empty.
+func CreateWebhook(rawurl, secret string, events []string, root, userid string) (*Webhook, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidWebhookURL
+	}
+	for _, typ := range events {
+		if !event.ValidType(typ) {
+			return nil, ErrInvalidEventType
+		}
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		secret, err = randomHex(32)
+		if err != nil {
+			return nil, err
+		}
+	}
+	q := `INSERT INTO Webhooks(WebhookId, URL, Secret, Events, Root, UserId)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = DB.Exec(q, id, rawurl, secret, joinList(events), root, userid)
+	if err != nil {
+		return nil, err
+	}
+	return FindWebhook(id)
+}
+
+// sql.ErrNoRows is returned if the webhook does not exist.
+func FindWebhook(id string) (*Webhook, error) {
+	q := `SELECT ` + webhookColumns + ` FROM Webhooks WHERE WebhookId = ?`
+	return scanWebhook(DB.QueryRow(q, id))
+}
+
+// All webhooks, oldest first.
+func AllWebhooks() ([]*Webhook, error) {
+	rows, err := DB.Query(`SELECT ` + webhookColumns + ` FROM Webhooks ORDER BY Created, WebhookId`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hooks := make([]*Webhook, 0, 4)
+	for rows.Next() {
+		h, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, h)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// The webhooks matching e.
+func WebhooksFor(e *event.Event) ([]*Webhook, error) {
+	hooks, err := AllWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	matched := hooks[:0]
+	for _, h := range hooks {
+		if h.Matches(e) {
+			matched = append(matched, h)
+		}
+	}
+	return matched, nil
+}
+
+// Delete a webhook and its deliveries. sql.ErrNoRows is returned if the
+// webhook does not exist.
+func DeleteWebhook(id string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM WebhookDeliveries WHERE WebhookId = ?`, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	res, err := tx.Exec(`DELETE FROM Webhooks WHERE WebhookId = ?`, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// Queue a delivery of payload to a webhook, to be attempted immediately.
+func CreateWebhookDelivery(hookid, eventType string, payload []byte) (int64, error) {
+	q := `INSERT INTO WebhookDeliveries(WebhookId, Event, Payload, State, NextAttempt)
+		VALUES (?, ?, ?, ?, ?)`
+	res, err := DB.Exec(q, hookid, eventType, string(payload), DeliveryPending, dbTime(time.Now()))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+const webhookDeliveryColumns = `DeliveryId, WebhookId, Event, Payload, State,
+	Attempts, NextAttempt, LastStatus, LastError, Created, Updated`
+
+func scanWebhookDeliveries(rows *sql.Rows) ([]*WebhookDelivery, error) {
+	defer rows.Close()
+	ds := make([]*WebhookDelivery, 0, 10)
+	for rows.Next() {
+		d := new(WebhookDelivery)
+		err := rows.Scan(&d.Id, &d.WebhookId, &d.Event, &d.Payload, &d.State,
+			&d.Attempts, &d.NextAttempt, &d.LastStatus, &d.LastError, &d.Created, &d.Updated)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	err := rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// Pending deliveries whose next attempt is due at now, oldest first.
+func DueWebhookDeliveries(now time.Time, limit int) ([]*WebhookDelivery, error) {
+	rows, err := DB.Query(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM WebhookDeliveries
+		WHERE State = ? AND NextAttempt <= ?
+		ORDER BY NextAttempt, DeliveryId
+		LIMIT ?
+	`, DeliveryPending, dbTime(now), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+// The delivery log of a webhook, most recent first. If state is not empty
+// only deliveries in that state are returned. A limit less than one returns
+// all deliveries.
+func WebhookDeliveries(hookid, state string, limit int) ([]*WebhookDelivery, error) {
+	q := `SELECT ` + webhookDeliveryColumns + `
+		FROM WebhookDeliveries
+		WHERE WebhookId = ?`
+	args := []interface{}{hookid}
+	if state != "" {
+		q += ` AND State = ?`
+		args = append(args, state)
+	}
+	q += ` ORDER BY DeliveryId DESC`
+	if limit > 0 {
+		q += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := DB.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+// Store the outcome of an attempt to deliver d.
+func UpdateWebhookDelivery(d *WebhookDelivery) error {
+	var next interface{}
+	if d.NextAttempt != nil {
+		next = dbTime(*d.NextAttempt)
+	}
+	now := time.Now()
+	q := `UPDATE WebhookDeliveries
+		SET State = ?, Attempts = ?, NextAttempt = ?, LastStatus = ?,
+			LastError = ?, Updated = ?
+		WHERE DeliveryId = ?`
+	_, err := DB.Exec(q, d.State, d.Attempts, next, d.LastStatus, d.LastError, dbTime(now), d.Id)
+	if err == nil {
+		d.Updated = &now
+	}
+	return err
+}
+
+// Attempt a dead delivery of a webhook again, as if it were new.
+// sql.ErrNoRows is returned if the webhook has no such dead delivery.
+func RequeueWebhookDelivery(hookid string, id int64) error {
+	q := `UPDATE WebhookDeliveries
+		SET State = ?, Attempts = 0, NextAttempt = ?, Updated = ?
+		WHERE DeliveryId = ? AND WebhookId = ? AND State = ?`
+	now := time.Now()
+	res, err := DB.Exec(q, DeliveryPending, dbTime(now), dbTime(now), id, hookid, DeliveryDead)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// webhook_test.go [created: Sun, 18 Oct 2026]
+
+package model
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/mtrack/event"
+)
+
+func TestWebhookMatches(t *testing.T) {
+	hook := &Webhook{Events: []string{event.ProgressFinished}, Root: "/media/tv"}
+	for i, test := range []struct {
+		e     *event.Event
+		match bool
+	}{
+		{&event.Event{Type: event.ProgressFinished, Root: "/media/tv", UserId: "u"}, true},
+		{&event.Event{Type: event.ProgressStarted, Root: "/media/tv", UserId: "u"}, false},
+		{&event.Event{Type: event.ProgressFinished, Root: "/media/movies", UserId: "u"}, false},
+	} {
+		if hook.Matches(test.e) != test.match {
+			t.Errorf("test %d: match %v", i, !test.match)
+		}
+	}
+
+	hook = &Webhook{UserId: "u"}
+	if !hook.Matches(&event.Event{Type: event.ProgressCleared, UserId: "u"}) {
+		t.Errorf("user event did not match")
+	}
+	if hook.Matches(&event.Event{Type: event.MediaCreated, Root: "/media/tv"}) {
+		t.Errorf("media event matched user webhook")
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	DBTest(t, func() {
+		_, err := CreateWebhook("ftp://example.com/", "", nil, "", "")
+		if err != ErrInvalidWebhookURL {
+			t.Errorf("ftp url: %v", err)
+		}
+		_, err = CreateWebhook("http://example.com/", "", []string{"media.eaten"}, "", "")
+		if err != ErrInvalidEventType {
+			t.Errorf("bad event type: %v", err)
+		}
+
+		all, err := CreateWebhook("http://example.com/all", "", nil, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all.Secret) != 64 || len(all.Events) != 0 {
+			t.Errorf("webhook: %+v", all)
+		}
+		finished, err := CreateWebhook("https://example.com/finished", "s3cret",
+			[]string{event.ProgressFinished}, "/media", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if finished.Secret != "s3cret" || finished.Root != "/media" {
+			t.Errorf("webhook: %+v", finished)
+		}
+
+		hooks, err := WebhooksFor(&event.Event{Type: event.MediaCreated, Root: "/media"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hooks) != 1 || hooks[0].Id != all.Id {
+			t.Errorf("media.created webhooks: %v", hooks)
+		}
+		hooks, err = WebhooksFor(&event.Event{Type: event.ProgressFinished, Root: "/media"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hooks) != 2 {
+			t.Errorf("progress.finished webhooks: %v", hooks)
+		}
+
+		err = DeleteWebhook(all.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = DeleteWebhook(all.Id)
+		if err != sql.ErrNoRows {
+			t.Errorf("deleted twice: %v", err)
+		}
+		_, err = FindWebhook(all.Id)
+		if err != sql.ErrNoRows {
+			t.Errorf("deleted webhook found: %v", err)
+		}
+	})
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	DBTest(t, func() {
+		hook, err := CreateWebhook("http://example.com/", "", nil, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := CreateWebhookDelivery(hook.Id, event.MediaCreated, []byte(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		now := time.Now().Add(time.Second)
+		due, err := DueWebhookDeliveries(now, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != 1 || due[0].Id != id || due[0].State != DeliveryPending || due[0].Payload != `{}` {
+			t.Fatalf("due: %v", due)
+		}
+
+		// a failed attempt is not due until its next attempt.
+		d := due[0]
+		next := now.Add(time.Minute)
+		d.Attempts = 1
+		d.LastStatus = 500
+		d.NextAttempt = &next
+		err = UpdateWebhookDelivery(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		due, err = DueWebhookDeliveries(now, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != 0 {
+			t.Errorf("retry due early: %v", due)
+		}
+
+		err = RequeueWebhookDelivery(hook.Id, id)
+		if err != sql.ErrNoRows {
+			t.Errorf("requeued pending delivery: %v", err)
+		}
+		d.State = DeliveryDead
+		d.NextAttempt = nil
+		err = UpdateWebhookDelivery(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dead, err := WebhookDeliveries(hook.Id, DeliveryDead, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dead) != 1 || dead[0].Attempts != 1 || dead[0].LastStatus != 500 || dead[0].Updated == nil {
+			t.Fatalf("dead: %v", dead)
+		}
+
+		err = RequeueWebhookDelivery(hook.Id, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		due, err = DueWebhookDeliveries(now, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != 1 || due[0].Attempts != 0 {
+			t.Errorf("requeued: %v", due)
+		}
+
+		err = DeleteWebhook(hook.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all, err := WebhookDeliveries(hook.Id, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 0 {
+			t.Errorf("deliveries of deleted webhook: %v", all)
+		}
+	})
+}
@@ -7,12 +7,20 @@
 package main
 
 import (
+	"bufio"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/bmatsuo/mtrack/config"
 	"github.com/bmatsuo/mtrack/http"
 	"github.com/bmatsuo/mtrack/model"
 	"github.com/bmatsuo/mtrack/scan"
+	"github.com/bmatsuo/mtrack/webhook"
 )
 
 func Check(err error) {
@@ -21,11 +29,75 @@ func Check(err error) {
 	}
 }
 
+var addUser = flag.String("adduser", "", "create a local account with a password read from stdin and exit")
+var makeAdmin = flag.String("admin", "", "grant ADMIN to the user with this username or email and exit")
+
+// create a local account for -adduser.
+func createLocalUser(username string) error {
+	fmt.Fprintf(os.Stderr, "password for %s: ", username)
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+	userid, err := model.CreateLocalUser(username, password)
+	if err != nil {
+		return err
+	}
+	fmt.Println(userid)
+	return nil
+}
+
+// grant ADMIN for -admin. an email without a user creates one, so that an
+// admin can log in with OIDC. emails users set themselves are unverified; they
+// never match and are taken from the users who set them.
+func grantAdmin(name string) error {
+	user, err := model.FindUserByName(name)
+	if err == sql.ErrNoRows && strings.Contains(name, "@") {
+		_, err = model.LocateOrCreateUserByEmail(name)
+		if err != nil {
+			return err
+		}
+		user, err = model.FindUserByName(name)
+	}
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no user %q", name)
+	}
+	if err != nil {
+		return err
+	}
+	err = model.GrantPermission(user.Id, model.PermAdmin)
+	if err != nil {
+		return err
+	}
+	fmt.Println(user.Id)
+	return nil
+}
+
 func main() {
 	Check(config.Configure())
 	Check(model.DBInit())
-	Check(model.DBDemoUser())
-	scan.Start(nil)
+	Check(model.DefineRoles(config.Config.Roles))
+	if *addUser != "" || *makeAdmin != "" {
+		if *addUser != "" {
+			Check(createLocalUser(*addUser))
+		}
+		if *makeAdmin != "" {
+			Check(grantAdmin(*makeAdmin))
+		}
+		return
+	}
+	webhook.Start()
+	defer func() { Check(webhook.Close()) }()
+	statch := make(chan *scan.CronStatus)
+	go func() {
+		for status := range statch {
+			log.Printf("Scan: %q: %d files (%d new, %d updated, %d failed) in %v",
+				status.Root, status.Seen, status.New, status.Updated,
+				status.Failed, status.LastScanDur)
+		}
+	}()
+	scan.Start(statch)
 	defer func() { Check(scan.Close()) }()
 	Check(http.HTTPStart())
 }
@@ -0,0 +1,192 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// mpv.go [created: Sun, 18 Oct 2026]
+
+package player
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Plays media with mpv, following it through its JSON IPC socket.
+type MPV struct {
+	command *command
+}
+
+func (p *MPV) Launch(req *Request) (Playback, error) {
+	socket := filepath.Join(os.TempDir(), "mtrack-mpv-"+randomHex(8)+".sock")
+	args := []string{"--input-ipc-server=" + socket, "--force-window=yes"}
+	if req.Start > 0 {
+		args = append(args, fmt.Sprintf("--start=%.3f", req.Start))
+	}
+	args = append(args, "--", req.Path)
+	proc, err := p.command.start(req, args...)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialMPV(socket, proc.Done(), p.command.launchTimeout())
+	if err != nil {
+		proc.Close()
+		os.Remove(socket)
+		return nil, err
+	}
+	return &mpvPlayback{process: proc, conn: conn, socket: socket}, nil
+}
+
+type mpvPlayback struct {
+	*process
+	conn   *MPVConn
+	socket string
+}
+
+func (pb *mpvPlayback) Status() (*Status, error) {
+	select {
+	case <-pb.Done():
+		return nil, ErrStopped
+	default:
+	}
+	return pb.conn.Status()
+}
+
+func (pb *mpvPlayback) Close() error {
+	select {
+	case <-pb.Done():
+	default:
+		pb.conn.Command("quit")
+	}
+	pb.conn.Close()
+	err := pb.process.Close()
+	os.Remove(pb.socket)
+	return err
+}
+
+// An error returned by mpv for a command.
+type MPVError string
+
+func (err MPVError) Error() string {
+	return "mpv: " + string(err)
+}
+
+// The timeout for each command sent to mpv.
+var MPVCommandTimeout = 5 * time.Second
+
+// A connection to the JSON IPC socket of mpv.
+type MPVConn struct {
+	mut    sync.Mutex
+	conn   net.Conn
+	r      *bufio.Reader
+	lastId int64
+}
+
+// Connect to the socket of an mpv, retrying until it accepts the connection,
+// done is closed or the timeout passes.
+func dialMPV(socket string, done <-chan struct{}, timeout time.Duration) (*MPVConn, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := DialMPV(socket)
+		if err == nil {
+			return conn, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+		select {
+		case <-done:
+			return nil, ErrStopped
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func DialMPV(socket string) (*MPVConn, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	return &MPVConn{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// Run an mpv command and return its data. Events mpv sends while waiting
+// for the reply are discarded.
+func (c *MPVConn) Command(args ...interface{}) (json.RawMessage, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.lastId++
+	id := c.lastId
+	p, err := json.Marshal(map[string]interface{}{
+		"command":    args,
+		"request_id": id,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.conn.SetDeadline(time.Now().Add(MPVCommandTimeout))
+	_, err = c.conn.Write(append(p, '\n'))
+	if err != nil {
+		return nil, err
+	}
+	for {
+		line, err := c.r.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		var reply struct {
+			Event     string          `json:"event"`
+			RequestId int64           `json:"request_id"`
+			Error     string          `json:"error"`
+			Data      json.RawMessage `json:"data"`
+		}
+		err = json.Unmarshal(line, &reply)
+		if err != nil {
+			return nil, err
+		}
+		if reply.Event != "" || reply.RequestId != id {
+			continue
+		}
+		if reply.Error != "success" {
+			return nil, MPVError(reply.Error)
+		}
+		return reply.Data, nil
+	}
+}
+
+// Read a property into v. Properties that are unavailable, such as the
+// position before a file has loaded, leave v unchanged.
+func (c *MPVConn) GetProperty(name string, v interface{}) error {
+	data, err := c.Command("get_property", name)
+	if err == MPVError("property unavailable") {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (c *MPVConn) Status() (*Status, error) {
+	status := new(Status)
+	err := c.GetProperty("time-pos", &status.Position)
+	if err == nil {
+		err = c.GetProperty("duration", &status.Duration)
+	}
+	if err == nil {
+		err = c.GetProperty("pause", &status.Paused)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (c *MPVConn) Close() error {
+	return c.conn.Close()
+}
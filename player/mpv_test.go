@@ -0,0 +1,128 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// mpv_test.go [created: Sun, 18 Oct 2026]
+
+package player
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// serve the mpv JSON IPC protocol on a unix socket, answering get_property
+// from props. Each reply is preceded by an event, as mpv interleaves them.
+func fakeMPV(t *testing.T, props map[string]interface{}) (socket string, closefn func()) {
+	dir, err := ioutil.TempDir("", "mtrack-mpv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket = filepath.Join(dir, "mpv.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveMPV(conn, props)
+		}
+	}()
+	return socket, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func serveMPV(conn net.Conn, props map[string]interface{}) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var req struct {
+			Command   []interface{} `json:"command"`
+			RequestId int64         `json:"request_id"`
+		}
+		err = json.Unmarshal(line, &req)
+		if err != nil {
+			return
+		}
+		enc.Encode(map[string]interface{}{"event": "property-change", "id": 1})
+		reply := map[string]interface{}{"request_id": req.RequestId, "error": "success"}
+		switch {
+		case len(req.Command) == 2 && req.Command[0] == "get_property":
+			v, ok := props[req.Command[1].(string)]
+			if ok {
+				reply["data"] = v
+			} else {
+				reply["error"] = "property unavailable"
+			}
+		case len(req.Command) == 1 && req.Command[0] == "quit":
+		default:
+			reply["error"] = "invalid parameter"
+		}
+		enc.Encode(reply)
+	}
+}
+
+func TestMPVConn(t *testing.T) {
+	socket, closefn := fakeMPV(t, map[string]interface{}{
+		"time-pos": 61.5,
+		"pause":    true,
+	})
+	defer closefn()
+
+	conn, err := dialMPV(socket, nil, LaunchTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// duration is unavailable and left zero.
+	status, err := conn.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Position != 61.5 || status.Duration != 0 || !status.Paused {
+		t.Errorf("status: %+v", status)
+	}
+	status, err = conn.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Position != 61.5 {
+		t.Errorf("second status: %+v", status)
+	}
+
+	_, err = conn.Command("seek")
+	if err != MPVError("invalid parameter") {
+		t.Errorf("invalid command: %v", err)
+	}
+	_, err = conn.Command("quit")
+	if err != nil {
+		t.Errorf("quit: %v", err)
+	}
+}
+
+func TestDialMPVStopped(t *testing.T) {
+	done := make(chan struct{})
+	close(done)
+	_, err := dialMPV(filepath.Join(os.TempDir(), "mtrack-mpv-missing.sock"), done, LaunchTimeout)
+	if err != ErrStopped {
+		t.Errorf("dial after exit: %v", err)
+	}
+}
@@ -0,0 +1,419 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// player.go [created: Sun, 18 Oct 2026]
+
+// Package player launches media players on the server and follows their
+// playback, recording resume points and finishing media as it is watched.
+package player
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/bmatsuo/mtrack/model"
+)
+
+// Player kinds.
+const (
+	KindOpen = "open"
+	KindMPV  = "mpv"
+	KindVLC  = "vlc"
+	KindNone = "none"
+)
+
+// Returned by Playback.Status when the player cannot report its position.
+var ErrUntracked = errors.New("playback is not tracked")
+
+// Returned by Playback.Status once the player has exited.
+var ErrStopped = errors.New("player stopped")
+
+// How long a launched player has to accept connections.
+var LaunchTimeout = 10 * time.Second
+
+// A program that plays media files.
+type Player interface {
+	Launch(req *Request) (Playback, error)
+}
+
+// The media to play, for a user, from Start seconds in. Launched commands see
+// these as template fields (e.g. {{.Path}}) in their arguments and as the
+// environment variables MTRACK_PATH, MTRACK_MEDIA_ID, MTRACK_USER_ID,
+// MTRACK_ROOT and MTRACK_START.
+type Request struct {
+	Path    string
+	MediaId string
+	UserId  string
+	Root    string
+	Start   float64
+}
+
+func (req *Request) env() []string {
+	return append(os.Environ(),
+		"MTRACK_PATH="+req.Path,
+		"MTRACK_MEDIA_ID="+req.MediaId,
+		"MTRACK_USER_ID="+req.UserId,
+		"MTRACK_ROOT="+req.Root,
+		"MTRACK_START="+strconv.FormatFloat(req.Start, 'f', -1, 64),
+	)
+}
+
+// The playback of a file by a running player.
+type Playback interface {
+	// The current playback state.
+	Status() (*Status, error)
+	// Closed when the player exits.
+	Done() <-chan struct{}
+	// Stop the player.
+	Close() error
+}
+
+// A playback state. Times are in seconds and Duration is zero if unknown.
+type Status struct {
+	Position float64
+	Duration float64
+	Paused   bool
+}
+
+// How to launch media. Kind is KindOpen (the default), KindMPV, KindVLC or
+// KindNone, which launches nothing so that a headless server only tracks
+// progress reported to it. Command defaults to the executable named after
+// the kind, except for KindOpen where it defaults to xdg-open (open on
+// macOS). Args are templates of the arguments given before those the player
+// adds itself. A command of KindOpen is given the path as its last argument
+// unless an argument contains {{.Path}}. Timeout limits how long a command
+// of KindOpen may run and how long mpv and VLC have to start, zero meaning
+// no limit and LaunchTimeout respectively.
+type Config struct {
+	Kind    string
+	Command string
+	Args    []string
+	Timeout time.Duration
+}
+
+func defaultOpen() string {
+	if runtime.GOOS == "darwin" {
+		return "open"
+	}
+	return "xdg-open"
+}
+
+// Create the player configured by c.
+func New(c *Config) (Player, error) {
+	cmd, err := newCommand(c)
+	if err != nil {
+		return nil, err
+	}
+	switch c.Kind {
+	case "", KindOpen:
+		if c.Command == "" {
+			cmd.name = defaultOpen()
+		}
+		return (*Command)(cmd), nil
+	case KindMPV:
+		return &MPV{command: cmd}, nil
+	case KindVLC:
+		return &VLC{command: cmd}, nil
+	case KindNone:
+		return None{}, nil
+	default:
+		return nil, fmt.Errorf("unknown player %q", c.Kind)
+	}
+}
+
+// a command line with templated arguments.
+type command struct {
+	name    string
+	args    []*template.Template
+	path    bool // some argument refers to the path
+	timeout time.Duration
+}
+
+func newCommand(c *Config) (*command, error) {
+	cmd := &command{name: c.Command, timeout: c.Timeout}
+	if cmd.name == "" {
+		cmd.name = c.Kind
+	}
+	for i, arg := range c.Args {
+		tmpl, err := template.New(fmt.Sprint("arg", i)).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("player argument %q: %v", arg, err)
+		}
+		cmd.args = append(cmd.args, tmpl)
+		if strings.Contains(arg, ".Path") {
+			cmd.path = true
+		}
+	}
+	return cmd, nil
+}
+
+// the arguments for req followed by extra.
+func (cmd *command) argv(req *Request, extra ...string) ([]string, error) {
+	args := make([]string, 0, len(cmd.args)+len(extra))
+	for _, tmpl := range cmd.args {
+		var buf bytes.Buffer
+		err := tmpl.Execute(&buf, req)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, buf.String())
+	}
+	return append(args, extra...), nil
+}
+
+func (cmd *command) start(req *Request, extra ...string) (*process, error) {
+	args, err := cmd.argv(req, extra...)
+	if err != nil {
+		return nil, err
+	}
+	return startProcess(cmd.name, args, req.env())
+}
+
+func (cmd *command) launchTimeout() time.Duration {
+	if cmd.timeout > 0 {
+		return cmd.timeout
+	}
+	return LaunchTimeout
+}
+
+// Runs a command to open the file, like xdg-open or a script. Playback is
+// not tracked.
+type Command command
+
+func (p *Command) Launch(req *Request) (Playback, error) {
+	cmd := (*command)(p)
+	var extra []string
+	if !cmd.path {
+		extra = append(extra, req.Path)
+	}
+	proc, err := cmd.start(req, extra...)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.timeout > 0 {
+		go func() {
+			select {
+			case <-proc.Done():
+			case <-time.After(cmd.timeout):
+				log.Printf("Player: %s: killed after %v", cmd.name, cmd.timeout)
+				proc.Close()
+			}
+		}()
+	}
+	return proc, nil
+}
+
+// Launches nothing, for servers without a display. Progress is only what
+// clients report.
+type None struct{}
+
+func (None) Launch(req *Request) (Playback, error) {
+	done := make(chan struct{})
+	close(done)
+	return &process{done: done}, nil
+}
+
+// Chooses the player for media by the extension of its file or, for other
+// extensions, by its root.
+type Players struct {
+	Default Player
+	Roots   map[string]Player // by root path
+	Exts    map[string]Player // by lower case extension, e.g. ".mp3"
+}
+
+func (ps *Players) For(media *model.Media) Player {
+	if p, ok := ps.Exts[strings.ToLower(filepath.Ext(media.Path))]; ok {
+		return p
+	}
+	if p, ok := ps.Roots[media.Root]; ok {
+		return p
+	}
+	return ps.Default
+}
+
+// Close pb once the player exits, releasing any connection to it.
+func Release(pb Playback) {
+	go func() {
+		<-pb.Done()
+		pb.Close()
+	}()
+}
+
+// a player process. its Status is ErrUntracked.
+type process struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	once sync.Once
+}
+
+// start a process, logging lines it writes to stderr.
+func startProcess(name string, args, env []string) (*process, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Env = env
+	// a pipe of our own, so waiting does not wait for children that inherit
+	// stderr (e.g. the application xdg-open runs).
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = w
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	go logLines(r, "Player: "+filepath.Base(name)+": ")
+	p := &process{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			log.Printf("Player: %s: %v", name, err)
+		}
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// log each line read from r until it is closed.
+func logLines(r io.ReadCloser, prefix string) {
+	defer r.Close()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		log.Print(prefix, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Print(prefix, err)
+		io.Copy(ioutil.Discard, r)
+	}
+}
+
+func (p *process) Status() (*Status, error) {
+	return nil, ErrUntracked
+}
+
+func (p *process) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *process) Close() error {
+	if p.cmd == nil {
+		return nil
+	}
+	p.once.Do(func() {
+		select {
+		case <-p.done:
+		default:
+			p.cmd.Process.Kill()
+		}
+	})
+	<-p.done
+	return nil
+}
+
+func randomHex(n int) string {
+	p := make([]byte, n)
+	_, err := rand.Read(p)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(p)
+}
+
+// How often a tracked playback is polled.
+var PollInterval = 5 * time.Second
+
+// How often the position of a tracked playback is recorded as a resume point.
+var RecordInterval = 30 * time.Second
+
+// replaced in tests.
+var (
+	updatePosition = model.UpdatePosition
+	finishMedia    = model.FinishMedia
+)
+
+// Follow pb until the player exits, recording the position of the user in
+// media every RecordInterval and when the player exits. Once the position
+// passes model.FinishThreshold of the duration (the player's if the media's
+// is unknown) the media is finished and positions are no longer recorded.
+// Track returns immediately if pb is not tracked, leaving it running, and
+// otherwise closes pb once the player exits.
+func Track(pb Playback, userid string, media *model.Media) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	tracked := true
+	defer func() {
+		if tracked {
+			pb.Close()
+		}
+	}()
+	var last *Status
+	var recorded float64
+	var recordedAt time.Time
+	record := func(position float64) {
+		_, err := updatePosition(userid, media.Id, position)
+		if err != nil {
+			log.Printf("Player: %v: %v", media.Id, err)
+		}
+		recorded, recordedAt = position, time.Now()
+	}
+	for {
+		select {
+		case <-pb.Done():
+			if last != nil && last.Position > 0 && last.Position != recorded {
+				record(last.Position)
+			}
+			return
+		case <-ticker.C:
+		}
+		status, err := pb.Status()
+		if err == ErrUntracked {
+			tracked = false
+			return
+		}
+		if err == ErrStopped {
+			continue
+		}
+		if err != nil {
+			log.Printf("Player: %v: %v", media.Id, err)
+			continue
+		}
+		if status.Position > 0 {
+			last = status
+		}
+
+		duration := media.Duration
+		if duration <= 0 {
+			duration = status.Duration
+		}
+		if model.FinishThreshold > 0 && duration > 0 && status.Position >= model.FinishThreshold*duration {
+			err := finishMedia(userid, media.Id)
+			if err != nil && err != model.ErrAlreadyFinished {
+				log.Printf("Player: %v: %v", media.Id, err)
+			}
+			// nothing after finishing is recorded.
+			<-pb.Done()
+			return
+		}
+		if status.Position > 0 && status.Position != recorded && time.Since(recordedAt) >= RecordInterval {
+			record(status.Position)
+		}
+	}
+}
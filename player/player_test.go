@@ -0,0 +1,231 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// player_test.go [created: Sun, 18 Oct 2026]
+
+package player
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/mtrack/model"
+)
+
+// plays a list of statuses, one per poll, then exits.
+type fakePlayback struct {
+	statuses chan *Status
+	done     chan struct{}
+	closed   int
+}
+
+func newFakePlayback(statuses ...*Status) *fakePlayback {
+	pb := &fakePlayback{
+		statuses: make(chan *Status, len(statuses)),
+		done:     make(chan struct{}),
+	}
+	for _, s := range statuses {
+		pb.statuses <- s
+	}
+	return pb
+}
+
+func (pb *fakePlayback) Status() (*Status, error) {
+	select {
+	case s := <-pb.statuses:
+		if len(pb.statuses) == 0 {
+			close(pb.done)
+		}
+		return s, nil
+	default:
+		return nil, ErrStopped
+	}
+}
+
+func (pb *fakePlayback) Done() <-chan struct{} { return pb.done }
+func (pb *fakePlayback) Close() error          { pb.closed++; return nil }
+
+func testTrack(t *testing.T, media *model.Media, statuses ...*Status) (positions []float64, finished int) {
+	pb := newFakePlayback(statuses...)
+	defer func() {
+		if pb.closed != 1 {
+			t.Errorf("closed %d times", pb.closed)
+		}
+	}()
+	defer func(poll, rec time.Duration) {
+		PollInterval, RecordInterval = poll, rec
+		updatePosition, finishMedia = model.UpdatePosition, model.FinishMedia
+	}(PollInterval, RecordInterval)
+	PollInterval = time.Millisecond
+	RecordInterval = 0
+	updatePosition = func(userid, mediaid string, position float64) (bool, error) {
+		positions = append(positions, position)
+		return false, nil
+	}
+	finishMedia = func(userid, mediaid string) error {
+		finished++
+		return nil
+	}
+	Track(pb, "u", media)
+	return positions, finished
+}
+
+func TestTrack(t *testing.T) {
+	positions, finished := testTrack(t, &model.Media{Id: "m"},
+		&Status{Position: 0, Duration: 100},
+		&Status{Position: 10, Duration: 100},
+		&Status{Position: 10, Duration: 100, Paused: true},
+		&Status{Position: 20, Duration: 100},
+	)
+	if len(positions) != 2 || positions[0] != 10 || positions[1] != 20 {
+		t.Errorf("positions: %v", positions)
+	}
+	if finished != 0 {
+		t.Errorf("finished %d times", finished)
+	}
+
+	// the media's duration takes precedence over the player's.
+	positions, finished = testTrack(t, &model.Media{Id: "m", MediaInfo: model.MediaInfo{Duration: 50}},
+		&Status{Position: 10, Duration: 100},
+		&Status{Position: 48, Duration: 100},
+	)
+	if len(positions) != 1 || finished != 1 {
+		t.Errorf("positions %v, finished %d times", positions, finished)
+	}
+}
+
+func TestTrackUntracked(t *testing.T) {
+	defer func(poll time.Duration) { PollInterval = poll }(PollInterval)
+	PollInterval = time.Millisecond
+	returned := make(chan bool)
+	go func() {
+		Track(&process{done: make(chan struct{})}, "u", &model.Media{Id: "m"})
+		returned <- true
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("tracked an untracked playback")
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(&Config{Kind: "quicktime"})
+	if err == nil {
+		t.Errorf("unknown kind created")
+	}
+	_, err = New(&Config{Args: []string{"{{.Path"}})
+	if err == nil {
+		t.Errorf("invalid template created")
+	}
+	p, err := New(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd, ok := p.(*Command); !ok || (cmd.name != "xdg-open" && cmd.name != "open") {
+		t.Errorf("default player: %#v", p)
+	}
+}
+
+// a log output safe to read while processes write to it.
+type logBuffer struct {
+	mut sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.buf.String()
+}
+
+func TestCommand(t *testing.T) {
+	logged := new(logBuffer)
+	log.SetOutput(logged)
+	defer log.SetOutput(os.Stderr)
+
+	dir, err := ioutil.TempDir("", "mtrack-player")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	script := `echo "$0 $1 $MTRACK_MEDIA_ID $MTRACK_USER_ID $MTRACK_START" > "$2"; echo oops >&2`
+	p, err := New(&Config{
+		Kind:    KindOpen,
+		Command: "/bin/sh",
+		Args:    []string{"-c", script, "{{.Path}}", "{{.UserId}}-{{.MediaId}}", out},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err := p.Launch(&Request{Path: "/media/a b.mkv", MediaId: "m", UserId: "u", Start: 1.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-pb.Done()
+	got, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "/media/a b.mkv u-m m u 1.5\n" {
+		t.Errorf("arguments: %q", got)
+	}
+	// stderr is logged asynchronously.
+	for i := 0; i < 100 && !strings.Contains(logged.String(), "Player: sh: oops"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(logged.String(), "Player: sh: oops") {
+		t.Errorf("stderr not logged: %q", logged.String())
+	}
+
+	// commands running past the timeout are killed.
+	p, err = New(&Config{Command: "sleep", Args: []string{"10"}, Timeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err = p.Launch(&Request{Path: "ignored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-pb.Done():
+	case <-time.After(5 * time.Second):
+		t.Errorf("command not killed")
+	}
+}
+
+func TestPlayers(t *testing.T) {
+	def, mpv, vlc := None{}, &MPV{}, &VLC{}
+	ps := &Players{
+		Default: def,
+		Roots:   map[string]Player{"/media/tv": mpv},
+		Exts:    map[string]Player{".mp3": vlc},
+	}
+	for i, test := range []struct {
+		root, path string
+		p          Player
+	}{
+		{"/media/movies", "/media/movies/a.mkv", def},
+		{"/media/tv", "/media/tv/a.mkv", mpv},
+		{"/media/tv", "/media/tv/theme.MP3", vlc},
+	} {
+		if p := ps.For(&model.Media{Root: test.root, Path: test.path}); p != test.p {
+			t.Errorf("test %d: %#v", i, p)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// vlc.go [created: Sun, 18 Oct 2026]
+
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Plays media with VLC, following it through its HTTP interface on a local
+// port. The interface is protected by a random password, given to VLC in a
+// private config file so that other users cannot read it from the command
+// line.
+type VLC struct {
+	command *command
+}
+
+func (p *VLC) Launch(req *Request) (Playback, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	client := &VLCClient{
+		URL:      "http://127.0.0.1:" + strconv.Itoa(port),
+		Password: randomHex(16),
+	}
+	config, err := vlcConfig(client.Password)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{
+		"--config=" + config,
+		"--extraintf=http",
+		"--http-host=127.0.0.1",
+		"--http-port=" + strconv.Itoa(port),
+	}
+	if req.Start > 0 {
+		args = append(args, fmt.Sprintf("--start-time=%.3f", req.Start))
+	}
+	args = append(args, "--", req.Path)
+	proc, err := p.command.start(req, args...)
+	if err != nil {
+		os.Remove(config)
+		return nil, err
+	}
+	pb := &vlcPlayback{process: proc, client: client, config: config}
+
+	deadline := time.Now().Add(p.command.launchTimeout())
+	for {
+		_, err = client.Status()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			pb.Close()
+			return nil, err
+		}
+		select {
+		case <-proc.Done():
+			pb.Close()
+			return nil, ErrStopped
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return pb, nil
+}
+
+// write a VLC config file, readable only by us, that sets the password of the
+// HTTP interface.
+func vlcConfig(password string) (string, error) {
+	f, err := ioutil.TempFile("", "mtrack-vlc-")
+	if err != nil {
+		return "", err
+	}
+	_, err = fmt.Fprintf(f, "[lua]\nhttp-password=%s\n", password)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// a port nothing is listening on, hopefully still free when VLC starts.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+type vlcPlayback struct {
+	*process
+	client *VLCClient
+	config string
+}
+
+func (pb *vlcPlayback) Close() error {
+	err := pb.process.Close()
+	os.Remove(pb.config)
+	return err
+}
+
+func (pb *vlcPlayback) Status() (*Status, error) {
+	select {
+	case <-pb.Done():
+		return nil, ErrStopped
+	default:
+	}
+	return pb.client.Status()
+}
+
+// A client of the HTTP interface of VLC.
+type VLCClient struct {
+	URL      string
+	Password string
+	Client   *http.Client
+}
+
+func (c *VLCClient) Status() (*Status, error) {
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	req, err := http.NewRequest("GET", c.URL+"/requests/status.json", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth("", c.Password)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vlc: %s", resp.Status)
+	}
+	var status struct {
+		Time   float64 `json:"time"`
+		Length float64 `json:"length"`
+		State  string  `json:"state"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		return nil, err
+	}
+	return &Status{
+		Position: status.Time,
+		Duration: status.Length,
+		Paused:   status.State == "paused",
+	}, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// vlc_test.go [created: Sun, 18 Oct 2026]
+
+package player
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestVLCClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		_, password, _ := req.BasicAuth()
+		if password != "s3cret" {
+			http.Error(resp, "unauthorized", 401)
+			return
+		}
+		if req.URL.Path != "/requests/status.json" {
+			http.NotFound(resp, req)
+			return
+		}
+		fmt.Fprint(resp, `{"fullscreen":false,"time":1234,"length":2640,"state":"playing","position":0.4674}`)
+	}))
+	defer server.Close()
+
+	client := &VLCClient{URL: server.URL, Password: "s3cret"}
+	status, err := client.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Position != 1234 || status.Duration != 2640 || status.Paused {
+		t.Errorf("status: %+v", status)
+	}
+
+	client.Password = "wrong"
+	_, err = client.Status()
+	if err == nil {
+		t.Errorf("wrong password accepted")
+	}
+}
+
+func TestVLCConfig(t *testing.T) {
+	path, err := vlcConfig("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		t.Errorf("config readable by others: %v", info.Mode())
+	}
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p) != "[lua]\nhttp-password=s3cret\n" {
+		t.Errorf("config: %q", p)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// job.go [created: Sun, 18 Oct 2026]
+
+package scan
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrUnknownRoot = errors.New("unknown root")
+var ErrInvalidDir = errors.New("invalid directory")
+
+// Values for ScanJob.State.
+const (
+	JobQueued   = "queued"
+	JobScanning = "scanning"
+	JobDone     = "done"
+)
+
+// The number of finished jobs a Cron remembers.
+var MaxFinishedJobs = 100
+
+// An on-demand scan requested through Cron.Trigger().
+type ScanJob struct {
+	Id       string
+	Root     string // empty if all roots are scanned
+	Dir      string // relative to the root. empty for the entire root
+	State    string
+	Created  time.Time
+	Started  time.Time
+	Finished time.Time
+	ScanStats
+	Errors []error
+
+	pending int // roots that have not finished scanning
+}
+
+func newJobId() (string, error) {
+	p := make([]byte, 8)
+	_, err := rand.Read(p)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", p), nil
+}
+
+// Clean a directory given relative to a root. ErrInvalidDir is returned if dir
+// is absolute or is not beneath the root.
+func CleanDir(dir string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	if filepath.IsAbs(dir) {
+		return "", ErrInvalidDir
+	}
+	dir = filepath.Clean(dir)
+	if dir == "." {
+		return "", nil
+	}
+	if dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidDir
+	}
+	return dir, nil
+}
+
+// Request a scan of the named root (or all roots if root is empty), limited to
+// the directory dir if dir is not empty. Scanning is done by the root's
+// scheduling goroutine, so a root is never walked concurrently. If an
+// identical request is already waiting to be scanned its job is returned
+// instead of a new one. The returned job is a copy; use Job() to poll it.
+func (cron *Cron) Trigger(root, dir string) (*ScanJob, error) {
+	dir, err := CleanDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if root == "" && dir != "" {
+		return nil, ErrInvalidDir
+	}
+	var roots []*Root
+	for _, r := range cron.scanner.roots {
+		if root == "" || r.Name == root {
+			roots = append(roots, r)
+		}
+	}
+	if len(roots) == 0 {
+		return nil, ErrUnknownRoot
+	}
+
+	cron.lock.Lock()
+	defer cron.lock.Unlock()
+
+	for _, job := range cron.jobs {
+		if job.State == JobQueued && job.Root == root && job.Dir == dir {
+			_job := *job
+			return &_job, nil
+		}
+	}
+
+	id, err := newJobId()
+	if err != nil {
+		return nil, err
+	}
+	job := &ScanJob{
+		Id:      id,
+		Root:    root,
+		Dir:     dir,
+		State:   JobQueued,
+		Created: time.Now(),
+		pending: len(roots),
+	}
+	cron.jobs[id] = job
+	cron.expireJobs()
+	for _, r := range roots {
+		cron.queue[r.Name] = append(cron.queue[r.Name], job)
+		select {
+		case cron.wake[r.Name] <- struct{}{}:
+		default:
+			// the root has already been woken
+		}
+	}
+
+	_job := *job
+	return &_job, nil
+}
+
+// A copy of the job with the given id. Nil is returned if no such job exists
+// (or the job finished long ago).
+func (cron *Cron) Job(id string) *ScanJob {
+	cron.lock.Lock()
+	defer cron.lock.Unlock()
+	job, ok := cron.jobs[id]
+	if !ok {
+		return nil
+	}
+	_job := *job
+	return &_job
+}
+
+// forget the oldest finished jobs. the cron must be locked.
+func (cron *Cron) expireJobs() {
+	var finished []*ScanJob
+	for _, job := range cron.jobs {
+		if job.State == JobDone {
+			finished = append(finished, job)
+		}
+	}
+	for len(finished) > MaxFinishedJobs {
+		oldest := 0
+		for i := range finished {
+			if finished[i].Finished.Before(finished[oldest].Finished) {
+				oldest = i
+			}
+		}
+		delete(cron.jobs, finished[oldest].Id)
+		finished = append(finished[:oldest], finished[oldest+1:]...)
+	}
+}
+
+// scan everything queued for root. a full scan satisfies every job queued for
+// the root, otherwise each requested directory is scanned once.
+func (cron *Cron) runJobs(root *Root) {
+	cron.lock.Lock()
+	jobs := cron.queue[root.Name]
+	delete(cron.queue, root.Name)
+	full := false
+	var dirs []string
+	byDir := make(map[string][]*ScanJob)
+	now := time.Now()
+	for _, job := range jobs {
+		if job.State == JobQueued {
+			job.State = JobScanning
+			job.Started = now
+		}
+		if job.Dir == "" {
+			full = true
+		}
+		if byDir[job.Dir] == nil {
+			dirs = append(dirs, job.Dir)
+		}
+		byDir[job.Dir] = append(byDir[job.Dir], job)
+	}
+	cron.lock.Unlock()
+
+	if full {
+		status := cron.scanRoot(root, nil)
+		cron.finishJobs(jobs, &status.ScanStats, status.Errors)
+		return
+	}
+	for _, dir := range dirs {
+		publishScanStarted(root, dir)
+		stats, errs := cron.scanner.ScanDir(root, dir)
+		publishScanFinished(root, dir, stats, errs)
+		cron.finishJobs(byDir[dir], stats, errs)
+	}
+}
+
+// record the results of a root's scan in jobs.
+func (cron *Cron) finishJobs(jobs []*ScanJob, stats *ScanStats, errs []error) {
+	cron.lock.Lock()
+	defer cron.lock.Unlock()
+	now := time.Now()
+	for _, job := range jobs {
+		job.ScanStats.add(stats)
+		job.Errors = append(job.Errors, errs...)
+		job.pending--
+		if job.pending <= 0 {
+			job.State = JobDone
+			job.Finished = now
+		}
+	}
+	cron.expireJobs()
+}
+
+// Triggers a scan using DefaultCron. Panics if DefaultCron is nil.
+func Trigger(root, dir string) (*ScanJob, error) {
+	return defaultCron().Trigger(root, dir)
+}
+
+// Finds a job of DefaultCron. Panics if DefaultCron is nil.
+func Job(id string) *ScanJob {
+	return defaultCron().Job(id)
+}
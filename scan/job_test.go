@@ -0,0 +1,81 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// job_test.go [created: Sun, 18 Oct 2026]
+
+package scan
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCleanDir(t *testing.T) {
+	for i, test := range []struct {
+		dir, clean string
+		err        error
+	}{
+		{"", "", nil},
+		{".", "", nil},
+		{"Show/Season 1", "Show/Season 1", nil},
+		{"Show/../Other/", "Other", nil},
+		{"/etc", "", ErrInvalidDir},
+		{"..", "", ErrInvalidDir},
+		{"Show/../../etc", "", ErrInvalidDir},
+	} {
+		clean, err := CleanDir(test.dir)
+		if err != test.err {
+			t.Errorf("test %d: %q: error %v (expected %v)", i, test.dir, err, test.err)
+			continue
+		}
+		if clean != test.clean {
+			t.Errorf("test %d: %q: %q (expected %q)", i, test.dir, clean, test.clean)
+		}
+	}
+}
+
+func TestCronTrigger(t *testing.T) {
+	roots := []*Root{{Name: "a", Path: "/a"}, {Name: "b", Path: "/b"}}
+	cron := NewCron(time.Minute, NewScanner(roots))
+
+	_, err := cron.Trigger("c", "")
+	if err != ErrUnknownRoot {
+		t.Errorf("unknown root: %v", err)
+	}
+	_, err = cron.Trigger("", "dir")
+	if err != ErrInvalidDir {
+		t.Errorf("dir without root: %v", err)
+	}
+
+	// the cron is not running so jobs stay queued.
+	job1, err := cron.Trigger("a", "Show")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job2, err := cron.Trigger("a", "Show/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job1.Id != job2.Id {
+		t.Errorf("identical queued jobs were not coalesced")
+	}
+	job3, err := cron.Trigger("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job3.Id == job1.Id {
+		t.Errorf("distinct jobs were coalesced")
+	}
+	if len(cron.queue["a"]) != 2 || len(cron.queue["b"]) != 1 {
+		t.Errorf("queues: %v", cron.queue)
+	}
+
+	job := cron.Job(job1.Id)
+	if job == nil || job.State != JobQueued {
+		t.Errorf("job: %+v", job)
+	}
+	if cron.Job("bogus") != nil {
+		t.Errorf("found bogus job")
+	}
+}
@@ -0,0 +1,355 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// matroska.go [created: Sun, 18 Oct 2026]
+
+package probe
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// The largest Info or Tracks element that will be read into memory.
+var MaxMatroskaHeader int64 = 16 << 20
+
+// EBML element ids used by the prober.
+const (
+	ebmlHeader       = 0x1a45dfa3
+	mkvSegment       = 0x18538067
+	mkvInfo          = 0x1549a966
+	mkvTimecodeScale = 0x2ad7b1
+	mkvDuration      = 0x4489
+	mkvTitle         = 0x7ba9
+	mkvTracks        = 0x1654ae6b
+	mkvTrackEntry    = 0xae
+	mkvTrackType     = 0x83
+	mkvCodecId       = 0x86
+	mkvLanguage      = 0x22b59c
+	mkvLanguageBCP47 = 0x22b59d
+	mkvVideo         = 0xe0
+	mkvPixelWidth    = 0xb0
+	mkvPixelHeight   = 0xba
+	mkvCluster       = 0x1f43b675
+)
+
+// Matroska track types
+const (
+	mkvTrackVideo = 1
+	mkvTrackAudio = 2
+)
+
+// the matroska default language.
+const mkvDefaultLanguage = "eng"
+
+// common codec ids (or their prefixes) and the names they are reported with.
+var mkvCodecs = []struct{ prefix, name string }{
+	{"V_MPEG4/ISO/AVC", "h264"},
+	{"V_MPEGH/ISO/HEVC", "hevc"},
+	{"V_AV1", "av1"},
+	{"V_VP8", "vp8"},
+	{"V_VP9", "vp9"},
+	{"V_MPEG4/", "mpeg4"},
+	{"V_MPEG2", "mpeg2"},
+	{"A_AAC", "aac"},
+	{"A_AC3", "ac3"},
+	{"A_EAC3", "eac3"},
+	{"A_DTS", "dts"},
+	{"A_TRUEHD", "truehd"},
+	{"A_OPUS", "opus"},
+	{"A_VORBIS", "vorbis"},
+	{"A_FLAC", "flac"},
+	{"A_MPEG/L3", "mp3"},
+	{"A_PCM/", "pcm"},
+}
+
+func mkvCodec(id string) string {
+	for _, c := range mkvCodecs {
+		if strings.HasPrefix(id, c.prefix) {
+			return c.name
+		}
+	}
+	return strings.ToLower(id)
+}
+
+type ebmlElement struct {
+	id   uint64
+	data []byte
+}
+
+// the size of an element that extends to the end of its parent.
+const ebmlUnknownSize = -1
+
+// read a variable length integer. if keepMarker is true the length marker
+// bit is retained, as it is in element ids.
+func ebmlReadVint(r io.Reader, keepMarker bool) (uint64, int, error) {
+	b := make([]byte, 1)
+	_, err := io.ReadFull(r, b)
+	if err != nil {
+		return 0, 0, err
+	}
+	n := 1
+	for mask := byte(0x80); n <= 8 && b[0]&mask == 0; mask >>= 1 {
+		n++
+	}
+	if n > 8 {
+		return 0, 0, ErrInvalid
+	}
+	v := uint64(b[0])
+	if !keepMarker {
+		v &= uint64(0xff >> uint(n))
+	}
+	rest := make([]byte, n-1)
+	_, err = io.ReadFull(r, rest)
+	if err != nil {
+		return 0, 0, err
+	}
+	allOnes := v == uint64(0xff>>uint(n))
+	for _, c := range rest {
+		v = v<<8 | uint64(c)
+		allOnes = allOnes && c == 0xff
+	}
+	if !keepMarker && allOnes {
+		return 0, n, errUnknownSize
+	}
+	return v, n, nil
+}
+
+// returned by ebmlReadVint for a size with all value bits set.
+var errUnknownSize = errors.New("unknown size")
+
+// read an element header returning the id, data size, and header length.
+func ebmlReadHeader(r io.Reader) (id uint64, size int64, hlen int, err error) {
+	id, n, err := ebmlReadVint(r, true)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	usize, m, err := ebmlReadVint(r, false)
+	if err == errUnknownSize {
+		return id, ebmlUnknownSize, n + m, nil
+	}
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if usize > math.MaxInt64 {
+		return 0, 0, 0, ErrInvalid
+	}
+	return id, int64(usize), n + m, nil
+}
+
+// split p into the elements it contains.
+func ebmlElements(p []byte) ([]ebmlElement, error) {
+	var elems []ebmlElement
+	r := &sliceReader{p: p}
+	for r.Len() > 0 {
+		id, size, _, err := ebmlReadHeader(r)
+		if err != nil {
+			return nil, ErrInvalid
+		}
+		if size == ebmlUnknownSize || size > int64(r.Len()) {
+			size = int64(r.Len())
+		}
+		elems = append(elems, ebmlElement{id, r.Next(int(size))})
+	}
+	return elems, nil
+}
+
+type sliceReader struct {
+	p []byte
+}
+
+func (r *sliceReader) Read(p []byte) (int, error) {
+	if len(r.p) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.p)
+	r.p = r.p[n:]
+	return n, nil
+}
+
+func (r *sliceReader) Len() int { return len(r.p) }
+
+func (r *sliceReader) Next(n int) []byte {
+	p := r.p[:n]
+	r.p = r.p[n:]
+	return p
+}
+
+func ebmlUint(p []byte) uint64 {
+	var v uint64
+	for _, c := range p {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func ebmlFloat(p []byte) float64 {
+	switch len(p) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(p)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(p))
+	}
+	return 0
+}
+
+func ebmlString(p []byte) string {
+	return strings.TrimRight(string(p), "\x00")
+}
+
+// read the segment's Info and Tracks elements. reading stops at the first
+// cluster, which in practice follows both.
+func probeMatroska(r io.ReadSeeker) (*Info, error) {
+	id, size, _, err := ebmlReadHeader(r)
+	if err != nil || id != ebmlHeader || size == ebmlUnknownSize {
+		return nil, ErrInvalid
+	}
+	_, err = r.Seek(size, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	id, _, _, err = ebmlReadHeader(r)
+	if err != nil || id != mkvSegment {
+		return nil, ErrInvalid
+	}
+
+	info := &Info{Format: FormatMatroska}
+	var seenInfo, seenTracks bool
+	for !seenInfo || !seenTracks {
+		id, size, _, err := ebmlReadHeader(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if id == mkvCluster || size == ebmlUnknownSize {
+			break
+		}
+		if id != mkvInfo && id != mkvTracks {
+			_, err = r.Seek(size, 1)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if size > MaxMatroskaHeader {
+			return nil, ErrInvalid
+		}
+		data := make([]byte, size)
+		_, err = io.ReadFull(r, data)
+		if err != nil {
+			return nil, err
+		}
+		if id == mkvInfo {
+			seenInfo = true
+			err = info.readMkvInfo(data)
+		} else {
+			seenTracks = true
+			err = info.readMkvTracks(data)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !seenInfo && !seenTracks {
+		return nil, ErrInvalid
+	}
+	return info, nil
+}
+
+func (info *Info) readMkvInfo(p []byte) error {
+	elems, err := ebmlElements(p)
+	if err != nil {
+		return err
+	}
+	scale := uint64(1000000) // nanoseconds
+	var duration float64
+	for _, e := range elems {
+		switch e.id {
+		case mkvTimecodeScale:
+			scale = ebmlUint(e.data)
+		case mkvDuration:
+			duration = ebmlFloat(e.data)
+		case mkvTitle:
+			info.Title = ebmlString(e.data)
+		}
+	}
+	info.Duration = time.Duration(duration * float64(scale))
+	return nil
+}
+
+func (info *Info) readMkvTracks(p []byte) error {
+	elems, err := ebmlElements(p)
+	if err != nil {
+		return err
+	}
+	for _, e := range elems {
+		if e.id != mkvTrackEntry {
+			continue
+		}
+		err := info.readMkvTrack(e.data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (info *Info) readMkvTrack(p []byte) error {
+	elems, err := ebmlElements(p)
+	if err != nil {
+		return err
+	}
+	var typ uint64
+	var codec, lang, bcp47 string
+	var width, height int
+	for _, e := range elems {
+		switch e.id {
+		case mkvTrackType:
+			typ = ebmlUint(e.data)
+		case mkvCodecId:
+			codec = mkvCodec(ebmlString(e.data))
+		case mkvLanguage:
+			lang = ebmlString(e.data)
+		case mkvLanguageBCP47:
+			bcp47 = ebmlString(e.data)
+		case mkvVideo:
+			video, err := ebmlElements(e.data)
+			if err != nil {
+				return err
+			}
+			for _, v := range video {
+				switch v.id {
+				case mkvPixelWidth:
+					width = int(ebmlUint(v.data))
+				case mkvPixelHeight:
+					height = int(ebmlUint(v.data))
+				}
+			}
+		}
+	}
+	if bcp47 != "" {
+		lang = bcp47
+	}
+	if lang == "" {
+		lang = mkvDefaultLanguage
+	}
+
+	switch typ {
+	case mkvTrackVideo:
+		if info.VideoCodec == "" {
+			info.VideoCodec = codec
+			info.Width, info.Height = width, height
+		}
+	case mkvTrackAudio:
+		info.addAudio(codec, lang)
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// mp4.go [created: Sun, 18 Oct 2026]
+
+package probe
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+)
+
+// The largest moov atom that will be read into memory.
+var MaxMP4Header int64 = 64 << 20
+
+// common sample entry types and the names they are reported with.
+var mp4Codecs = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"av01": "av1",
+	"vp09": "vp9",
+	"mp4v": "mpeg4",
+	"mp4a": "aac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"Opus": "opus",
+	"fLaC": "flac",
+	".mp3": "mp3",
+	"alac": "alac",
+}
+
+func mp4Codec(fourcc string) string {
+	if name, ok := mp4Codecs[fourcc]; ok {
+		return name
+	}
+	return strings.ToLower(strings.TrimSpace(fourcc))
+}
+
+type mp4Atom struct {
+	typ  string
+	data []byte // the atom's body, excluding its header
+}
+
+// read the top level atoms of r looking for moov. mdat and other large atoms
+// are skipped without being read.
+func probeMP4(r io.ReadSeeker) (*Info, error) {
+	var offset int64
+	header := make([]byte, 16)
+	for {
+		_, err := io.ReadFull(r, header[:8])
+		if err == io.EOF {
+			return nil, ErrInvalid // no moov
+		}
+		if err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:8])
+		hlen := int64(8)
+		switch size {
+		case 0:
+			// the atom extends to the end of the file.
+			end, err := r.Seek(0, 2)
+			if err != nil {
+				return nil, err
+			}
+			size = end - offset
+			_, err = r.Seek(offset+hlen, 0)
+			if err != nil {
+				return nil, err
+			}
+		case 1:
+			_, err := io.ReadFull(r, header[8:16])
+			if err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			hlen = 16
+		}
+		if size < hlen {
+			return nil, ErrInvalid
+		}
+
+		if typ == "moov" {
+			if size-hlen > MaxMP4Header {
+				return nil, ErrInvalid
+			}
+			data := make([]byte, size-hlen)
+			_, err := io.ReadFull(r, data)
+			if err != nil {
+				return nil, err
+			}
+			info := &Info{Format: FormatMP4}
+			err = info.readMoov(data)
+			if err != nil {
+				return nil, err
+			}
+			return info, nil
+		}
+
+		offset += size
+		_, err = r.Seek(offset, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// split p into the atoms it contains.
+func mp4Atoms(p []byte) ([]mp4Atom, error) {
+	var atoms []mp4Atom
+	for len(p) > 0 {
+		if len(p) < 8 {
+			return nil, ErrInvalid
+		}
+		size := uint64(binary.BigEndian.Uint32(p[:4]))
+		typ := string(p[4:8])
+		hlen := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(p))
+		case 1:
+			if len(p) < 16 {
+				return nil, ErrInvalid
+			}
+			size = binary.BigEndian.Uint64(p[8:16])
+			hlen = 16
+		}
+		if size < hlen || size > uint64(len(p)) {
+			return nil, ErrInvalid
+		}
+		atoms = append(atoms, mp4Atom{typ, p[hlen:size]})
+		p = p[size:]
+	}
+	return atoms, nil
+}
+
+// find the first child of p with the given type.
+func mp4Child(p []byte, typ string) ([]byte, bool) {
+	atoms, err := mp4Atoms(p)
+	if err != nil {
+		return nil, false
+	}
+	for _, a := range atoms {
+		if a.typ == typ {
+			return a.data, true
+		}
+	}
+	return nil, false
+}
+
+// find a descendant of p by following path.
+func mp4Path(p []byte, path ...string) ([]byte, bool) {
+	for _, typ := range path {
+		var ok bool
+		p, ok = mp4Child(p, typ)
+		if !ok {
+			return nil, false
+		}
+		if typ == "meta" {
+			// meta is a full atom. its children follow a version and flags.
+			if len(p) < 4 {
+				return nil, false
+			}
+			p = p[4:]
+		}
+	}
+	return p, true
+}
+
+func (info *Info) readMoov(moov []byte) error {
+	atoms, err := mp4Atoms(moov)
+	if err != nil {
+		return err
+	}
+	for _, a := range atoms {
+		switch a.typ {
+		case "mvhd":
+			info.Duration = mp4Duration(a.data)
+		case "trak":
+			info.readTrak(a.data)
+		case "udta":
+			title, ok := mp4Path(a.data, "meta", "ilst", "\xa9nam", "data")
+			if ok && len(title) > 8 {
+				// type indicator and locale precede the value.
+				info.Title = string(title[8:])
+			}
+		}
+	}
+	return nil
+}
+
+// read the duration in a mvhd atom.
+func mp4Duration(p []byte) time.Duration {
+	var timescale, duration uint64
+	switch {
+	case len(p) >= 32 && p[0] == 1:
+		timescale = uint64(binary.BigEndian.Uint32(p[20:24]))
+		duration = binary.BigEndian.Uint64(p[24:32])
+	case len(p) >= 20:
+		timescale = uint64(binary.BigEndian.Uint32(p[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(p[16:20]))
+	}
+	if timescale == 0 {
+		return 0
+	}
+	sec := duration / timescale
+	rem := duration % timescale
+	return time.Duration(sec)*time.Second + time.Duration(rem)*time.Second/time.Duration(timescale)
+}
+
+func (info *Info) readTrak(trak []byte) {
+	handler := ""
+	if hdlr, ok := mp4Path(trak, "mdia", "hdlr"); ok && len(hdlr) >= 12 {
+		handler = string(hdlr[8:12])
+	}
+	codec := ""
+	if stsd, ok := mp4Path(trak, "mdia", "minf", "stbl", "stsd"); ok && len(stsd) >= 16 {
+		// version, flags, and entry count precede the first sample entry.
+		codec = mp4Codec(string(stsd[12:16]))
+	}
+
+	switch handler {
+	case "vide":
+		if info.VideoCodec != "" {
+			return // only the first video track is described
+		}
+		info.VideoCodec = codec
+		if tkhd, ok := mp4Child(trak, "tkhd"); ok {
+			info.Width, info.Height = mp4Dimensions(tkhd)
+		}
+	case "soun":
+		lang := ""
+		if mdhd, ok := mp4Path(trak, "mdia", "mdhd"); ok {
+			lang = mp4Language(mdhd)
+		}
+		info.addAudio(codec, lang)
+	}
+}
+
+// read the width and height from a tkhd atom. they are 16.16 fixed point
+// numbers at the end of the atom.
+func mp4Dimensions(tkhd []byte) (int, int) {
+	n := len(tkhd)
+	if n < 8 {
+		return 0, 0
+	}
+	w := binary.BigEndian.Uint32(tkhd[n-8 : n-4])
+	h := binary.BigEndian.Uint32(tkhd[n-4:])
+	return int(w >> 16), int(h >> 16)
+}
+
+// read the packed ISO-639-2/T language code from a mdhd atom.
+func mp4Language(mdhd []byte) string {
+	off := 20
+	if len(mdhd) > 0 && mdhd[0] == 1 {
+		off = 32
+	}
+	if len(mdhd) < off+2 {
+		return ""
+	}
+	packed := binary.BigEndian.Uint16(mdhd[off : off+2])
+	if packed == 0 || packed == 0x7fff {
+		return ""
+	}
+	lang := []byte{
+		byte(packed>>10&0x1f) + 0x60,
+		byte(packed>>5&0x1f) + 0x60,
+		byte(packed&0x1f) + 0x60,
+	}
+	return string(lang)
+}
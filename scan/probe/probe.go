@@ -0,0 +1,85 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// probe.go [created: Sun, 18 Oct 2026]
+
+// Package probe reads metadata (duration, resolution, codecs, languages, and
+// titles) from the headers of MP4 and Matroska files. Only headers are read;
+// media data is skipped.
+package probe
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+var ErrUnknownFormat = errors.New("unknown format")
+var ErrInvalid = errors.New("invalid file structure")
+
+// Container formats recognized by Probe.
+const (
+	FormatMP4      = "mp4"
+	FormatMatroska = "matroska"
+)
+
+// Metadata about a media file. Fields that could not be determined are left
+// zero.
+type Info struct {
+	Format         string
+	Duration       time.Duration
+	Width          int
+	Height         int
+	VideoCodec     string
+	AudioCodecs    []string
+	AudioLanguages []string
+	Title          string
+}
+
+// Probe the file at path.
+func File(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Probe(f)
+}
+
+// Probe a file, detecting its format from its first bytes.
+func Probe(r io.ReadSeeker) (*Info, error) {
+	head := make([]byte, 12)
+	_, err := io.ReadFull(r, head)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.Seek(0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case string(head[4:8]) == "ftyp":
+		return probeMP4(r)
+	case string(head[:4]) == "\x1a\x45\xdf\xa3":
+		return probeMatroska(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// the language of audio tracks without one.
+const undeterminedLanguage = "und"
+
+func (info *Info) addAudio(codec, lang string) {
+	if lang == "" {
+		lang = undeterminedLanguage
+	}
+	info.AudioCodecs = append(info.AudioCodecs, codec)
+	info.AudioLanguages = append(info.AudioLanguages, lang)
+}
@@ -0,0 +1,183 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// probe_test.go [created: Sun, 18 Oct 2026]
+
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func atom(typ string, body ...[]byte) []byte {
+	p := bytes.Join(body, nil)
+	head := make([]byte, 8)
+	binary.BigEndian.PutUint32(head, uint32(len(p)+8))
+	copy(head[4:], typ)
+	return append(head, p...)
+}
+
+func u32(vs ...uint32) []byte {
+	p := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint32(p[4*i:], v)
+	}
+	return p
+}
+
+func zeros(n int) []byte { return make([]byte, n) }
+
+func testMP4() []byte {
+	mvhd := atom("mvhd", u32(0, 0, 0, 1000, 5025000), zeros(80))
+	vtrak := atom("trak",
+		atom("tkhd", u32(0, 0, 0, 1, 0, 0), zeros(52), u32(1920<<16, 1080<<16)),
+		atom("mdia",
+			atom("mdhd", u32(0, 0, 0, 1000, 5025000), []byte{0x15, 0xc7, 0, 0}),
+			atom("hdlr", u32(0, 0), []byte("vide"), zeros(12)),
+			atom("minf", atom("stbl", atom("stsd", u32(0, 1), atom("avc1", zeros(78))))),
+		),
+	)
+	// "jpn" packed into 15 bits
+	jpn := uint16(('j'-0x60)<<10 | ('p'-0x60)<<5 | ('n' - 0x60))
+	atrak := atom("trak",
+		atom("tkhd", u32(0, 0, 0, 2, 0, 0), zeros(52), u32(0, 0)),
+		atom("mdia",
+			atom("mdhd", u32(0, 0, 0, 48000, 0), []byte{byte(jpn >> 8), byte(jpn), 0, 0}),
+			atom("hdlr", u32(0, 0), []byte("soun"), zeros(12)),
+			atom("minf", atom("stbl", atom("stsd", u32(0, 1), atom("mp4a", zeros(28))))),
+		),
+	)
+	udta := atom("udta",
+		atom("meta", u32(0),
+			atom("ilst",
+				atom("\xa9nam", atom("data", u32(1, 0), []byte("Big Buck Bunny"))))))
+	return bytes.Join([][]byte{
+		atom("ftyp", []byte("isom"), u32(0x200), []byte("isomavc1")),
+		atom("mdat", zeros(1024)),
+		atom("moov", mvhd, vtrak, atrak, udta),
+	}, nil)
+}
+
+func TestProbeMP4(t *testing.T) {
+	info, err := Probe(bytes.NewReader(testMP4()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &Info{
+		Format:         FormatMP4,
+		Duration:       5025 * time.Second,
+		Width:          1920,
+		Height:         1080,
+		VideoCodec:     "h264",
+		AudioCodecs:    []string{"aac"},
+		AudioLanguages: []string{"jpn"},
+		Title:          "Big Buck Bunny",
+	}
+	if !reflect.DeepEqual(info, expect) {
+		t.Errorf("%+v (expected %+v)", info, expect)
+	}
+}
+
+func ebml(id uint64, body ...[]byte) []byte {
+	p := bytes.Join(body, nil)
+	var head []byte
+	for shift := uint(24); ; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(head) > 0 {
+			head = append(head, b)
+		}
+		if shift == 0 {
+			break
+		}
+	}
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(p)))
+	size[0] = 0x01 // 8 byte vint marker
+	head = append(head, size...)
+	return append(head, p...)
+}
+
+func ebmlU(id uint64, v uint64) []byte {
+	p := make([]byte, 8)
+	binary.BigEndian.PutUint64(p, v)
+	return ebml(id, p)
+}
+
+func testMatroska() []byte {
+	dur := make([]byte, 8)
+	binary.BigEndian.PutUint64(dur, math.Float64bits(1500000))
+	return bytes.Join([][]byte{
+		ebml(ebmlHeader, ebml(0x4282, []byte("matroska"))),
+		ebml(mkvSegment,
+			ebml(0x114d9b74, zeros(32)), // SeekHead
+			ebml(mkvInfo,
+				ebmlU(mkvTimecodeScale, 1000000),
+				ebml(mkvDuration, dur),
+				ebml(mkvTitle, []byte("Sintel")),
+			),
+			ebml(mkvTracks,
+				ebml(mkvTrackEntry,
+					ebmlU(mkvTrackType, mkvTrackVideo),
+					ebml(mkvCodecId, []byte("V_MPEGH/ISO/HEVC")),
+					ebml(mkvVideo, ebmlU(mkvPixelWidth, 3840), ebmlU(mkvPixelHeight, 2160)),
+				),
+				ebml(mkvTrackEntry,
+					ebmlU(mkvTrackType, mkvTrackAudio),
+					ebml(mkvCodecId, []byte("A_OPUS")),
+				),
+				ebml(mkvTrackEntry,
+					ebmlU(mkvTrackType, mkvTrackAudio),
+					ebml(mkvCodecId, []byte("A_AC3")),
+					ebml(mkvLanguage, []byte("ger")),
+				),
+			),
+			ebml(mkvCluster, zeros(1024)),
+		),
+	}, nil)
+}
+
+func TestProbeMatroska(t *testing.T) {
+	info, err := Probe(bytes.NewReader(testMatroska()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &Info{
+		Format:         FormatMatroska,
+		Duration:       1500 * time.Second,
+		Width:          3840,
+		Height:         2160,
+		VideoCodec:     "hevc",
+		AudioCodecs:    []string{"opus", "ac3"},
+		AudioLanguages: []string{"eng", "ger"},
+		Title:          "Sintel",
+	}
+	if !reflect.DeepEqual(info, expect) {
+		t.Errorf("%+v (expected %+v)", info, expect)
+	}
+}
+
+func TestProbeUnknown(t *testing.T) {
+	for _, p := range [][]byte{
+		nil,
+		[]byte("RIFF\x00\x00\x00\x00AVI LIST"),
+	} {
+		_, err := Probe(bytes.NewReader(p))
+		if err != ErrUnknownFormat {
+			t.Errorf("%q: %v", p, err)
+		}
+	}
+}
+
+func TestProbeTruncated(t *testing.T) {
+	for _, p := range [][]byte{testMP4(), testMatroska()} {
+		for n := 12; n < len(p); n += 7 {
+			// must not panic
+			Probe(bytes.NewReader(p[:n]))
+		}
+	}
+}
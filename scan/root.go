@@ -0,0 +1,116 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// root.go [created: Sun, 18 Oct 2026]
+
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+var ErrOutsideRoot = errors.New("path is outside root")
+
+// The users and roles allowed to see a root's media (Read) and to record
+// progress in it (Progress). Entries are "user:<id, username or verified
+// email>" or "role:<name>". A root with no entries is open to everyone; otherwise only
+// the listed users and roles can see it. Progress implies Read, and when
+// Progress is empty anyone who can see the root can record progress.
+type ACL struct {
+	Read     []string
+	Progress []string
+}
+
+func (acl ACL) Validate() error {
+	for _, list := range [][]string{acl.Read, acl.Progress} {
+		for _, entry := range list {
+			if !strings.HasPrefix(entry, "user:") && !strings.HasPrefix(entry, "role:") {
+				return fmt.Errorf("acl entry %q is not user:<name> or role:<name>", entry)
+			}
+		}
+	}
+	return nil
+}
+
+func (acl ACL) Restricted() bool {
+	return len(acl.Read) > 0 || len(acl.Progress) > 0
+}
+
+func aclMatch(list []string, grantees map[string]bool) bool {
+	for _, entry := range list {
+		if grantees[entry] {
+			return true
+		}
+	}
+	return false
+}
+
+// true if a caller with the given acl entries (e.g. "user:alice") may see the
+// root's media.
+func (acl ACL) AllowsRead(grantees map[string]bool) bool {
+	if !acl.Restricted() {
+		return true
+	}
+	return aclMatch(acl.Read, grantees) || aclMatch(acl.Progress, grantees)
+}
+
+// true if a caller with the given acl entries may record progress on the
+// root's media.
+func (acl ACL) AllowsProgress(grantees map[string]bool) bool {
+	if len(acl.Progress) == 0 {
+		return acl.AllowsRead(grantees)
+	}
+	return aclMatch(acl.Progress, grantees)
+}
+
+// The roots of DefaultScanner.
+func Roots() []*Root {
+	if DefaultScanner == nil {
+		return nil
+	}
+	return DefaultScanner.roots
+}
+
+// The root of DefaultScanner with the given path (media.Root), or nil if no
+// configured root has the path.
+func LookupRoot(path string) *Root {
+	if DefaultScanner == nil {
+		return nil
+	}
+	for _, root := range DefaultScanner.roots {
+		if root.Path == path {
+			return root
+		}
+	}
+	return nil
+}
+
+// Resolve symbolic links in path and ensure that the file it names is beneath
+// root. ErrOutsideRoot is returned if it is not.
+func (root *Root) Resolve(path string) (string, error) {
+	rootpath, err := resolvePath(root.Path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	sep := string(filepath.Separator)
+	if !strings.HasPrefix(resolved, strings.TrimRight(rootpath, sep)+sep) {
+		return "", ErrOutsideRoot
+	}
+	return resolved, nil
+}
+
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(path)
+}
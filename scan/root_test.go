@@ -0,0 +1,92 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// root_test.go [created: Sun, 18 Oct 2026]
+
+package scan
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRootResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtrack-root-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	media := filepath.Join(dir, "media")
+	secret := filepath.Join(dir, "secret.txt")
+	for _, p := range []string{media, filepath.Join(media, "show")} {
+		err := os.Mkdir(p, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []string{secret, filepath.Join(media, "show", "a.mkv")} {
+		err := ioutil.WriteFile(p, nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = os.Symlink(secret, filepath.Join(media, "link.mkv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := &Root{Name: "media", Path: media}
+	_, err = root.Resolve(filepath.Join(media, "show", "a.mkv"))
+	if err != nil {
+		t.Errorf("file in root: %v", err)
+	}
+	for _, p := range []string{
+		secret,
+		filepath.Join(media, "..", "secret.txt"),
+		filepath.Join(media, "link.mkv"),
+		media + "-other",
+	} {
+		_, err := root.Resolve(p)
+		if err == nil {
+			t.Errorf("%q: resolved outside root", p)
+		}
+	}
+}
+
+func TestACL(t *testing.T) {
+	alice := map[string]bool{"user:alice": true, "role:viewer": true}
+	bob := map[string]bool{"user:bob": true}
+	anon := map[string]bool{}
+
+	open := ACL{}
+	if !open.AllowsRead(anon) || !open.AllowsProgress(anon) {
+		t.Errorf("open root is restricted")
+	}
+
+	kids := ACL{Read: []string{"role:viewer"}}
+	if !kids.AllowsRead(alice) || !kids.AllowsProgress(alice) {
+		t.Errorf("viewer denied")
+	}
+	if kids.AllowsRead(bob) || kids.AllowsRead(anon) {
+		t.Errorf("non-viewer allowed")
+	}
+
+	shared := ACL{Read: []string{"role:viewer"}, Progress: []string{"user:bob"}}
+	if !shared.AllowsRead(alice) || shared.AllowsProgress(alice) {
+		t.Errorf("read-only access")
+	}
+	if !shared.AllowsRead(bob) || !shared.AllowsProgress(bob) {
+		t.Errorf("progress access does not imply read")
+	}
+
+	if (ACL{Read: []string{"alice"}}).Validate() == nil {
+		t.Errorf("entry without a kind accepted")
+	}
+	if err := shared.Validate(); err != nil {
+		t.Error(err)
+	}
+}
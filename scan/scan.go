@@ -9,12 +9,17 @@ package scan
 import (
 	"crypto/sha1"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/bmatsuo/mtrack/event"
 	"github.com/bmatsuo/mtrack/model"
+	"github.com/bmatsuo/mtrack/scan/probe"
 )
 
 var MediaRoots []FSRoot
@@ -29,8 +34,15 @@ type Root struct {
 	Path string   `json:"path"`
 	Exts []string `json:"exts"`
 	Scan struct {
-		Delay uint64
+		Delay  uint64 // minutes between scans
+		Jitter uint64 // maximum random minutes added to Delay
+		Cron   string // crontab expression, overrides Delay
+		Mode   string // ModeCron (default) or ModeWatch
 	}
+	Series struct {
+		Patterns []string // overrides DefaultEpisodePatterns
+	}
+	ACL ACL
 }
 
 // Scans the filesystem looking for media files
@@ -44,23 +56,88 @@ func NewScanner(roots []*Root) *Scanner {
 	return &Scanner{roots}
 }
 
-// Recursively scan root directories. Symbolic links are not followed.
+// Counts of the files handled during a scan.
+type ScanStats struct {
+	Seen    int `json:"seen"`
+	New     int `json:"new"`
+	Updated int `json:"updated"`
+	Failed  int `json:"failed"`
+	Missing int `json:"missing"`
+	Moved   int `json:"moved"`
+	Probed  int `json:"probed"`
+}
+
+func (stats *ScanStats) add(other *ScanStats) {
+	stats.Seen += other.Seen
+	stats.New += other.New
+	stats.Updated += other.Updated
+	stats.Failed += other.Failed
+	stats.Missing += other.Missing
+	stats.Moved += other.Moved
+	stats.Probed += other.Probed
+}
+
+// Recursively scan root directories. Symbolic links are not followed. After
+// a root has been walked without error its media is reconciled with the
+// database so that deleted and moved files are detected.
 func (s *Scanner) Scan() {
 	errch := make(chan error, 0)
 
 	for _, root := range s.roots {
 		log.Printf("Scan: %q", root.Name)
-		go scanMedia(errch, root.Path, root.Exts...)
+		go scanMedia(errch, root, "", new(ScanStats))
+	}
+
+	// each root sends a nil error when it is done.
+	pending := len(s.roots)
+	for pending > 0 {
+		err := <-errch
+		if err == nil {
+			pending--
+			continue
+		}
+		log.Printf("Scan: %v", err)
+	}
+
+	log.Print("Scan: complete")
+}
+
+// The maximum number of errors ScanRoot() returns.
+var MaxRootErrors = 20
+
+// Recursively scan a single root directory. See Scan(). Counts of the files
+// scanned are returned along with any errors encountered (at most
+// MaxRootErrors).
+func (s *Scanner) ScanRoot(root *Root) (*ScanStats, []error) {
+	return s.ScanDir(root, "")
+}
+
+// Like ScanRoot() but only the directory dir, relative to root.Path, is
+// scanned and reconciled.
+func (s *Scanner) ScanDir(root *Root, dir string) (*ScanStats, []error) {
+	errch := make(chan error, 0)
+	stats := new(ScanStats)
+	var errs []error
+
+	if dir == "" {
+		log.Printf("Scan: %q", root.Name)
+	} else {
+		log.Printf("Scan: %q: %q", root.Name, dir)
 	}
+	go scanMedia(errch, root, dir, stats)
 
 	for err := range errch {
 		if err == nil {
 			break
 		}
 		log.Printf("Scan: %v", err)
+		if len(errs) < MaxRootErrors {
+			errs = append(errs, err)
+		}
 	}
 
-	log.Print("Scan: complete")
+	log.Printf("Scan: %q: complete", root.Name)
+	return stats, errs
 }
 
 // The error returned when an attempt is call Close() a closed *Cron.
@@ -68,6 +145,7 @@ var ErrClosed = fmt.Errorf("closed")
 
 var DefaultScanner *Scanner
 var DefaultCron *Cron
+var DefaultWatchers []*Watcher
 
 func defaultCron() *Cron {
 	if DefaultCron == nil {
@@ -86,20 +164,67 @@ func defaultScanner() *Scanner {
 // Semantically equivalent to
 //		DefaultScanner = NewScanner(roots)
 //		DefaultCron = NewCron(delay, DefaultScanner)
+// along with a Watcher in DefaultWatchers for each root using ModeWatch.
 // Init() must be called before Start().
-func Init(delay time.Duration, roots []*Root) {
+func Init(delay time.Duration, roots []*Root) error {
+	for _, root := range roots {
+		_, err := root.Schedule(delay)
+		if err != nil {
+			return err
+		}
+		_, err = root.EpisodeParser()
+		if err != nil {
+			return err
+		}
+	}
+
 	DefaultScanner = NewScanner(roots)
 	DefaultCron = NewCron(delay, DefaultScanner)
+	DefaultWatchers = nil
+	for _, root := range roots {
+		if root.Scan.Mode != ModeWatch {
+			continue
+		}
+		w, err := NewWatcher(root)
+		if err != nil {
+			for _, w := range DefaultWatchers {
+				w.watcher.Close()
+			}
+			DefaultWatchers = nil
+			return fmt.Errorf("%q: watch: %v", root.Name, err)
+		}
+		DefaultWatchers = append(DefaultWatchers, w)
+	}
+	return nil
 }
 
-// Starts DefaultCron. Panics if DefaultCron is nil.
+// Starts DefaultCron and DefaultWatchers. Panics if DefaultCron is nil.
 func Start(statch chan *CronStatus) {
 	defaultCron().Start(statch)
+	for _, w := range DefaultWatchers {
+		w.Start()
+	}
 }
 
-// Closes DefaultCron. Panics if DefaultCron is nil.
+// Closes DefaultWatchers and DefaultCron. Panics if DefaultCron is nil.
 func Close() error {
-	return defaultCron().Close()
+	var err error
+	for _, w := range DefaultWatchers {
+		_err := w.Close()
+		if _err != nil && err == nil {
+			err = _err
+		}
+	}
+	_err := defaultCron().Close()
+	if _err != nil && err == nil {
+		err = _err
+	}
+	return err
+}
+
+// The status of DefaultCron. Panics if DefaultCron is nil.
+func Status() *CronStatus {
+	return defaultCron().Status()
 }
 
 // Scans using DefaultScanner. Panics if DefaultScanner is nil.
@@ -107,57 +232,151 @@ func Scan() {
 	defaultScanner().Scan()
 }
 
-// Scans the filesystem periodically for new media.
+// Scans the filesystem periodically for new media. Each root is scanned on its
+// own schedule so a slow root does not delay scans of the others.
 type Cron struct {
-	scanner  *Scanner
-	delay    time.Duration
-	term     chan chan error
-	termlock chan chan chan error
+	scanner *Scanner
+	delay   time.Duration
+	term    chan chan error
+	done    chan struct{}
+
+	lock   sync.Mutex
+	status map[string]*CronStatus
+	jobs   map[string]*ScanJob
+	queue  map[string][]*ScanJob
+	wake   map[string]chan struct{}
 }
 
-// Statics about a Cron instance.
+// Values for CronStatus.State.
+const (
+	StateIdle     = "idle"
+	StateScanning = "scanning"
+)
+
+// Statics about a Cron instance. A CronStatus describes either a single root
+// or, as returned by Cron.Status(), the Cron as a whole with the status of
+// each root in Roots. The ScanStats of the Cron as a whole are the sum of the
+// last completed scan of each root.
 type CronStatus struct {
+	Root        string
+	State       string
 	CronStart   time.Time
 	LastScan    time.Time
 	LastScanDur time.Duration
+	NextScan    time.Time
+	ScanStats
+	Errors []error
+	Roots  []*CronStatus
 }
 
-// Create a cron that scans with a delay-minute pause between scans.
-// Scanning does not begin until Start() is called.
+// Create a cron that scans each of the scanner's roots on the schedule
+// configured for it. Roots without a configured schedule pause for delay
+// between scans. Scanning does not begin until Start() is called.
 func NewCron(delay time.Duration, scanner *Scanner) *Cron {
 	cron := new(Cron)
 	cron.scanner = scanner
 	cron.delay = delay
 	cron.term = make(chan chan error, 0) // cannot be buffered
-	cron.termlock = make(chan chan chan error, 1)
-	cron.termlock <- cron.term
+	cron.done = make(chan struct{})
+	cron.status = make(map[string]*CronStatus)
+	cron.jobs = make(map[string]*ScanJob)
+	cron.queue = make(map[string][]*ScanJob)
+	cron.wake = make(map[string]chan struct{}, len(scanner.roots))
+	for _, root := range scanner.roots {
+		cron.wake[root.Name] = make(chan struct{}, 1)
+	}
 	return cron
 }
 
-// TODO
+// The status of the cron and each of its roots. The cron is scanning if any
+// root is. LastScan is the most recent scan start of any root and NextScan the
+// soonest scheduled scan.
 func (cron *Cron) Status() *CronStatus {
-	return new(CronStatus)
+	cron.lock.Lock()
+	defer cron.lock.Unlock()
+
+	status := new(CronStatus)
+	status.State = StateIdle
+	for _, root := range cron.scanner.roots {
+		_status, ok := cron.status[root.Name]
+		if !ok {
+			continue
+		}
+		rstatus := *_status
+		status.Roots = append(status.Roots, &rstatus)
+
+		status.CronStart = rstatus.CronStart
+		if rstatus.State == StateScanning {
+			status.State = StateScanning
+		}
+		if rstatus.LastScan.After(status.LastScan) {
+			status.LastScan = rstatus.LastScan
+			status.LastScanDur = rstatus.LastScanDur
+		}
+		if status.NextScan.IsZero() || rstatus.NextScan.Before(status.NextScan) {
+			status.NextScan = rstatus.NextScan
+		}
+		status.ScanStats.add(&rstatus.ScanStats)
+	}
+	return status
 }
 
-// Begin periodically scanning the filesystem for new files.
-// This method is not capable of detecting deleted files.
+// The status of the named root. Nil is returned if the root has not been
+// scanned.
+func (cron *Cron) RootStatus(name string) *CronStatus {
+	cron.lock.Lock()
+	defer cron.lock.Unlock()
+	status, ok := cron.status[name]
+	if !ok {
+		return nil
+	}
+	_status := *status
+	return &_status
+}
+
+// modify the status of a root. fn is called with the cron locked.
+func (cron *Cron) updateRootStatus(name string, fn func(*CronStatus)) {
+	cron.lock.Lock()
+	defer cron.lock.Unlock()
+	status, ok := cron.status[name]
+	if !ok {
+		status = new(CronStatus)
+		status.Root = name
+		status.State = StateIdle
+		cron.status[name] = status
+	}
+	fn(status)
+}
+
+// Begin periodically scanning the filesystem for new, deleted, and moved
+// files. The status of each completed scan is sent on statch if it is not nil.
 func (cron *Cron) Start(statch chan *CronStatus) {
 	go func() { cron.start(statch) }()
 }
 
 func (cron *Cron) start(statch chan *CronStatus) {
+	defer close(cron.done)
+
 	start := time.Now()
-	term := cron.term
-	var timer <-chan time.Time
+	quit := make(chan struct{})
+	scanned := make(chan *CronStatus)
+	var wg sync.WaitGroup
+	for _, root := range cron.scanner.roots {
+		sched, err := root.Schedule(cron.delay)
+		if err != nil {
+			log.Printf("Cron: %v", err)
+			sched = Every(cron.delay, 0)
+		}
+		wg.Add(1)
+		go func(root *Root, sched Schedule) {
+			defer wg.Done()
+			cron.run(root, sched, start, scanned, quit)
+		}(root, sched)
+	}
+
 	var pending *CronStatus
 	var backlog []*CronStatus
 	var _statch chan *CronStatus
-	var termresp []chan error
-
-	// prime the timer to start scanning immediately
-	_timer := make(chan time.Time, 1)
-	_timer <- time.Now()
-	timer = _timer
 	for {
 		select {
 		case _statch <- pending:
@@ -168,16 +387,8 @@ func (cron *Cron) start(statch chan *CronStatus) {
 				pending = nil
 				_statch = nil
 			}
-		case <-timer:
-			scanstart := time.Now()
-			cron.scanner.Scan()
-			timer = time.After(cron.delay) // start immediately
-			scandur := time.Since(scanstart)
+		case status := <-scanned:
 			if statch != nil {
-				status := new(CronStatus)
-				status.CronStart = start
-				status.LastScan = scanstart
-				status.LastScanDur = scandur
 				if pending == nil {
 					pending = status
 					_statch = statch
@@ -185,37 +396,89 @@ func (cron *Cron) start(statch chan *CronStatus) {
 					backlog = append(backlog, status)
 				}
 			}
-		case errch := <-term:
-			termresp = append(termresp, errch)
-
-			if cron.term != nil {
-				<-cron.termlock
-				close(cron.termlock)
-				close(cron.term)
-				cron.term = nil
-			}
-
+		case errch := <-cron.term:
+			// scans in progress are allowed to finish.
+			close(quit)
+			wg.Wait()
 			errch <- nil
+			return
+		}
+	}
+}
 
-			return // ok because cron.term is unbuffered
+// scan root according to sched until quit is closed.
+func (cron *Cron) run(root *Root, sched Schedule, start time.Time, scanned chan<- *CronStatus, quit <-chan struct{}) {
+	// prime the timer to start scanning immediately
+	_timer := make(chan time.Time, 1)
+	_timer <- time.Now()
+	var timer <-chan time.Time = _timer
+	cron.updateRootStatus(root.Name, func(status *CronStatus) {
+		status.CronStart = start
+		status.NextScan = start
+	})
+	for {
+		select {
+		case <-timer:
+			var next time.Time
+			status := cron.scanRoot(root, func() time.Time {
+				next = sched.Next(time.Now())
+				return next
+			})
+
+			timer = nil
+			if !next.IsZero() {
+				timer = time.After(next.Sub(time.Now()))
+			}
+
+			select {
+			case scanned <- status:
+			case <-quit:
+				return
+			}
+		case <-cron.wake[root.Name]:
+			cron.runJobs(root)
+		case <-quit:
+			return
 		}
 	}
 }
 
+// perform a full scan of root, updating its status. if next is not nil it is
+// called to schedule the next scan. a copy of the updated status is returned.
+func (cron *Cron) scanRoot(root *Root, next func() time.Time) *CronStatus {
+	scanstart := time.Now()
+	cron.updateRootStatus(root.Name, func(status *CronStatus) {
+		status.State = StateScanning
+	})
+	publishScanStarted(root, "")
+	stats, errs := cron.scanner.ScanRoot(root)
+	publishScanFinished(root, "", stats, errs)
+	status := new(CronStatus)
+	cron.updateRootStatus(root.Name, func(_status *CronStatus) {
+		_status.State = StateIdle
+		_status.LastScan = scanstart
+		_status.LastScanDur = time.Since(scanstart)
+		if next != nil {
+			_status.NextScan = next()
+		}
+		_status.ScanStats = *stats
+		_status.Errors = errs
+		*status = *_status
+	})
+	return status
+}
+
 // this will block until the Cron has closed. if cron.Start() has not previously
 // been called the behavior of Close() is not defined; a client should be
 // prepared for either an error or blocking until cron.Start() is called.
 func (cron *Cron) Close() error {
-	term, ok := <-cron.termlock
-	if !ok {
+	errch := make(chan error, 1)
+	select {
+	case cron.term <- errch:
+		return <-errch
+	case <-cron.done:
 		return ErrClosed
 	}
-
-	defer func() { cron.termlock <- term }()
-
-	errch := make(chan error, 1)
-	term <- errch
-	return <-errch
 }
 
 // Perform a single scan of the filesystem for media content.
@@ -224,29 +487,81 @@ func ScanMedia() {
 
 	for _, root := range MediaRoots {
 		log.Printf("Scan: %q", root.Name)
-		go scanMedia(errch, root.Path, ".go")
+		root := &Root{Name: root.Name, Path: root.Path, Exts: []string{".go"}}
+		go scanMedia(errch, root, "", new(ScanStats))
 	}
 
-	for err := range errch {
+	pending := len(MediaRoots)
+	for pending > 0 {
+		err := <-errch
 		if err == nil {
-			break
+			pending--
+			continue
 		}
 		log.Printf("Scan: %v", err)
-		errch <- err
 	}
 
 	log.Print("Scan: complete")
 }
 
-func scanMedia(errch chan error, root string, exts ...string) {
+// scan the directory dir in root, counting files in stats. stats must not be
+// read until a nil error has been received on errch.
+func scanMedia(errch chan error, root *Root, dir string, stats *ScanStats) {
+	seen := make(map[string]bool)
+	created := make(map[string]bool)
+	parser, err := root.EpisodeParser()
+	if err != nil {
+		errch <- err
+		errch <- nil
+		return
+	}
 	mediahandler := func(path string, info os.FileInfo) error {
-		mediaid, err := model.SyncMedia(root, path, info)
+		stats.Seen++
+		// the file exists even if it cannot be synced (e.g. the database is
+		// busy) and must not be reconciled as missing. this is the id
+		// SyncMedia gives it.
+		seen[getsha1(strings.ToLower(path))] = true
+		mediaid, status, err := model.SyncMedia(root.Path, path, info)
 		if err != nil {
+			stats.Failed++
 			errch <- fmt.Errorf("%q (%v): %T %v", path, mediaid, err, err)
+			return nil
+		}
+		err = model.SyncEpisode(mediaid, parser.Parse(root.Path, path))
+		if err != nil {
+			errch <- fmt.Errorf("%q (%v): episode: %v", path, mediaid, err)
+		}
+		switch status {
+		case model.SyncCreated:
+			stats.New++
+			created[mediaid] = true
+		case model.SyncUpdated:
+			stats.Updated++
 		}
 		return nil
 	}
-	err := WalkDir(root, exts, mediahandler)
+	// root.Path is not cleaned. media ids depend on the exact paths walked.
+	if dir == "" {
+		dir = root.Path
+	} else {
+		sep := string(filepath.Separator)
+		dir = strings.TrimRight(root.Path, sep) + sep + dir
+	}
+	err = WalkDir(dir, root.Exts, mediahandler)
+	if skipped, ok := err.(IncompleteWalkError); ok {
+		// the files walked are indexed but, like any incomplete walk (e.g.
+		// an unmounted volume), nothing is reconciled. files that could not
+		// be read would be marked missing.
+		for _, err := range skipped {
+			errch <- fmt.Errorf("%q: %v", root.Name, err)
+		}
+		err = nil
+	} else if err == nil {
+		err = reconcileMedia(root, dir, seen, created, stats)
+	}
+	if err == nil {
+		probeMedia(errch, root, dir, stats)
+	}
 	errch <- err
 	if err != nil {
 		// chan still needs "zeroing out"
@@ -254,6 +569,85 @@ func scanMedia(errch chan error, root string, exts ...string) {
 	}
 }
 
+func reconcileMedia(root *Root, dir string, seen, created map[string]bool, stats *ScanStats) error {
+	rec, err := model.ReconcileMediaDir(root.Path, dir, seen, created)
+	if err != nil {
+		return fmt.Errorf("%q: reconcile: %v", root.Name, err)
+	}
+	stats.Missing += len(rec.Missing)
+	stats.Moved += len(rec.Moved)
+	for old, id := range rec.Moved {
+		log.Printf("Scan: %q: moved %v -> %v", root.Name, old, id)
+	}
+	if len(rec.Missing) > 0 {
+		log.Printf("Scan: %q: %d missing", root.Name, len(rec.Missing))
+	}
+	return nil
+}
+
+// announce the start of a scan of root, or of the directory dir in root.
+func publishScanStarted(root *Root, dir string) {
+	event.Publish(&event.Event{
+		Type: event.ScanStarted,
+		Root: root.Path,
+		Data: map[string]string{"name": root.Name, "dir": dir},
+	})
+}
+
+func publishScanFinished(root *Root, dir string, stats *ScanStats, errs []error) {
+	event.Publish(&event.Event{
+		Type: event.ScanFinished,
+		Root: root.Path,
+		Data: map[string]interface{}{
+			"name":   root.Name,
+			"dir":    dir,
+			"stats":  stats,
+			"errors": len(errs),
+		},
+	})
+}
+
+// read metadata from new and modified media under dir. errors reading
+// individual files are sent on errch.
+func probeMedia(errch chan error, root *Root, dir string, stats *ScanStats) {
+	media, err := model.UnprobedMedia(root.Path, dir)
+	if err != nil {
+		errch <- fmt.Errorf("%q: probe: %v", root.Name, err)
+		return
+	}
+	for _, m := range media {
+		err := ProbeMedia(m.Id, m.Path)
+		if err != nil {
+			errch <- fmt.Errorf("%q (%v): probe: %v", m.Path, m.Id, err)
+			continue
+		}
+		stats.Probed++
+	}
+}
+
+// Read the metadata of the file at path and store it for media id. Files in
+// unrecognized or malformed formats are stored with empty metadata so they
+// are not read again until they change.
+func ProbeMedia(id, path string) error {
+	info, err := probe.File(path)
+	switch err {
+	case nil:
+	case probe.ErrUnknownFormat, probe.ErrInvalid, io.ErrUnexpectedEOF:
+		info = new(probe.Info)
+	default:
+		return err
+	}
+	return model.UpdateMediaInfo(id, &model.MediaInfo{
+		Duration:       info.Duration.Seconds(),
+		Width:          info.Width,
+		Height:         info.Height,
+		VideoCodec:     info.VideoCodec,
+		AudioCodecs:    info.AudioCodecs,
+		AudioLanguages: info.AudioLanguages,
+		Title:          info.Title,
+	})
+}
+
 func getsha1(path string) string {
 	h := sha1.New()
 	h.Write([]byte(path))
@@ -261,17 +655,44 @@ func getsha1(path string) string {
 	return fmt.Sprintf("%x", sum)
 }
 
+// Returned by WalkDir when entries beneath the walked directory could not be
+// read. They were skipped and the rest of the directory was walked.
+type IncompleteWalkError []error
+
+func (err IncompleteWalkError) Error() string {
+	return fmt.Sprintf("walk incomplete: %d unreadable (first: %v)", len(err), err[0])
+}
+
+// Call fn for each file under dir with one of the extensions in ext. An error
+// reading dir itself is returned; unreadable entries beneath it are skipped
+// and returned as an IncompleteWalkError.
 func WalkDir(dir string, ext []string, fn func(path string, info os.FileInfo) error) error {
-	return filepath.Walk(dir, makeWalker(ext, fn))
+	var skipped IncompleteWalkError
+	err := filepath.Walk(dir, makeWalker(dir, ext, fn, &skipped))
+	if err == nil && len(skipped) > 0 {
+		return skipped
+	}
+	return err
 }
 
-func makeWalker(ext []string, fn func(string, os.FileInfo) error) filepath.WalkFunc {
+func makeWalker(dir string, ext []string, fn func(string, os.FileInfo) error, skipped *IncompleteWalkError) filepath.WalkFunc {
 	acceptExt := make(map[string]bool, len(ext))
 	for _, ext := range ext {
 		acceptExt[ext] = true
 	}
 
 	return func(path string, info os.FileInfo, err error) error {
+		if err != nil && path == dir {
+			return err
+		}
+		if err != nil {
+			// one bad entry (e.g. lost+found) must not hide the rest.
+			*skipped = append(*skipped, err)
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		if info.IsDir() {
 			return nil
 		}
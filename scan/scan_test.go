@@ -0,0 +1,71 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// scan_test.go [created: Sun, 18 Oct 2026]
+
+package scan
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMakeWalker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtrack-walk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dirinfo, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "a.mkv")
+	err = ioutil.WriteFile(file, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileinfo, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var walked []string
+	var skipped IncompleteWalkError
+	walk := makeWalker("/media", []string{".mkv"}, func(path string, info os.FileInfo) error {
+		walked = append(walked, path)
+		return nil
+	}, &skipped)
+	denied := errors.New("permission denied")
+
+	// an unreadable root ends the walk.
+	if err := walk("/media", dirinfo, denied); err != denied {
+		t.Errorf("root: %v", err)
+	}
+	// unreadable entries beneath it are skipped.
+	if err := walk("/media/lost+found", dirinfo, denied); err != filepath.SkipDir {
+		t.Errorf("directory: %v", err)
+	}
+	if err := walk("/media/b.mkv", nil, denied); err != nil {
+		t.Errorf("file: %v", err)
+	}
+	if err := walk("/media/c.mkv", fileinfo, nil); err != nil {
+		t.Errorf("readable file: %v", err)
+	}
+	if len(skipped) != 2 || len(walked) != 1 || walked[0] != "/media/c.mkv" {
+		t.Errorf("skipped %v, walked %v", skipped, walked)
+	}
+
+	err = WalkDir(dir, []string{".mkv"}, func(string, os.FileInfo) error { return nil })
+	if err != nil {
+		t.Errorf("complete walk: %v", err)
+	}
+	err = WalkDir(filepath.Join(dir, "missing"), nil, func(string, os.FileInfo) error { return nil })
+	if !os.IsNotExist(err) {
+		t.Errorf("missing directory: %v", err)
+	}
+}
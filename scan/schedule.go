@@ -0,0 +1,206 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// schedule.go [created: Sun, 18 Oct 2026]
+
+package scan
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Determines when a root is scanned.
+type Schedule interface {
+	// The first time after t that a scan should start. A zero time means no
+	// scan should ever start.
+	Next(t time.Time) time.Time
+}
+
+// Returns the schedule for root. Scan.Cron takes precedence over Scan.Delay. If
+// neither is set scans happen every def.
+func (root *Root) Schedule(def time.Duration) (Schedule, error) {
+	if root.Scan.Cron != "" {
+		sched, err := ParseCron(root.Scan.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", root.Name, err)
+		}
+		return sched, nil
+	}
+	delay := time.Duration(root.Scan.Delay) * time.Minute
+	if delay == 0 {
+		delay = def
+	}
+	jitter := time.Duration(root.Scan.Jitter) * time.Minute
+	return Every(delay, jitter), nil
+}
+
+type delaySchedule struct {
+	delay  time.Duration
+	jitter time.Duration
+}
+
+// A schedule with a fixed delay between scans plus a random duration up to
+// jitter, so that roots do not all scan at the same moment.
+func Every(delay, jitter time.Duration) Schedule {
+	return delaySchedule{delay, jitter}
+}
+
+func (s delaySchedule) Next(t time.Time) time.Time {
+	next := t.Add(s.delay)
+	if s.jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+	}
+	return next
+}
+
+// A schedule given by a standard five field crontab expression
+//
+//	minute hour day-of-month month day-of-week
+//
+// Fields may be '*', a number, a range 'a-b', a step '*/n' or 'a-b/n', or a
+// comma separated list of those. As with cron, when both day fields are
+// restricted a day matching either one matches. The shorthands @hourly,
+// @daily, @weekly, and @monthly are also accepted.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+var cronShorthands = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Parse a crontab expression. See cronSchedule.
+func ParseCron(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if short, ok := cronShorthands[expr]; ok {
+		expr = short
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron %q: expected %d fields", expr, len(cronFields))
+	}
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %v", expr, err)
+		}
+		bits[i] = b
+	}
+	s := &cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	// sunday is both 0 and 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("%s: invalid step %q", f.name, part)
+			}
+			part = part[:i]
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			ends := strings.SplitN(part, "-", 2)
+			var err error
+			lo, err = strconv.Atoi(ends[0])
+			if err != nil {
+				return 0, fmt.Errorf("%s: invalid range %q", f.name, part)
+			}
+			hi, err = strconv.Atoi(ends[1])
+			if err != nil {
+				return 0, fmt.Errorf("%s: invalid range %q", f.name, part)
+			}
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("%s: invalid value %q", f.name, part)
+			}
+			lo, hi = n, n
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%s: %q out of range %d-%d", f.name, part, f.min, f.max)
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domStar && s.dowStar:
+		return true
+	case s.domStar:
+		return dow
+	case s.dowStar:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// an expression like "0 0 31 2 *" never matches. give up eventually.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,89 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// schedule_test.go [created: Sun, 18 Oct 2026]
+
+package scan
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	// Sun, 18 Oct 2026
+	now := time.Date(2026, 10, 18, 10, 17, 30, 0, time.UTC)
+	for i, test := range []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 18, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 18, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 10, 18, 11, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 2 * * 1-5", time.Date(2026, 10, 19, 2, 30, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	} {
+		sched, err := ParseCron(test.expr)
+		if err != nil {
+			t.Errorf("test %d: %q: %v", i, test.expr, err)
+			continue
+		}
+		next := sched.Next(now)
+		if !next.Equal(test.next) {
+			t.Errorf("test %d: %q: next %v (expected %v)", i, test.expr, next, test.next)
+		}
+	}
+}
+
+func TestParseCronError(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		_, err := ParseCron(expr)
+		if err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
+
+func TestRootSchedule(t *testing.T) {
+	now := time.Now()
+	root := new(Root)
+	sched, err := root.Schedule(5 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := sched.Next(now); !next.Equal(now.Add(5 * time.Minute)) {
+		t.Errorf("default delay: %v", next.Sub(now))
+	}
+
+	root.Scan.Delay = 10
+	root.Scan.Jitter = 2
+	sched, err = root.Schedule(5 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		d := sched.Next(now).Sub(now)
+		if d < 10*time.Minute || d >= 12*time.Minute {
+			t.Fatalf("jittered delay: %v", d)
+		}
+	}
+
+	root.Scan.Cron = "bogus"
+	_, err = root.Schedule(5 * time.Minute)
+	if err == nil {
+		t.Errorf("expected error")
+	}
+}
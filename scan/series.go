@@ -0,0 +1,124 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// series.go [created: Sun, 18 Oct 2026]
+
+package scan
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bmatsuo/mtrack/model"
+)
+
+// Patterns used for roots that do not configure Series.Patterns. They match
+//
+//	Show.Name.S02E05.720p.mkv
+//	Show Name - 2x05 - Title.mkv
+//	Show Name/Season 2/05 - Title.mkv
+var DefaultEpisodePatterns = []string{
+	`(?i)(?:^|/)(?P<series>[^/]+?)[ ._-]+S(?P<season>\d{1,3})[ ._-]?E(?P<episode>\d{1,4})(?:[^/]*?[ ._]-[ ._](?P<title>[^/]+)|[^/]*)$`,
+	`(?i)(?:^|/)(?P<series>[^/]+?)[ ._-]+(?P<season>\d{1,2})x(?P<episode>\d{1,3})(?:[ ._-]+(?P<title>[^/]+))?$`,
+	`(?i)(?:^|/)(?P<series>[^/]+)/(?:Season|Series)[ ._-]*(?P<season>\d{1,3})/(?:E|Ep|Episode)?[ ._-]*(?P<episode>\d{1,4})(?:[ ._-]+(?P<title>[^/]+))?$`,
+}
+
+// Parses series, season and episode numbers from media paths. Each pattern is
+// a regular expression matched against a media path relative to its root,
+// using forward slashes and without the file extension. Patterns must define
+// the named groups "series", "season" and "episode" and may define "title".
+type EpisodeParser struct {
+	patterns []*regexp.Regexp
+}
+
+func NewEpisodeParser(patterns []string) (*EpisodeParser, error) {
+	p := new(EpisodeParser)
+	for _, pat := range patterns {
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			return nil, err
+		}
+		groups := make(map[string]bool)
+		for _, name := range re.SubexpNames() {
+			groups[name] = true
+		}
+		for _, name := range []string{"series", "season", "episode"} {
+			if !groups[name] {
+				return nil, fmt.Errorf("pattern %q: missing group %q", pat, name)
+			}
+		}
+		p.patterns = append(p.patterns, re)
+	}
+	return p, nil
+}
+
+// The episode parser for root, using DefaultEpisodePatterns if root does not
+// configure any.
+func (root *Root) EpisodeParser() (*EpisodeParser, error) {
+	patterns := root.Series.Patterns
+	if len(patterns) == 0 {
+		patterns = DefaultEpisodePatterns
+	}
+	p, err := NewEpisodeParser(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", root.Name, err)
+	}
+	return p, nil
+}
+
+// Parse the path of a media file beneath root. The first matching pattern is
+// used. Nil is returned if no pattern matches.
+func (p *EpisodeParser) Parse(root, path string) *model.EpisodeInfo {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+	rel = strings.TrimSuffix(rel, filepath.Ext(rel))
+	for _, re := range p.patterns {
+		m := re.FindStringSubmatch(rel)
+		if m == nil {
+			continue
+		}
+		// each pattern is tried afresh, whatever became of the last.
+		var err error
+		ep := new(model.EpisodeInfo)
+		for i, name := range re.SubexpNames() {
+			switch name {
+			case "series":
+				ep.Series = cleanEpisodeName(m[i])
+			case "season":
+				ep.Season, err = strconv.Atoi(m[i])
+			case "episode":
+				ep.Episode, err = strconv.Atoi(m[i])
+			case "title":
+				ep.Title = cleanEpisodeName(m[i])
+			}
+			if err != nil {
+				break
+			}
+		}
+		if err != nil || ep.Series == "" {
+			continue
+		}
+		return ep
+	}
+	return nil
+}
+
+// replace the dots and underscores used in place of spaces.
+func cleanEpisodeName(s string) string {
+	if !strings.Contains(s, " ") {
+		s = strings.Map(func(r rune) rune {
+			if r == '.' || r == '_' {
+				return ' '
+			}
+			return r
+		}, s)
+	}
+	return strings.Trim(strings.Join(strings.Fields(s), " "), " -")
+}
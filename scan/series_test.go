@@ -0,0 +1,70 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// series_test.go [created: Sun, 18 Oct 2026]
+
+package scan
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bmatsuo/mtrack/model"
+)
+
+func TestEpisodeParser(t *testing.T) {
+	p, err := NewEpisodeParser(DefaultEpisodePatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		path   string
+		expect *model.EpisodeInfo
+	}{
+		{"/tv/Show.Name.S02E05.720p.x264.mkv", &model.EpisodeInfo{Series: "Show Name", Season: 2, Episode: 5}},
+		{"/tv/Show Name/Season 2/Show.Name.s02e05.mkv", &model.EpisodeInfo{Series: "Show Name", Season: 2, Episode: 5}},
+		{"/tv/Show Name - S01E10 - Pilot.mp4", &model.EpisodeInfo{Series: "Show Name", Season: 1, Episode: 10, Title: "Pilot"}},
+		{"/tv/Show Name/Season 2/05 - The Title.mkv", &model.EpisodeInfo{Series: "Show Name", Season: 2, Episode: 5, Title: "The Title"}},
+		{"/tv/Show Name/Season 02/E05.mkv", &model.EpisodeInfo{Series: "Show Name", Season: 2, Episode: 5}},
+		{"/tv/Show_Name_3x12_Title.avi", &model.EpisodeInfo{Series: "Show Name", Season: 3, Episode: 12, Title: "Title"}},
+		{"/tv/Some Movie (2013).mkv", nil},
+		{"/tv/Movie.1920x1080.mkv", nil},
+	} {
+		ep := p.Parse("/tv", test.path)
+		if !reflect.DeepEqual(ep, test.expect) {
+			t.Errorf("%q: %+v (expected %+v)", test.path, ep, test.expect)
+		}
+	}
+}
+
+func TestEpisodeParserPatterns(t *testing.T) {
+	_, err := NewEpisodeParser([]string{`(?P<series>.+)/(?P<season>\d+)`})
+	if err == nil {
+		t.Errorf("pattern without episode group accepted")
+	}
+
+	root := &Root{Name: "anime", Path: "/anime"}
+	root.Series.Patterns = []string{`^(?P<series>[^/]+)/(?P<episode>\d+)(?P<season>)$`}
+	p, err := root.EpisodeParser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep := p.Parse("/anime", "/anime/Show/012.mkv")
+	if ep != nil {
+		t.Errorf("empty season parsed: %+v", ep)
+	}
+
+	// a pattern that fails to parse does not stop later ones matching.
+	p, err = NewEpisodeParser([]string{
+		`^(?P<series>[^/]+)/(?P<season>[^/]+)/(?P<episode>\d+)$`,
+		`^(?P<series>[^/]+)/Season (?P<season>\d+)/(?P<episode>\d+)$`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep = p.Parse("/anime", "/anime/Show/Season 2/3.mkv")
+	if ep == nil || ep.Series != "Show" || ep.Season != 2 || ep.Episode != 3 {
+		t.Errorf("second pattern: %+v", ep)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// watch.go [created: Sun, 18 Oct 2026]
+
+package scan
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bmatsuo/mtrack/model"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Values for Root.Scan.Mode.
+const (
+	// Roots are only scanned periodically by a Cron.
+	ModeCron = "cron"
+	// Roots are watched for changes (using inotify on linux) in addition to
+	// being scanned periodically.
+	ModeWatch = "watch"
+)
+
+// The amount of time a Watcher waits for a path to stop changing before it
+// syncs the path with the database.
+var WatchSettle = 2 * time.Second
+
+// Watches a Root for changes, synchronizing changed files with the database
+// as they happen. Watchers do not replace a Cron; they make its periodic
+// scans a consistency check.
+type Watcher struct {
+	root    *Root
+	watcher *fsnotify.Watcher
+	exts    map[string]bool
+	parser  *EpisodeParser
+	term    chan chan error
+	done    chan struct{}
+}
+
+// Create a watcher for root. Events are not handled until Start() is called.
+func NewWatcher(root *Root) (*Watcher, error) {
+	w := new(Watcher)
+	w.root = root
+	w.exts = make(map[string]bool, len(root.Exts))
+	for _, ext := range root.Exts {
+		w.exts[ext] = true
+	}
+	w.term = make(chan chan error)
+	w.done = make(chan struct{})
+
+	var err error
+	w.parser, err = root.EpisodeParser()
+	if err != nil {
+		return nil, err
+	}
+	w.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	err = w.addTree(root.Path)
+	if err != nil {
+		w.watcher.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// watch dir and all directories beneath it. fsnotify is not recursive.
+func (w *Watcher) addTree(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return w.watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+// Begin handling filesystem events.
+func (w *Watcher) Start() {
+	go w.start()
+}
+
+func (w *Watcher) start() {
+	defer close(w.done)
+
+	// paths are synced once they have settled so a file being written (e.g.
+	// downloaded) is not synced on every write.
+	pending := make(map[string]bool)
+	var settle <-chan time.Time
+	for {
+		select {
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.event(ev, pending)
+			settle = time.After(WatchSettle)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Watch: %q: %v", w.root.Name, err)
+		case <-settle:
+			w.sync(pending)
+			pending = make(map[string]bool)
+			settle = nil
+		case errch := <-w.term:
+			errch <- w.watcher.Close()
+			return
+		}
+	}
+}
+
+func (w *Watcher) event(ev fsnotify.Event, pending map[string]bool) {
+	if ev.Op&fsnotify.Create != 0 {
+		info, err := os.Lstat(ev.Name)
+		if err == nil && info.IsDir() {
+			// a directory created or moved into the root. its contents
+			// generate no events of their own.
+			err := w.addTree(ev.Name)
+			if err != nil {
+				log.Printf("Watch: %q: %v", w.root.Name, err)
+			}
+			err = WalkDir(ev.Name, w.root.Exts, func(path string, info os.FileInfo) error {
+				pending[path] = true
+				return nil
+			})
+			if err != nil {
+				log.Printf("Watch: %q: %v", w.root.Name, err)
+			}
+			return
+		}
+	}
+	if ev.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename|fsnotify.Remove) == 0 {
+		return
+	}
+	// a path without a media extension that is renamed or removed may be a
+	// directory of media, which generates no events of its own.
+	if w.exts[filepath.Ext(ev.Name)] || ev.Op&(fsnotify.Rename|fsnotify.Remove) != 0 {
+		pending[ev.Name] = true
+	}
+}
+
+// sync settled paths with the database. removed files are marked missing and
+// files that appear to have been moved are linked to their new paths.
+func (w *Watcher) sync(pending map[string]bool) {
+	var missing, created []string
+	for path := range pending {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			info, err = nil, nil
+		}
+		if err != nil {
+			log.Printf("Watch: %q: %v", w.root.Name, err)
+			continue
+		}
+		if info != nil && info.IsDir() {
+			continue
+		}
+		if !w.exts[filepath.Ext(path)] {
+			if info == nil {
+				missing = append(missing, w.vanishDir(path)...)
+			}
+			continue
+		}
+		mediaid, status, err := model.SyncMedia(w.root.Path, path, info)
+		if err != nil {
+			log.Printf("Watch: %q (%v): %T %v", path, mediaid, err, err)
+			continue
+		}
+		switch status {
+		case model.SyncCreated:
+			created = append(created, mediaid)
+		case model.SyncMissing:
+			missing = append(missing, mediaid)
+		}
+		if status == model.SyncCreated || status == model.SyncUpdated {
+			err := ProbeMedia(mediaid, path)
+			if err != nil {
+				log.Printf("Watch: %q (%v): probe: %v", path, mediaid, err)
+			}
+			err = model.SyncEpisode(mediaid, w.parser.Parse(w.root.Path, path))
+			if err != nil {
+				log.Printf("Watch: %q (%v): episode: %v", path, mediaid, err)
+			}
+		}
+	}
+
+	moved, err := model.RelinkMedia(missing, created)
+	if err != nil {
+		log.Printf("Watch: %q: relink: %v", w.root.Name, err)
+	}
+	for old, id := range moved {
+		log.Printf("Watch: %q: moved %v -> %v", w.root.Name, old, id)
+	}
+}
+
+// mark the media beneath a directory that was renamed or removed missing,
+// returning the ids of the media marked.
+func (w *Watcher) vanishDir(dir string) []string {
+	media, err := model.MediaUnder(w.root.Path, dir)
+	if err != nil {
+		log.Printf("Watch: %q: %v", w.root.Name, err)
+		return nil
+	}
+	var missing []string
+	for _, m := range media {
+		mediaid, status, err := model.SyncMedia(w.root.Path, m.Path, nil)
+		if err != nil {
+			log.Printf("Watch: %q (%v): %T %v", m.Path, mediaid, err, err)
+			continue
+		}
+		if status == model.SyncMissing {
+			missing = append(missing, mediaid)
+		}
+	}
+	return missing
+}
+
+// Stop watching the root. Close blocks until the watcher has stopped and
+// returns ErrClosed if it already has. Like Cron.Close(), the behavior of Close
+// is not defined if Start() has not been called.
+func (w *Watcher) Close() error {
+	errch := make(chan error, 1)
+	select {
+	case w.term <- errch:
+		return <-errch
+	case <-w.done:
+		return ErrClosed
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// watch_test.go [created: Sun, 18 Oct 2026]
+
+package scan
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bmatsuo/mtrack/model"
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestWatcherRenameDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtrack-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	model.DBPath = filepath.Join(dir, "mtrack.sqlite")
+	err = model.DBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer model.DB.Close()
+
+	root := &Root{Name: "media", Path: filepath.Join(dir, "media"), Exts: []string{".mkv"}}
+	old := filepath.Join(root.Path, "old")
+	err = os.MkdirAll(old, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldpath := filepath.Join(old, "a.mkv")
+	err = ioutil.WriteFile(oldpath, []byte("media"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(oldpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldid, _, err := model.SyncMedia(root.Path, oldpath, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userid, err := model.LocateOrCreateUserByEmail("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = model.StartMedia(userid, oldid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatcher(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.watcher.Close()
+
+	// the events of renaming old to new, handled without waiting for them.
+	renamed := filepath.Join(root.Path, "new")
+	err = os.Rename(old, renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := make(map[string]bool)
+	w.event(fsnotify.Event{Name: old, Op: fsnotify.Rename}, pending)
+	w.event(fsnotify.Event{Name: renamed, Op: fsnotify.Create}, pending)
+	w.sync(pending)
+
+	m, err := model.FindMedia(oldid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Missing == nil || m.MovedTo == "" {
+		t.Fatalf("renamed media: %+v", m)
+	}
+	moved, err := model.FindMedia(m.MovedTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.Path != filepath.Join(renamed, "a.mkv") {
+		t.Errorf("moved to %q", moved.Path)
+	}
+	// progress follows the media.
+	err = model.StartMedia(userid, moved.Id)
+	if err != model.ErrAlreadyStarted {
+		t.Errorf("progress was not moved: %v", err)
+	}
+
+	// removing the directory marks its media missing.
+	err = os.RemoveAll(renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending = make(map[string]bool)
+	w.event(fsnotify.Event{Name: renamed, Op: fsnotify.Remove}, pending)
+	w.sync(pending)
+	moved, err = model.FindMedia(moved.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.Missing == nil {
+		t.Errorf("removed media is not missing")
+	}
+}
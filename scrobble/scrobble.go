@@ -0,0 +1,348 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// scrobble.go [created: Sun, 18 Oct 2026]
+
+// Package scrobble reads the playback notifications ("scrobbles") that media
+// players send as webhooks and records them as progress.
+//
+// Three formats are understood: Plex webhooks, which are multipart forms with
+// a JSON payload field; Jellyfin webhook plugin JSON, recognized by its
+// NotificationType; and a generic JSON form for anything else (e.g. a Kodi
+// addon or a script):
+//
+//	{
+//		"event": "start",      // start, progress, pause, stop or finish
+//		"user": "alice",       // the account on the player, optional
+//		"path": "/tv/a.mkv",   // the file as the player sees it
+//		"name": "Pilot",       // a title, when the path is unknown
+//		"series": "Show",      // an episode, when the path is unknown
+//		"season": 1,
+//		"episode": 1,
+//		"position": 1234.5,    // seconds
+//		"duration": 2700       // seconds
+//	}
+package scrobble
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bmatsuo/mtrack/model"
+)
+
+// Formats.
+const (
+	FormatPlex     = "plex"
+	FormatJellyfin = "jellyfin"
+	FormatGeneric  = "generic"
+)
+
+// What happened to the media. Pauses are reported as ActionProgress.
+const (
+	ActionStart    = "start"
+	ActionProgress = "progress"
+	ActionStop     = "stop"
+	ActionFinish   = "finish"
+)
+
+// The largest request body read. Plex attaches a thumbnail to its payload.
+var MaxBody int64 = 10 << 20
+
+var ErrUnknownFormat = errors.New("unknown scrobble format")
+
+// An event a scrobble does not record, such as a rating or a new library
+// item. Players send every event to a webhook so these are expected.
+type IgnoredError string
+
+func (err IgnoredError) Error() string {
+	return fmt.Sprintf("ignored event: %s", string(err))
+}
+
+// A playback event reported by a player. Position and Duration are seconds
+// and zero when unknown. The media played is identified by Path if it is
+// known, otherwise by Series, Season and Episode or by Name.
+type Scrobble struct {
+	Format   string  `json:"format"`
+	Action   string  `json:"action"`
+	Account  string  `json:"account,omitempty"`
+	Path     string  `json:"path,omitempty"`
+	Name     string  `json:"name,omitempty"`
+	Series   string  `json:"series,omitempty"`
+	Season   int     `json:"season,omitempty"`
+	Episode  int     `json:"episode,omitempty"`
+	Position float64 `json:"position,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// Read a scrobble in any known format from a request.
+func Parse(req *http.Request) (*Scrobble, error) {
+	mediatype, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediatype == "multipart/form-data" {
+		req.Body = http.MaxBytesReader(nil, req.Body, MaxBody)
+		err := req.ParseMultipartForm(1 << 20)
+		if err != nil {
+			return nil, err
+		}
+		defer req.MultipartForm.RemoveAll()
+		payload := req.MultipartForm.Value["payload"]
+		if len(payload) == 0 {
+			return nil, ErrUnknownFormat
+		}
+		return ParsePlex([]byte(payload[0]))
+	}
+	p, err := ioutil.ReadAll(http.MaxBytesReader(nil, req.Body, MaxBody))
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string]json.RawMessage
+	err = json.Unmarshal(p, &keys)
+	if err != nil {
+		return nil, ErrUnknownFormat
+	}
+	if _, ok := keys["NotificationType"]; ok {
+		return ParseJellyfin(p)
+	}
+	if _, ok := keys["event"]; ok {
+		return ParseGeneric(p)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// A number that templated payloads may quote.
+type number float64
+
+func (x *number) UnmarshalJSON(p []byte) error {
+	s := strings.Trim(string(p), `"`)
+	if s == "" || s == "null" {
+		*x = 0
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %s", p)
+	}
+	*x = number(f)
+	return nil
+}
+
+// Read the JSON payload of a Plex webhook. Times in the payload are in
+// milliseconds.
+func ParsePlex(p []byte) (*Scrobble, error) {
+	var payload struct {
+		Event   string
+		Account struct {
+			Title string
+		}
+		Metadata struct {
+			Type             string `json:"type"`
+			Title            string `json:"title"`
+			GrandparentTitle string `json:"grandparentTitle"`
+			ParentIndex      number `json:"parentIndex"`
+			Index            number `json:"index"`
+			ViewOffset       number `json:"viewOffset"`
+			Duration         number `json:"duration"`
+			Media            []struct {
+				Part []struct {
+					File string `json:"file"`
+				}
+			}
+		}
+	}
+	err := json.Unmarshal(p, &payload)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scrobble{Format: FormatPlex, Account: payload.Account.Title}
+	switch payload.Event {
+	case "media.play", "media.resume":
+		s.Action = ActionStart
+	case "media.pause":
+		s.Action = ActionProgress
+	case "media.stop":
+		s.Action = ActionStop
+	case "media.scrobble":
+		s.Action = ActionFinish
+	default:
+		return nil, IgnoredError(payload.Event)
+	}
+	meta := payload.Metadata
+	switch meta.Type {
+	case "episode":
+		s.Series = meta.GrandparentTitle
+		s.Season = int(meta.ParentIndex)
+		s.Episode = int(meta.Index)
+	case "movie", "clip", "video":
+	default:
+		return nil, IgnoredError(payload.Event + " " + meta.Type)
+	}
+	s.Name = meta.Title
+	s.Position = float64(meta.ViewOffset) / 1000
+	s.Duration = float64(meta.Duration) / 1000
+	if len(meta.Media) > 0 && len(meta.Media[0].Part) > 0 {
+		s.Path = meta.Media[0].Part[0].File
+	}
+	return s, nil
+}
+
+// Jellyfin times are in ticks of 100ns.
+const jellyfinTicks = 1e7
+
+// Read the JSON sent by the Jellyfin webhook plugin with its default
+// template. A Path property is used if the template adds one.
+func ParseJellyfin(p []byte) (*Scrobble, error) {
+	var payload struct {
+		NotificationType      string
+		NotificationUsername  string
+		ItemType              string
+		Name                  string
+		SeriesName            string
+		SeasonNumber          number
+		EpisodeNumber         number
+		PlaybackPositionTicks number
+		RunTimeTicks          number
+		PlayedToCompletion    interface{}
+		Path                  string
+	}
+	err := json.Unmarshal(p, &payload)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scrobble{Format: FormatJellyfin, Account: payload.NotificationUsername}
+	switch payload.NotificationType {
+	case "PlaybackStart":
+		s.Action = ActionStart
+	case "PlaybackProgress":
+		s.Action = ActionProgress
+	case "PlaybackStop":
+		s.Action = ActionStop
+		// templates may quote booleans.
+		if b, ok := payload.PlayedToCompletion.(bool); ok && b {
+			s.Action = ActionFinish
+		}
+		if str, ok := payload.PlayedToCompletion.(string); ok && strings.EqualFold(str, "true") {
+			s.Action = ActionFinish
+		}
+	default:
+		return nil, IgnoredError(payload.NotificationType)
+	}
+	switch payload.ItemType {
+	case "Episode":
+		s.Series = payload.SeriesName
+		s.Season = int(payload.SeasonNumber)
+		s.Episode = int(payload.EpisodeNumber)
+	case "Movie", "Video", "MusicVideo", "":
+	default:
+		return nil, IgnoredError(payload.NotificationType + " " + payload.ItemType)
+	}
+	s.Name = payload.Name
+	s.Path = payload.Path
+	s.Position = float64(payload.PlaybackPositionTicks) / jellyfinTicks
+	s.Duration = float64(payload.RunTimeTicks) / jellyfinTicks
+	return s, nil
+}
+
+// Read the generic JSON form described in the package documentation.
+func ParseGeneric(p []byte) (*Scrobble, error) {
+	var payload struct {
+		Event    string
+		User     string
+		Path     string
+		Name     string
+		Series   string
+		Season   number
+		Episode  number
+		Position number
+		Duration number
+	}
+	err := json.Unmarshal(p, &payload)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scrobble{
+		Format:   FormatGeneric,
+		Account:  payload.User,
+		Path:     payload.Path,
+		Name:     payload.Name,
+		Series:   payload.Series,
+		Season:   int(payload.Season),
+		Episode:  int(payload.Episode),
+		Position: float64(payload.Position),
+		Duration: float64(payload.Duration),
+	}
+	switch payload.Event {
+	case ActionStart, ActionProgress, ActionStop, ActionFinish:
+		s.Action = payload.Event
+	case "pause":
+		s.Action = ActionProgress
+	case "scrobble":
+		s.Action = ActionFinish
+	default:
+		return nil, IgnoredError(payload.Event)
+	}
+	return s, nil
+}
+
+// Find the media played. The path is tried first, then the episode and then
+// the name. sql.ErrNoRows is returned if nothing matches.
+func (s *Scrobble) Match() (*model.Media, error) {
+	var m *model.Media
+	err := sql.ErrNoRows
+	if s.Path != "" {
+		m, err = model.MatchMediaPath(s.Path)
+	}
+	if err == sql.ErrNoRows && s.Series != "" && s.Episode > 0 {
+		m, err = model.MatchEpisode(s.Series, s.Season, s.Episode)
+	}
+	if err == sql.ErrNoRows && s.Name != "" {
+		m, err = model.MatchMediaName(s.Name)
+	}
+	return m, err
+}
+
+// Record the scrobble as progress of a user on media. Other actions than
+// start and finish record nothing without a position. When the media's
+// duration is unknown the player's is used to decide if a position finishes
+// it. The returned bool reports if the media is finished.
+func (s *Scrobble) Apply(userid string, m *model.Media) (bool, error) {
+	switch s.Action {
+	case ActionFinish:
+		err := model.FinishMedia(userid, m.Id)
+		if err == model.ErrAlreadyFinished {
+			err = nil
+		}
+		return err == nil, err
+	case ActionStart:
+		if s.Position <= 0 {
+			err := model.StartMedia(userid, m.Id)
+			if err == model.ErrAlreadyStarted {
+				err = nil
+			}
+			return false, err
+		}
+	case ActionProgress, ActionStop:
+		if s.Position <= 0 {
+			return false, nil
+		}
+	default:
+		return false, fmt.Errorf("unknown action %q", s.Action)
+	}
+
+	threshold := model.FinishThreshold
+	if m.Duration <= 0 && s.Duration > 0 && threshold > 0 && s.Position >= threshold*s.Duration {
+		err := model.FinishMedia(userid, m.Id)
+		if err == model.ErrAlreadyFinished {
+			err = nil
+		}
+		return err == nil, err
+	}
+	return model.UpdatePosition(userid, m.Id, s.Position)
+}
@@ -0,0 +1,200 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// scrobble_test.go [created: Sun, 18 Oct 2026]
+
+package scrobble
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bmatsuo/mtrack/model"
+)
+
+// a request for a fixture, sent as Plex sends its payloads if plex is true.
+func fixtureRequest(t *testing.T, name string, plex bool) *http.Request {
+	p, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentType := "application/json"
+	if plex {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		err = w.WriteField("payload", string(p))
+		if err == nil {
+			// plex attaches a thumbnail of the media.
+			fw, err := w.CreateFormFile("thumb", "thumb.jpg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write([]byte("\xff\xd8\xff\xe0"))
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		p = buf.Bytes()
+		contentType = w.FormDataContentType()
+	}
+	req, err := http.NewRequest("POST", "/api/scrobble", bytes.NewReader(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	return req
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		fixture string
+		plex    bool
+		s       *Scrobble
+	}{
+		{"plex_scrobble.json", true, &Scrobble{
+			Format:   FormatPlex,
+			Action:   ActionFinish,
+			Account:  "alice",
+			Name:     "Serenity",
+			Series:   "Firefly",
+			Season:   1,
+			Episode:  1,
+			Position: 4950,
+			Duration: 5220,
+		}},
+		{"jellyfin_progress.json", false, &Scrobble{
+			Format:   FormatJellyfin,
+			Action:   ActionProgress,
+			Account:  "bob",
+			Name:     "Bushwhacked",
+			Series:   "Firefly",
+			Season:   1,
+			Episode:  3,
+			Position: 600,
+			Duration: 2640,
+		}},
+		{"jellyfin_stop.json", false, &Scrobble{
+			Format:   FormatJellyfin,
+			Action:   ActionFinish,
+			Account:  "bob",
+			Name:     "Serenity",
+			Path:     `D:\Movies\Serenity (2005)\Serenity.mkv`,
+			Position: 7100,
+			Duration: 7140,
+		}},
+		{"generic_pause.json", false, &Scrobble{
+			Format:   FormatGeneric,
+			Action:   ActionProgress,
+			Account:  "carol",
+			Path:     "/mnt/nas/tv/Firefly/Season 1/Firefly.S01E02.mkv",
+			Position: 600,
+			Duration: 2640,
+		}},
+	} {
+		s, err := Parse(fixtureRequest(t, test.fixture, test.plex))
+		if err != nil {
+			t.Errorf("%s: %v", test.fixture, err)
+			continue
+		}
+		if !reflect.DeepEqual(s, test.s) {
+			t.Errorf("%s: %+v", test.fixture, s)
+		}
+	}
+
+	_, err := Parse(fixtureRequest(t, "plex_rate.json", true))
+	if _, ok := err.(IgnoredError); !ok {
+		t.Errorf("plex rating: %v", err)
+	}
+	req, _ := http.NewRequest("POST", "/api/scrobble", strings.NewReader(`{"foo": 1}`))
+	_, err = Parse(req)
+	if err != ErrUnknownFormat {
+		t.Errorf("unknown format: %v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtrack-scrobble")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	model.DBPath = filepath.Join(dir, "mtrack.sqlite")
+	err = model.DBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer model.DB.Close()
+
+	root := filepath.Join(dir, "media")
+	path := filepath.Join(root, "Firefly", "Season 1", "Firefly.S01E02.mkv")
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(path, []byte("video"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaid, _, err := model.SyncMedia(root, path, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userid, err := model.LocateOrCreateUserByEmail("carol@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Parse(fixtureRequest(t, "generic_pause.json", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.Match()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Id != mediaid {
+		t.Fatalf("matched %v", m.Path)
+	}
+	finished, err := s.Apply(userid, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	position, err := model.FindPosition(userid, mediaid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finished || position != 600 {
+		t.Errorf("paused: finished %v at %v", finished, position)
+	}
+
+	// the player's duration decides when the media's is unknown.
+	s.Action = ActionStop
+	s.Position = 2600
+	finished, err = s.Apply(userid, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !finished {
+		t.Errorf("stopped near the end but not finished")
+	}
+
+	s = &Scrobble{Action: ActionFinish, Path: "/elsewhere/Firefly.S01E03.mkv"}
+	_, err = s.Match()
+	if err == nil {
+		t.Errorf("unknown episode matched")
+	}
+}
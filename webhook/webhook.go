@@ -0,0 +1,267 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// webhook.go [created: Sun, 18 Oct 2026]
+
+// Package webhook delivers events to the webhooks stored in the model.
+//
+// Each event is POSTed as JSON to the URL of every webhook it matches. The
+// request carries the headers
+//
+//	X-Mtrack-Event: progress.finished
+//	X-Mtrack-Delivery: 42
+//	X-Mtrack-Timestamp: 1792310400
+//	X-Mtrack-Signature: sha256=<hex>
+//
+// where the signature is the HMAC-SHA256, keyed by the webhook secret, of the
+// timestamp, a period and the body. Receivers should recompute it and reject
+// stale timestamps. Deliveries that do not get a 2xx response are retried
+// with exponential backoff until MaxAttempts, after which they are dead and
+// kept for inspection and manual retry.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bmatsuo/mtrack/event"
+	"github.com/bmatsuo/mtrack/model"
+)
+
+// Request headers.
+const (
+	HeaderEvent     = "X-Mtrack-Event"
+	HeaderDelivery  = "X-Mtrack-Delivery"
+	HeaderTimestamp = "X-Mtrack-Timestamp"
+	HeaderSignature = "X-Mtrack-Signature"
+)
+
+// The number of attempts made to deliver an event before it is dead.
+var MaxAttempts = 8
+
+// How often due deliveries are looked for when nothing new is queued.
+var PollInterval = 15 * time.Second
+
+// The number of due deliveries attempted at a time.
+var BatchSize = 50
+
+// The delay before the next attempt after attempt failed attempts. By
+// default 30s doubling each attempt up to 1h.
+var Backoff = func(attempt int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempt && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
+
+// The signature header value for body sent at timestamp (unix seconds).
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Reports whether signature is the signature of body sent at timestamp.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
+
+// Queues deliveries for events and attempts them in the background.
+type Dispatcher struct {
+	Client  *http.Client
+	wake    chan bool
+	stop    chan bool
+	done    chan bool
+	once    sync.Once
+	started bool
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		Client: &http.Client{Timeout: 10 * time.Second},
+		wake:   make(chan bool, 1),
+		stop:   make(chan bool),
+		done:   make(chan bool),
+	}
+}
+
+// Queue a delivery of e to each webhook it matches. Events that match no
+// webhook are ignored.
+func (d *Dispatcher) Enqueue(e *event.Event) error {
+	hooks, err := model.WebhooksFor(e)
+	if err != nil || len(hooks) == 0 {
+		return err
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		_, err = model.CreateWebhookDelivery(hook.Id, e.Type, payload)
+		if err != nil {
+			return err
+		}
+	}
+	d.Wake()
+	return nil
+}
+
+// Look for due deliveries now instead of at the next poll.
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- true:
+	default:
+	}
+}
+
+// Attempt every delivery due at now. Deliveries of webhooks deleted in the
+// meantime are dropped.
+func (d *Dispatcher) RunDue(now time.Time) error {
+	for {
+		due, err := model.DueWebhookDeliveries(now, BatchSize)
+		if err != nil {
+			return err
+		}
+		for _, dl := range due {
+			hook, err := model.FindWebhook(dl.WebhookId)
+			if err == sql.ErrNoRows {
+				dl.State = model.DeliveryDead
+				dl.NextAttempt = nil
+				dl.LastError = "webhook deleted"
+				err = model.UpdateWebhookDelivery(dl)
+			} else if err == nil {
+				err = d.Deliver(hook, dl)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if len(due) < BatchSize {
+			return nil
+		}
+	}
+}
+
+// Attempt to deliver dl to hook and store the outcome. The returned error is
+// only non-nil if the outcome could not be stored.
+func (d *Dispatcher) Deliver(hook *model.Webhook, dl *model.WebhookDelivery) error {
+	status, err := d.post(hook, dl)
+	dl.Attempts++
+	dl.LastStatus = status
+	dl.LastError = ""
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		dl.State = model.DeliveryDelivered
+		dl.NextAttempt = nil
+	default:
+		if err != nil {
+			dl.LastError = err.Error()
+		} else {
+			dl.LastError = http.StatusText(status)
+		}
+		if dl.Attempts >= MaxAttempts {
+			dl.State = model.DeliveryDead
+			dl.NextAttempt = nil
+			log.Printf("Webhook: %v: delivery %d dead after %d attempts: %s",
+				hook.Id, dl.Id, dl.Attempts, dl.LastError)
+		} else {
+			next := time.Now().Add(Backoff(dl.Attempts))
+			dl.NextAttempt = &next
+		}
+	}
+	return model.UpdateWebhookDelivery(dl)
+}
+
+func (d *Dispatcher) post(hook *model.Webhook, dl *model.WebhookDelivery) (int, error) {
+	body := []byte(dl.Payload)
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mtrack-webhook")
+	req.Header.Set(HeaderEvent, dl.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(dl.Id, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, body))
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// Queue deliveries for events published on bus and attempt them until Close
+// is called.
+func (d *Dispatcher) Start(bus *event.Bus) {
+	bus.Handle(func(e *event.Event) {
+		err := d.Enqueue(e)
+		if err != nil {
+			log.Printf("Webhook: %v %v: %v", e.Type, e.MediaId, err)
+		}
+	})
+	d.started = true
+	go d.run()
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	for {
+		err := d.RunDue(time.Now())
+		if err != nil {
+			log.Printf("Webhook: %v", err)
+		}
+		select {
+		case <-d.stop:
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop attempting deliveries. Events published after Close are still queued
+// and attempted by the next dispatcher started.
+func (d *Dispatcher) Close() error {
+	d.once.Do(func() {
+		close(d.stop)
+		if d.started {
+			<-d.done
+		}
+	})
+	return nil
+}
+
+var DefaultDispatcher = NewDispatcher()
+
+// Start DefaultDispatcher on event.DefaultBus.
+func Start() {
+	DefaultDispatcher.Start(event.DefaultBus)
+}
+
+func Close() error {
+	return DefaultDispatcher.Close()
+}
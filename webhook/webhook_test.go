@@ -0,0 +1,181 @@
+// Copyright 2013, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// webhook_test.go [created: Sun, 18 Oct 2026]
+
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/mtrack/event"
+	"github.com/bmatsuo/mtrack/model"
+)
+
+func dbTest(t *testing.T, testfn func()) {
+	dir, err := ioutil.TempDir("", "mtrack-webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	model.DBPath = filepath.Join(dir, "mtrack.sqlite")
+	err = model.DBInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer model.DB.Close()
+	testfn()
+}
+
+func TestSign(t *testing.T) {
+	sig := Sign("secret", 1, []byte(`{}`))
+	if !Verify("secret", 1, []byte(`{}`), sig) {
+		t.Errorf("signature did not verify")
+	}
+	if Verify("secret", 2, []byte(`{}`), sig) {
+		t.Errorf("signature verified with another timestamp")
+	}
+	if Verify("other", 1, []byte(`{}`), sig) {
+		t.Errorf("signature verified with another secret")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if Backoff(1) != 30*time.Second || Backoff(2) != time.Minute {
+		t.Errorf("backoff: %v %v", Backoff(1), Backoff(2))
+	}
+	if Backoff(100) != time.Hour {
+		t.Errorf("backoff not capped: %v", Backoff(100))
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	dbTest(t, func() {
+		fail := true
+		var received []string
+		server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			body, _ := ioutil.ReadAll(req.Body)
+			timestamp, _ := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+			if !Verify("s3cret", timestamp, body, req.Header.Get(HeaderSignature)) {
+				http.Error(resp, "bad signature", 401)
+				return
+			}
+			if fail {
+				http.Error(resp, "unavailable", 503)
+				return
+			}
+			received = append(received, req.Header.Get(HeaderEvent))
+		}))
+		defer server.Close()
+
+		hook, err := model.CreateWebhook(server.URL, "s3cret", []string{event.ProgressFinished}, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := NewDispatcher()
+		err = d.Enqueue(&event.Event{Type: event.MediaCreated})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = d.Enqueue(&event.Event{Id: 1, Type: event.ProgressFinished, UserId: "u", MediaId: "m"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a failed attempt is retried after backoff.
+		err = d.RunDue(time.Now().Add(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pending, err := model.WebhookDeliveries(hook.Id, model.DeliveryPending, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) != 1 {
+			t.Fatalf("pending: %v", pending)
+		}
+		if pending[0].Attempts != 1 || pending[0].LastStatus != 503 || pending[0].NextAttempt == nil {
+			t.Errorf("failed delivery: %+v", pending[0])
+		}
+
+		fail = false
+		err = d.RunDue(pending[0].NextAttempt.Add(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(received) != 1 || received[0] != event.ProgressFinished {
+			t.Errorf("received: %v", received)
+		}
+		delivered, err := model.WebhookDeliveries(hook.Id, model.DeliveryDelivered, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(delivered) != 1 || delivered[0].Attempts != 2 || delivered[0].LastStatus != 200 {
+			t.Errorf("delivered: %v", delivered)
+		}
+	})
+}
+
+func TestDeadLetter(t *testing.T) {
+	dbTest(t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			http.Error(resp, "gone", 410)
+		}))
+		defer server.Close()
+
+		hook, err := model.CreateWebhook(server.URL, "", nil, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := NewDispatcher()
+		err = d.Enqueue(&event.Event{Type: event.ScanFinished})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		now := time.Now()
+		for i := 0; i < MaxAttempts; i++ {
+			now = now.Add(2 * time.Hour)
+			err = d.RunDue(now)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		dead, err := model.WebhookDeliveries(hook.Id, model.DeliveryDead, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dead) != 1 || dead[0].Attempts != MaxAttempts || dead[0].LastStatus != 410 {
+			t.Fatalf("dead: %v", dead)
+		}
+
+		// dead letters are not attempted again until requeued.
+		err = d.RunDue(now.Add(2 * time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = model.RequeueWebhookDelivery(hook.Id, dead[0].Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = d.RunDue(time.Now().Add(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pending, err := model.WebhookDeliveries(hook.Id, model.DeliveryPending, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) != 1 || pending[0].Attempts != 1 {
+			t.Errorf("requeued: %v", pending)
+		}
+	})
+}